@@ -13,16 +13,41 @@ import (
 	"github.com/eduvpn/eduvpn-common/internal/api"
 	"github.com/eduvpn/eduvpn-common/internal/config"
 	"github.com/eduvpn/eduvpn-common/internal/discovery"
+	"github.com/eduvpn/eduvpn-common/internal/expiry"
 	"github.com/eduvpn/eduvpn-common/internal/failover"
 	"github.com/eduvpn/eduvpn-common/internal/fsm"
 	"github.com/eduvpn/eduvpn-common/internal/http"
 	"github.com/eduvpn/eduvpn-common/internal/log"
 	"github.com/eduvpn/eduvpn-common/internal/server"
 	"github.com/eduvpn/eduvpn-common/types/cookie"
+	failovertypes "github.com/eduvpn/eduvpn-common/types/failover"
+	"github.com/eduvpn/eduvpn-common/types/protocol"
 	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
 	"github.com/jwijenbergh/eduoauth-go"
 )
 
+// AuthFlow is an alias to the OAuth flow type
+type AuthFlow = api.AuthFlow
+
+const (
+	// AuthFlowBrowser is the default OAuth authorization code flow using a browser
+	AuthFlowBrowser = api.AuthFlowBrowser
+	// AuthFlowDevice is the OAuth device authorization grant for headless clients
+	AuthFlowDevice = api.AuthFlowDevice
+)
+
+// Health is an alias to the health of the connection as reported by the liveness monitor
+type Health = failover.Health
+
+const (
+	// HealthHealthy means that the VPN can reach the gateway
+	HealthHealthy = failover.HealthHealthy
+	// HealthDegraded means that the VPN could not reach the gateway recently
+	HealthDegraded = failover.HealthDegraded
+	// HealthDropped means that the VPN could not reach the gateway for a while, the connection is dropped
+	HealthDropped = failover.HealthDropped
+)
+
 // Client is the main struct for the VPN client.
 type Client struct {
 	// The name of the client
@@ -46,12 +71,27 @@ type Client struct {
 	// TokenGetter gets the tokens from the client
 	TokenGetter func(sid string, stype srvtypes.Type) *srvtypes.Tokens
 
-	// tokenCacher
-	tokCacher TokenCacher
+	// tokStore is the store where the OAuth tokens are saved
+	// By default this is an in-memory TokenCacher
+	// It is guarded by tokMu and must be read with tokenStore, as the tokens are also used while mu is not held
+	tokStore TokenStore
+	tokMu    sync.RWMutex
 
 	// cfg is the config
 	cfg *config.Config
 
+	// cfgLock is the lock on the config directory that is held while the client is registered
+	cfgLock *config.Lock
+
+	// expiry is the scheduler for the expiry events, nil if no expiry handler is set
+	expiry *expiry.Scheduler
+
+	// clock is the clock for the expiry events, nil means the system clock
+	clock expiry.Clock
+
+	// renewLead is how long before expiry the configuration is renewed without user interaction, zero disables this
+	renewLead time.Duration
+
 	mu sync.Mutex
 }
 
@@ -73,12 +113,13 @@ func (c *Client) InvalidProfile(ctx context.Context, srv *server.Server) (string
 	// TODO: should this have profiles as a parameter
 	ck := cookie.NewWithContext(ctx)
 
-	prfs, err := srv.Profiles(ctx)
+	caps, err := c.Servers.ProfileCapabilities(srv)
 	if err != nil {
 		return "", err
 	}
-	if !c.SupportsWireguard {
-		prfs = prfs.FilterWireGuard()
+	prfs, err := srv.Profiles(ctx, caps)
+	if err != nil {
+		return "", err
 	}
 	// we are guaranteed to have profiles > 0 (even after filtering)
 	// because internally this callback is only triggered if there is a choice to make
@@ -148,7 +189,10 @@ func New(name string, version string, directory string, stateCallback func(FSMSt
 	http.RegisterAgent(userAgentName(name), version)
 
 	// Initialize the FSM
-	c.FSM = newFSM(stateCallback, directory, debug)
+	c.FSM = newFSM(stateCallback)
+	if debug {
+		c.FSM.SetHistorySize(debugHistorySize)
+	}
 
 	// By default we support wireguard
 	c.SupportsWireguard = true
@@ -156,10 +200,19 @@ func New(name string, version string, directory string, stateCallback func(FSMSt
 	// Debug only if given
 	c.Debug = debug
 
+	// By default tokens are only kept in memory
+	c.tokStore = &TokenCacher{}
+
+	// Make sure no other process writes to the same state file
+	c.cfgLock, err = config.NewLock(directory)
+	if err != nil {
+		return nil, i18nerr.Wrapf(err, "The configuration directory: '%s' could not be locked, is another client running?", directory)
+	}
+
 	c.cfg = config.NewFromDirectory(directory)
 
 	// set the servers
-	c.Servers = server.NewServers(c.Name, c, c.SupportsWireguard, c.cfg.V2)
+	c.Servers = server.NewServers(c.Name, c, c.SupportsWireguard, c.cfg.V3)
 	return c, nil
 }
 
@@ -193,6 +246,13 @@ func (c *Client) TriggerAuth(ctx context.Context, url string, wait bool) (string
 	return "", nil
 }
 
+// TriggerDeviceAuth is called when the OAuth device authorization grant is started
+// The client gets the verification URI and user code as data in the OAuthDeviceStarted state
+// This function satisfies the server.Callbacks interface
+func (c *Client) TriggerDeviceAuth(_ context.Context, da srvtypes.DeviceAuthorization) error {
+	return c.FSM.GoTransitionRequired(StateOAuthDeviceStarted, &da)
+}
+
 // AuthDone is called when authorization is done
 // This is defined to satisfy the server.Callbacks interface
 func (c *Client) AuthDone(id string, t srvtypes.Type) {
@@ -209,16 +269,16 @@ func (c *Client) AuthDone(id string, t srvtypes.Type) {
 }
 
 // TokensUpdated is called when tokens are updated
-// It updates the cache map and the client tokens
+// It updates the token store and the client tokens
 // This is defined to satisfy the server.Callbacks interface
 func (c *Client) TokensUpdated(id string, t srvtypes.Type, tok eduoauth.Token) {
 	if tok.Access == "" {
 		return
 	}
-	// Set the memory
-	err := c.tokCacher.Set(id, t, tok)
+	// Set the token store
+	err := c.tokenStore().Set(id, t, tok)
 	if err != nil {
-		log.Logger.Warningf("failed to set tokens into cache with error: %v", err)
+		log.Logger.Warningf("failed to set tokens into the token store with error: %v", err)
 	}
 
 	if c.TokenSetter == nil {
@@ -246,12 +306,25 @@ func (c *Client) Deregister() {
 	// save the config
 	c.TrySave()
 
+	// No more expiry events, wait for a renewal that is running as the client is emptied out
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry.Wait()
+	}
+
 	// Move the state machine back
 	_, err := c.FSM.GoTransition(StateDeregistered)
 	if err != nil {
 		log.Logger.Debugf("failed deregistered transition: %v", err)
 	}
 
+	// Release the lock on the config directory
+	if c.cfgLock != nil {
+		if err = c.cfgLock.Release(); err != nil {
+			log.Logger.Debugf("failed to release the config directory lock: %v", err)
+		}
+	}
+
 	// Close the log file
 	_ = log.Logger.Close()
 
@@ -311,6 +384,23 @@ func (c *Client) TrySave() {
 	}
 }
 
+// StateRecovered returns a non-nil error if the state file could not be parsed on startup and was restored from the last good backup
+// Servers that were added after this backup was made are lost
+// If there was no usable backup, all servers are lost
+// It also returns an error if the state file was written by a newer version, the state file is then left alone and changes are not saved
+func (c *Client) StateRecovered() error {
+	if c.cfg == nil || c.cfg.Recovered == nil {
+		return nil
+	}
+	if errors.Is(c.cfg.Recovered, config.ErrNewerVersion) {
+		return i18nerr.Wrap(c.cfg.Recovered, "The state file was written by a newer version of the app, the servers cannot be loaded and changes are not saved")
+	}
+	if errors.Is(c.cfg.Recovered, config.ErrNoBackup) {
+		return i18nerr.Wrap(c.cfg.Recovered, "The state file was corrupt and could not be restored from a backup, the servers have to be added again")
+	}
+	return i18nerr.Wrap(c.cfg.Recovered, "The state file was corrupt and has been restored from a backup, recently added servers may be missing")
+}
+
 // AddServer adds a server with identifier and type
 func (c *Client) AddServer(ck *cookie.Cookie, identifier string, _type srvtypes.Type, ni bool) (err error) {
 	c.mu.Lock()
@@ -456,6 +546,10 @@ func (c *Client) RemoveServer(identifier string, _type srvtypes.Type) (err error
 	if err != nil {
 		return i18nerr.Wrapf(err, "The server: '%s' could not be removed", identifier)
 	}
+	// the tokens are no longer needed
+	if err = c.tokenStore().Delete(identifier, _type); err != nil {
+		log.Logger.Warningf("failed to delete tokens from the token store with error: %v", err)
+	}
 	return nil
 }
 
@@ -478,9 +572,108 @@ func (c *Client) SetProfileID(pID string) error {
 	return nil
 }
 
+// SetTokenStore sets the store `ts` that is used for getting and setting OAuth tokens
+// By default tokens are only cached in memory, see TokenCacher
+// Use e.g. NewPassphraseTokenStore or NewKeyFileTokenStore to persist them encrypted on disk
+// The TokenGetter and TokenSetter callbacks are still called if they are set
+func (c *Client) SetTokenStore(ts TokenStore) error {
+	if ts == nil {
+		return i18nerr.NewInternal("The token store cannot be nil")
+	}
+	c.tokMu.Lock()
+	defer c.tokMu.Unlock()
+	c.tokStore = ts
+	return nil
+}
+
+// tokenStore returns the store where the OAuth tokens are saved
+func (c *Client) tokenStore() TokenStore {
+	c.tokMu.RLock()
+	defer c.tokMu.RUnlock()
+	return c.tokStore
+}
+
+// SetFileTokenStore sets a token store that saves the tokens encrypted next to the state file
+// The encryption key is derived from `passphrase` or from the contents of the file `keyFile`
+// Exactly one of these two must be non-empty
+func (c *Client) SetFileTokenStore(passphrase string, keyFile string) error {
+	var ts *FileTokenStore
+	var err error
+	switch {
+	case passphrase != "" && keyFile != "":
+		return i18nerr.NewInternal("Only a passphrase or a key file can be given for the token store, not both")
+	case passphrase != "":
+		ts, err = NewPassphraseTokenStore(c.cfg.Directory(), passphrase)
+	case keyFile != "":
+		ts, err = NewKeyFileTokenStore(c.cfg.Directory(), keyFile)
+	default:
+		return i18nerr.NewInternal("A passphrase or a key file must be given for the token store")
+	}
+	if err != nil {
+		return i18nerr.WrapInternal(err, "The encrypted token store could not be created")
+	}
+	return c.SetTokenStore(ts)
+}
+
+// SetAuthFlow sets the OAuth flow `flow` that is used for new authorizations
+// By default the browser flow is used, AuthFlowDevice can be used for headless clients
+func (c *Client) SetAuthFlow(flow AuthFlow) error {
+	switch flow {
+	case AuthFlowBrowser, AuthFlowDevice:
+	default:
+		return i18nerr.NewInternalf("Unknown OAuth flow: %d", flow)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Servers.AuthFlow = flow
+	return nil
+}
+
+// SetProtocolPreference sets the client wide VPN protocol preference `pref`
+// This is used for servers that have no preference of their own, see SetServerProtocolPreference
+// By default it is auto, meaning that the server chooses the protocol
+func (c *Client) SetProtocolPreference(pref protocol.Preference) error {
+	if !pref.Valid() {
+		return i18nerr.NewInternalf("Unknown protocol preference: %d", pref)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Servers.Preference = pref
+	return nil
+}
+
+// SetServerProtocolPreference sets the VPN protocol preference `pref` for the server with identifier `identifier` and type `_type`
+// This preference is saved in the state file, auto means that the client wide preference is used
+func (c *Client) SetServerProtocolPreference(identifier string, _type srvtypes.Type, pref protocol.Preference) (err error) {
+	if !pref.Valid() {
+		return i18nerr.NewInternalf("Unknown protocol preference: %d", pref)
+	}
+	identifier, err = c.convertIdentifier(identifier, _type)
+	if err != nil {
+		return i18nerr.Wrapf(err, "Server identifier: '%s', is not valid when setting the protocol preference", identifier)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	srv, err := c.Servers.GetServer(identifier, _type)
+	if err != nil {
+		return i18nerr.Wrapf(err, "The protocol preference for server: '%s' could not be set", identifier)
+	}
+	srv.Preferences.Protocol = pref
+	c.TrySave()
+	return nil
+}
+
+// SetCapabilities sets the capabilities `caps` that the client declares
+// Profiles that cannot be used with these capabilities are not shown and cannot be chosen
+func (c *Client) SetCapabilities(caps srvtypes.Capabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Servers.Capabilities = caps
+}
+
 func (c *Client) retrieveTokens(sid string, t srvtypes.Type) (*eduoauth.Token, error) {
-	// get from memory
-	tok, err := c.tokCacher.Get(sid, t)
+	// get from the token store
+	tok, err := c.tokenStore().Get(sid, t)
 	if err == nil {
 		return tok, nil
 	}
@@ -553,19 +746,45 @@ func (c *Client) RenewSession(ck *cookie.Cookie) error {
 }
 
 // StartFailover starts the failover procedure
-func (c *Client) StartFailover(ck *cookie.Cookie, gateway string, mtu int, readRxBytes func() (int64, error)) (bool, error) {
+// `probe` is the probe that is used to check if the gateway can be reached, the zero value means ICMP pings
+func (c *Client) StartFailover(ck *cookie.Cookie, gateway string, mtu int, probe failovertypes.Probe, readRxBytes func() (int64, error)) (bool, error) {
 	f := failover.New(readRxBytes)
 
-	// get current profile
-	d, err := f.Start(ck.Context(), gateway, mtu)
+	p, err := failover.NewProbe(probe, gateway, mtu)
+	if err != nil {
+		return false, i18nerr.Wrapf(err, "Failover failed to complete with gateway: '%s' and MTU: '%d'", gateway, mtu)
+	}
+	defer p.Close() //nolint:errcheck
+
+	d, err := f.Start(ck.Context(), p)
 	if err != nil {
 		return d, i18nerr.Wrapf(err, "Failover failed to complete with gateway: '%s' and MTU: '%d'", gateway, mtu)
 	}
 	return d, nil
 }
 
+// StartLivenessMonitor keeps monitoring whether or not the VPN can reach the gateway until the cookie is cancelled
+// Unlike StartFailover, which is a single check after connecting, this detects a connection that drops at a later time
+// `probe` is the probe that is used to check if the gateway can be reached, the zero value means ICMP pings
+// `onEvent` is called with the health of the connection each time it changes
+func (c *Client) StartLivenessMonitor(ck *cookie.Cookie, gateway string, mtu int, probe failovertypes.Probe, readRxBytes func() (int64, error), onEvent func(Health)) error {
+	f := failover.New(readRxBytes)
+
+	p, err := failover.NewProbe(probe, gateway, mtu)
+	if err != nil {
+		return i18nerr.Wrapf(err, "The liveness monitor failed with gateway: '%s' and MTU: '%d'", gateway, mtu)
+	}
+	defer p.Close() //nolint:errcheck
+
+	err = f.Monitor(ck.Context(), p, onEvent)
+	if err != nil {
+		return i18nerr.Wrapf(err, "The liveness monitor failed with gateway: '%s' and MTU: '%d'", gateway, mtu)
+	}
+	return nil
+}
+
 // ServerList gets the list of servers
 func (c *Client) ServerList() (*srvtypes.List, error) {
-	g := c.cfg.V2.PublicList(c.cfg.Discovery())
+	g := c.cfg.V3.PublicList(c.cfg.Discovery())
 	return g, nil
 }
@@ -287,7 +287,7 @@ func TestConfigStartup(t *testing.T) {
 
 	// set invalid authorization and test again
 	// we cannot test by setting invalid profile because the server only has 1 profile
-	err = state.tokCacher.Set(serverURI, srvtypes.TypeCustom, eduoauth.Token{})
+	err = state.tokStore.Set(serverURI, srvtypes.TypeCustom, eduoauth.Token{})
 	if err != nil {
 		t.Fatalf("Failed to set token cache: %v", err)
 	}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/i18nerr"
+	"github.com/eduvpn/eduvpn-common/internal/log"
+	"github.com/eduvpn/eduvpn-common/internal/version"
+)
+
+// diagnosticsList is the version and update time of a discovery list
+type diagnosticsList struct {
+	Version   uint64    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// diagnosticsInfo is the general information in the diagnostics archive
+type diagnosticsInfo struct {
+	Time           time.Time                  `json:"time"`
+	LibraryVersion string                     `json:"library_version"`
+	ClientID       string                     `json:"client_id"`
+	GoVersion      string                     `json:"go_version"`
+	OS             string                     `json:"os"`
+	Arch           string                     `json:"arch"`
+	State          string                     `json:"state,omitempty"`
+	StateRecovered string                     `json:"state_recovered,omitempty"`
+	StateIncluded  bool                       `json:"state_included"`
+	Discovery      map[string]diagnosticsList `json:"discovery,omitempty"`
+	LogLevel       string                     `json:"log_level"`
+	LogLevels      map[string]string          `json:"log_levels,omitempty"`
+}
+
+// Diagnostics returns a zip archive that can be attached to a bug report
+// It contains:
+// - info.json: the library version, the client ID, the current state, the discovery versions and timestamps and the log levels
+// - state.json: the state file with secrets redacted and without the cached discovery lists
+// - log.jsonl: the most recent log entries that were written, by default the last 500
+// - transitions.json: the recorded state transitions, see SetTransitionHistory
+// If the client is busy, e.g. getting a configuration, the current state, the state file and discovery are left out such that this never blocks
+// The transitions still show the state that the client is in
+func (c *Client) Diagnostics() ([]byte, error) {
+	lvl, levels := log.Logger.Levels()
+	info := diagnosticsInfo{
+		Time:           time.Now(),
+		LibraryVersion: version.Version,
+		ClientID:       c.Name,
+		GoVersion:      runtime.Version(),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		LogLevel:       lvl.String(),
+	}
+	for comp, l := range levels {
+		if info.LogLevels == nil {
+			info.LogLevels = make(map[string]string)
+		}
+		info.LogLevels[comp] = l.String()
+	}
+
+	var state []byte
+	if c.mu.TryLock() {
+		var err error
+		state, err = c.diagnosticsState(&info)
+		c.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	marshal := func(name string, v interface{}) error {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, b)
+	}
+
+	if err := marshal("info.json", info); err != nil {
+		return nil, i18nerr.WrapInternal(err, "The diagnostics info could not be added")
+	}
+	if state != nil {
+		if err := add("state.json", state); err != nil {
+			return nil, i18nerr.WrapInternal(err, "The state could not be added to the diagnostics")
+		}
+	}
+	var logs bytes.Buffer
+	enc := json.NewEncoder(&logs)
+	for _, e := range log.Logger.Recent() {
+		if err := enc.Encode(e); err != nil {
+			return nil, i18nerr.WrapInternal(err, "The recent logs could not be added to the diagnostics")
+		}
+	}
+	if err := add("log.jsonl", logs.Bytes()); err != nil {
+		return nil, i18nerr.WrapInternal(err, "The recent logs could not be added to the diagnostics")
+	}
+	if err := marshal("transitions.json", c.FSM.History()); err != nil {
+		return nil, i18nerr.WrapInternal(err, "The state transitions could not be added to the diagnostics")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, i18nerr.WrapInternal(err, "The diagnostics archive could not be created")
+	}
+	return buf.Bytes(), nil
+}
+
+// diagnosticsState returns the redacted state and fills the state information of `info`
+// The client mutex must be held
+func (c *Client) diagnosticsState(info *diagnosticsInfo) ([]byte, error) {
+	info.State = GetStateName(c.FSM.Current)
+	if c.cfg == nil {
+		return nil, nil
+	}
+	state, err := c.cfg.Redacted()
+	if err != nil {
+		return nil, i18nerr.WrapInternal(err, "The state could not be added to the diagnostics")
+	}
+	info.StateIncluded = true
+	if c.cfg.Recovered != nil {
+		info.StateRecovered = c.cfg.Recovered.Error()
+	}
+	orgs, srvs := c.cfg.Discovery().Lists()
+	info.Discovery = map[string]diagnosticsList{
+		"organizations": {Version: orgs.Version, Timestamp: orgs.Timestamp},
+		"servers":       {Version: srvs.Version, Timestamp: srvs.Timestamp},
+	}
+	return state, nil
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/internal/log"
+	"github.com/eduvpn/eduvpn-common/types/cookie"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+)
+
+// unzip returns the files in zip archive `b` by name
+func unzip(t *testing.T, b []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("failed to read the archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open: %s, err: %v", f.Name, err)
+		}
+		d, err := io.ReadAll(r)
+		r.Close() //nolint:errcheck
+		if err != nil {
+			t.Fatalf("failed to read: %s, err: %v", f.Name, err)
+		}
+		files[f.Name] = string(d)
+	}
+	return files
+}
+
+func TestDiagnostics(t *testing.T) {
+	ck := cookie.NewWithContext(context.Background())
+	defer ck.Cancel() //nolint:errcheck
+
+	c := newTestClient(t)
+	if err := c.Register(); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	if err := c.ImportServers(ck, &srvtypes.Exported{
+		Version: srvtypes.ExportVersion,
+		Servers: []srvtypes.ExportedServer{{Type: srvtypes.TypeCustom, Identifier: "https://a.example.com/", Current: true}},
+	}, false); err != nil {
+		t.Fatalf("failed to import servers: %v", err)
+	}
+	log.Logger.Warningf("got redirect: https://a.example.com/callback?code=secret")
+
+	b, err := c.Diagnostics()
+	if err != nil {
+		t.Fatalf("failed to get the diagnostics: %v", err)
+	}
+	files := unzip(t, b)
+	for _, n := range []string{"info.json", "state.json", "log.jsonl", "transitions.json"} {
+		if _, ok := files[n]; !ok {
+			t.Fatalf("file: %s is not in the diagnostics archive", n)
+		}
+	}
+	var info diagnosticsInfo
+	if err = json.Unmarshal([]byte(files["info.json"]), &info); err != nil {
+		t.Fatalf("failed to parse the diagnostics info: %v", err)
+	}
+	if info.ClientID != "org.letsconnect-vpn.app.linux" || info.State != "Main" || !info.StateIncluded {
+		t.Fatalf("diagnostics info not equal, got: %+v", info)
+	}
+	if !strings.Contains(files["state.json"], "https://a.example.com/") {
+		t.Fatalf("the server is not in the diagnostics state: %s", files["state.json"])
+	}
+	if strings.Contains(files["log.jsonl"], "secret") || !strings.Contains(files["log.jsonl"], "code=REDACTED") {
+		t.Fatalf("the recent logs are not redacted: %s", files["log.jsonl"])
+	}
+
+	// the state is left out if the client is busy
+	c.mu.Lock()
+	b, err = c.Diagnostics()
+	c.mu.Unlock()
+	if err != nil {
+		t.Fatalf("failed to get the diagnostics while busy: %v", err)
+	}
+	if _, ok := unzip(t, b)["state.json"]; ok {
+		t.Fatalf("the state is in the diagnostics while the client is busy")
+	}
+}
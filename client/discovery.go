@@ -4,8 +4,11 @@ import (
 	"strings"
 
 	"github.com/eduvpn/eduvpn-common/i18nerr"
+	"github.com/eduvpn/eduvpn-common/internal/http"
+	"github.com/eduvpn/eduvpn-common/internal/verify"
 	"github.com/eduvpn/eduvpn-common/types/cookie"
 	discotypes "github.com/eduvpn/eduvpn-common/types/discovery"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
 )
 
 func (c *Client) hasDiscovery() bool {
@@ -46,3 +49,47 @@ func (c *Client) DiscoServers(ck *cookie.Cookie) (dss *discotypes.Servers, err e
 	}
 	return
 }
+
+// DiscoSearch searches the organizations and servers from discovery for query `query`
+// It matches the display names and keywords in all languages, ignoring case and accents
+// The results are ranked with a score and filtered by server type `t`, where an unknown type means no filtering
+// This does not contact the discovery server, it uses the lists that were obtained before with DiscoOrganizations and DiscoServers
+func (c *Client) DiscoSearch(query string, t srvtypes.Type) (*discotypes.SearchResults, error) {
+	// Not supported with Let's Connect! & govVPN
+	if !c.hasDiscovery() {
+		return nil, i18nerr.NewInternal("Server/organization discovery with this client ID is not supported")
+	}
+	switch t {
+	case srvtypes.TypeUnknown, srvtypes.TypeInstituteAccess, srvtypes.TypeSecureInternet:
+	default:
+		return nil, i18nerr.NewInternalf("Server type: '%v' is not valid to search discovery for", t)
+	}
+	return c.cfg.Discovery().Search(query, t), nil
+}
+
+// SetDiscoveryConfig sets the discovery source, e.g. a private mirror signed with another minisign key
+// An empty URL means the default discovery server and empty keys mean the keys of the default discovery server
+// The configuration is saved in the state file and the cached discovery lists are removed
+func (c *Client) SetDiscoveryConfig(cfg discotypes.Config) error {
+	// Not supported with Let's Connect! & govVPN
+	if !c.hasDiscovery() {
+		return i18nerr.NewInternal("Server/organization discovery with this client ID is not supported")
+	}
+	if cfg.URL != "" {
+		u, err := http.EnsureValidURL(cfg.URL, true)
+		if err != nil {
+			return i18nerr.Wrapf(err, "The discovery URL: '%s' is not valid", cfg.URL)
+		}
+		cfg.URL = u
+	}
+	for _, k := range cfg.Keys {
+		if err := verify.ValidKey(k); err != nil {
+			return i18nerr.Wrapf(err, "The discovery public key: '%s' is not valid", k)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg.Discovery().SetConfig(cfg)
+	c.TrySave()
+	return nil
+}
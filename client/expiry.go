@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/i18nerr"
+	"github.com/eduvpn/eduvpn-common/internal/expiry"
+	"github.com/eduvpn/eduvpn-common/internal/log"
+	"github.com/eduvpn/eduvpn-common/internal/server"
+)
+
+// ExpiryEvent is an alias to an event of the expiry scheduler
+type ExpiryEvent = expiry.Event
+
+// ExpiryEventType is an alias to the type of an expiry event
+type ExpiryEventType = expiry.EventType
+
+const (
+	// ExpiryRenewButton means that the renew button should be shown
+	ExpiryRenewButton = expiry.EventRenewButton
+	// ExpiryCountdown means that the detailed countdown should be started
+	ExpiryCountdown = expiry.EventCountdown
+	// ExpiryNotify means that a notification should be shown that the VPN expires soon
+	ExpiryNotify = expiry.EventNotify
+	// ExpiryExpired means that the VPN has expired
+	ExpiryExpired = expiry.EventExpired
+	// ExpiryRenewed means that a new configuration was obtained ahead of expiry, it is in the Config field of the event
+	ExpiryRenewed = expiry.EventRenewed
+)
+
+// SetExpiryHandler sets the handler `h` that is called with the expiry events of the VPN
+// The events are scheduled when the client goes to the connected state and stopped when it goes to any state other than connected
+// Events that are already in the past when connecting are fired immediately, except for older notifications
+// Connecting again, e.g. after renewing the session, reschedules the events
+// A nil handler disables the expiry events
+func (c *Client) SetExpiryHandler(h func(ExpiryEvent)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry = nil
+	}
+	if h == nil {
+		return
+	}
+	clock := c.clock
+	if clock == nil {
+		clock = expiry.SystemClock
+	}
+	c.expiry = expiry.NewScheduler(clock, func(ctx context.Context, e ExpiryEvent) {
+		c.onExpiry(ctx, e, h)
+	})
+	// we are already connected, schedule right away
+	if c.FSM.InState(StateConnected) {
+		c.scheduleExpiry(true)
+	}
+}
+
+// SetConfigRenewal sets how long before expiry a new configuration is obtained without user interaction
+// This is only done if the OAuth tokens can be refreshed, the new configuration is passed to the expiry handler with an ExpiryRenewed event
+// If this fails, e.g. because the user needs to authorize again, the renew button, countdown and notification events are fired as usual
+// The renewal is only attempted if an expiry handler is set, zero disables it
+func (c *Client) SetConfigRenewal(lead time.Duration) error {
+	if lead < 0 {
+		return i18nerr.NewInternalf("The configuration renewal time: '%v' cannot be negative", lead)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.renewLead = lead
+	if c.FSM.InState(StateConnected) {
+		c.scheduleExpiry(true)
+	}
+	return nil
+}
+
+// scheduleExpiry schedules the expiry events for the current server
+// If `renew` is true and renewing is enabled, the configuration is renewed ahead of expiry
+// The client mutex must be held
+func (c *Client) scheduleExpiry(renew bool) {
+	if c.expiry == nil {
+		return
+	}
+	srv, err := c.Servers.CurrentServer()
+	if err != nil {
+		log.Logger.Warningf("failed to schedule the expiry events, no current server: %v", err)
+		return
+	}
+	// only renew if there is still time to do so
+	if renew && c.renewLead > 0 && srv.ExpireTime.Add(-c.renewLead).After(c.expiry.Now()) {
+		c.expiry.StartRenewal(srv.LastAuthorizeTime, srv.ExpireTime, c.renewLead)
+		return
+	}
+	c.expiry.Start(srv.LastAuthorizeTime, srv.ExpireTime)
+}
+
+// updateExpiry starts or stops the expiry events when the client goes to state `state`
+// The client mutex must be held
+func (c *Client) updateExpiry(state FSMStateID) {
+	if c.expiry == nil {
+		return
+	}
+	if state == StateConnected {
+		c.scheduleExpiry(true)
+		return
+	}
+	c.expiry.Stop()
+}
+
+// onExpiry handles event `e` of the expiry scheduler, the events for the client are passed to handler `h`
+// `ctx` is cancelled when the events are stopped
+func (c *Client) onExpiry(ctx context.Context, e ExpiryEvent, h func(ExpiryEvent)) {
+	// the events were stopped right before this event was fired
+	if ctx.Err() != nil {
+		return
+	}
+	if e.Type != expiry.EventRenew {
+		h(e)
+		return
+	}
+	re, err := c.renewConfig(ctx)
+	if err != nil {
+		log.Logger.Infof("failed to renew the configuration ahead of expiry, the session needs to be renewed: %v", err)
+		return
+	}
+	// the events were stopped in the meantime
+	if re == nil {
+		return
+	}
+	h(*re)
+}
+
+// renewConfig gets a new configuration for the current server without user interaction and reschedules the expiry events
+// The client mutex is not held while the network requests are done, such that other calls do not have to wait for them
+// If this fails, the events that were left out for the renewal are scheduled
+// It returns the renewed event or nil without an error if the events were stopped before the renewal
+func (c *Client) renewConfig(ctx context.Context) (*ExpiryEvent, error) {
+	c.mu.Lock()
+	// e.g. the client disconnected while we were waiting for the lock
+	if ctx.Err() != nil || c.expiry == nil {
+		c.mu.Unlock()
+		return nil, nil
+	}
+	r, err := c.renewal()
+	c.mu.Unlock()
+	var rn *server.Renewed
+	if err == nil {
+		rn, err = r.Fetch(ctx)
+		if err != nil {
+			err = i18nerr.Wrap(err, "No new VPN configuration could be obtained")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the events were stopped while renewing, the configuration is not used
+	if ctx.Err() != nil || c.expiry == nil {
+		return nil, nil
+	}
+	if err == nil {
+		err = c.applyRenewal(rn)
+	}
+	if err != nil {
+		// fall back to the renew button
+		c.scheduleExpiry(false)
+		return nil, err
+	}
+	c.scheduleExpiry(true)
+	c.TrySave()
+	now := c.expiry.Now().Unix()
+	return &ExpiryEvent{Type: ExpiryRenewed, Time: now, Remaining: rn.Config.Expires - now, Config: rn.Config}, nil
+}
+
+// renewal returns what is needed to renew the configuration of the current server
+// The client mutex must be held
+func (c *Client) renewal() (*server.Renewal, error) {
+	if !c.FSM.InState(StateConnected) {
+		return nil, i18nerr.NewInternal("The configuration can only be renewed when the VPN is connected")
+	}
+	r, err := c.Servers.Renewal()
+	if err != nil {
+		return nil, i18nerr.Wrap(err, "The configuration could not be renewed")
+	}
+	return r, nil
+}
+
+// applyRenewal saves renewed configuration `rn` if it lasts long enough
+// The client mutex must be held
+func (c *Client) applyRenewal(rn *server.Renewed) error {
+	// the configuration must last long enough to be renewed again, it cannot outlast the authorization
+	// nothing is saved such that the VPN keeps using the current configuration
+	et := time.Unix(rn.Config.Expires, 0)
+	if !et.Add(-c.renewLead).After(c.expiry.Now()) {
+		return i18nerr.NewInternalf("The new VPN configuration expires too soon, at: '%v'", et)
+	}
+	if err := c.Servers.ApplyRenewal(rn); err != nil {
+		return i18nerr.Wrap(err, "The renewed VPN configuration could not be saved")
+	}
+	return nil
+}
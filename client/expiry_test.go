@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/types/cookie"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+)
+
+// fixedClock is a clock that is fixed at a time and whose timers fire immediately
+type fixedClock time.Time
+
+func (f fixedClock) Now() time.Time {
+	return time.Time(f)
+}
+
+func (f fixedClock) After(time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	c <- time.Time(f)
+	return c
+}
+
+// recvExpiry receives `n` expiry event types from channel `got`
+func recvExpiry(t *testing.T, got <-chan ExpiryEventType, n int) []ExpiryEventType {
+	var types []ExpiryEventType
+	for len(types) < n {
+		select {
+		case e := <-got:
+			types = append(types, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for the expiry events, got: %v", types)
+		}
+	}
+	return types
+}
+
+// newExpiryClient creates a registered client with a current server that started at `st` and expires at `et`
+func newExpiryClient(t *testing.T, st time.Time, et time.Time) *Client {
+	ck := cookie.NewWithContext(context.Background())
+	defer ck.Cancel() //nolint:errcheck
+
+	c := newTestClient(t)
+	if err := c.Register(); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	if err := c.ImportServers(ck, &srvtypes.Exported{
+		Version: srvtypes.ExportVersion,
+		Servers: []srvtypes.ExportedServer{{Type: srvtypes.TypeCustom, Identifier: "https://a.example.com/", Current: true}},
+	}, false); err != nil {
+		t.Fatalf("failed to import servers: %v", err)
+	}
+	srv, err := c.Servers.CurrentServer()
+	if err != nil {
+		t.Fatalf("failed to get the current server: %v", err)
+	}
+	srv.LastAuthorizeTime = st
+	srv.ExpireTime = et
+	return c
+}
+
+func TestExpiryHandler(t *testing.T) {
+	st := time.Unix(1000000, 0)
+	et := st.Add(48 * time.Hour)
+	c := newExpiryClient(t, st, et)
+
+	// the VPN has expired, all events are fired when connecting
+	c.clock = fixedClock(et.Add(time.Minute))
+	got := make(chan ExpiryEventType, 10)
+	c.SetExpiryHandler(func(e ExpiryEvent) {
+		got <- e.Type
+	})
+	if err := c.SetState(StateConnected); err != nil {
+		t.Fatalf("failed to go to the connected state: %v", err)
+	}
+	types := recvExpiry(t, got, 4)
+	want := []ExpiryEventType{ExpiryRenewButton, ExpiryCountdown, ExpiryNotify, ExpiryExpired}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("expiry events not equal, got: %v, want: %v", types, want)
+	}
+}
+
+func TestConfigRenewalFallback(t *testing.T) {
+	st := time.Unix(1000000, 0)
+	et := st.Add(48 * time.Hour)
+	c := newExpiryClient(t, st, et)
+	c.clock = fixedClock(et.Add(-3 * time.Hour))
+
+	if err := c.SetConfigRenewal(-time.Hour); err == nil {
+		t.Fatalf("expected an error for a negative renewal time")
+	}
+	if err := c.SetConfigRenewal(2 * time.Hour); err != nil {
+		t.Fatalf("failed to set the renewal time: %v", err)
+	}
+	got := make(chan ExpiryEventType, 10)
+	c.SetExpiryHandler(func(e ExpiryEvent) {
+		got <- e.Type
+	})
+	if err := c.SetState(StateConnected); err != nil {
+		t.Fatalf("failed to go to the connected state: %v", err)
+	}
+	// no configuration was obtained that can be renewed so the renewal fails and the events that were left out for the renewal are fired
+	types := recvExpiry(t, got, 6)
+	want := []ExpiryEventType{ExpiryRenewButton, ExpiryCountdown, ExpiryNotify, ExpiryNotify, ExpiryNotify, ExpiryExpired}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("expiry events not equal, got: %v, want: %v", types, want)
+	}
+	srv, err := c.Servers.CurrentServer()
+	if err != nil {
+		t.Fatalf("failed to get the current server: %v", err)
+	}
+	if !srv.ExpireTime.Equal(et) {
+		t.Fatalf("expire time changed after a failed renewal, got: %v, want: %v", srv.ExpireTime, et)
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/i18nerr"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
+	"github.com/eduvpn/eduvpn-common/internal/http"
+	"github.com/eduvpn/eduvpn-common/internal/log"
+	"github.com/eduvpn/eduvpn-common/types/cookie"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+	"github.com/jwijenbergh/eduoauth-go"
+)
+
+// ExportServers exports the configured servers as a portable document
+// The OAuth tokens are only included if `withTokens` is true, these give access to the VPN so the document must then be kept secret
+func (c *Client) ExportServers(withTokens bool) (*srvtypes.Exported, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]v3.ServerKey, 0, len(c.cfg.V3.List))
+	for k := range c.cfg.V3.List {
+		keys = append(keys, k)
+	}
+	// sort such that the output is stable
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].T != keys[j].T {
+			return keys[i].T < keys[j].T
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	exp := &srvtypes.Exported{
+		Version: srvtypes.ExportVersion,
+		Servers: make([]srvtypes.ExportedServer, 0, len(keys)),
+	}
+	lc := c.cfg.V3.LastChosen
+	for _, k := range keys {
+		srv := c.cfg.V3.List[k]
+		es := srvtypes.ExportedServer{
+			Type:        k.T,
+			Identifier:  k.ID,
+			ProfileID:   srv.Profiles.Current,
+			CountryCode: srv.CountryCode,
+			Current:     lc != nil && *lc == k,
+		}
+		if withTokens {
+			tok, err := c.retrieveTokens(k.ID, k.T)
+			if err == nil {
+				es.Tokens = &srvtypes.Tokens{
+					Access:  tok.Access,
+					Refresh: tok.Refresh,
+					Expires: tok.ExpiredTimestamp.Unix(),
+				}
+			} else {
+				log.Logger.Debugf("no tokens to export for server: '%s', with error: %v", k.ID, err)
+			}
+		}
+		exp.Servers = append(exp.Servers, es)
+	}
+	return exp, nil
+}
+
+// validateExported validates the exported server `es` and returns its key
+// Institute access and secure internet servers must be in discovery
+func (c *Client) validateExported(es srvtypes.ExportedServer) (*v3.ServerKey, error) {
+	disco := c.cfg.Discovery()
+	id := es.Identifier
+	switch es.Type {
+	case srvtypes.TypeInstituteAccess, srvtypes.TypeCustom:
+		var err error
+		id, err = http.EnsureValidURL(id, true)
+		if err != nil {
+			return nil, err
+		}
+		if es.CountryCode != "" {
+			return nil, errors.New("a country code is only valid for a secure internet server")
+		}
+		if es.Type == srvtypes.TypeInstituteAccess {
+			if !c.hasDiscovery() {
+				return nil, errors.New("institute access servers are not supported with this client ID")
+			}
+			if _, err = disco.ServerByURL(id, "institute_access"); err != nil {
+				return nil, err
+			}
+		}
+	case srvtypes.TypeSecureInternet:
+		if !c.hasDiscovery() {
+			return nil, errors.New("secure internet servers are not supported with this client ID")
+		}
+		if _, _, err := disco.SecureHomeArgs(id); err != nil {
+			return nil, err
+		}
+		if es.CountryCode != "" {
+			if _, err := disco.ServerByCountryCode(es.CountryCode); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid server type: %d", es.Type)
+	}
+	return &v3.ServerKey{T: es.Type, ID: id}, nil
+}
+
+// ImportServers imports the servers from the exported document `exp`
+// If `replace` is true, all current servers are removed first, otherwise the servers are merged with the current ones
+// All servers are validated before anything is changed, institute access and secure internet servers must be in discovery
+func (c *Client) ImportServers(ck *cookie.Cookie, exp *srvtypes.Exported, replace bool) error {
+	if exp == nil {
+		return i18nerr.NewInternal("No server list was given to import")
+	}
+	if exp.Version < 1 || exp.Version > srvtypes.ExportVersion {
+		return i18nerr.Newf("The server list has version: %d, which is not supported", exp.Version)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// make sure discovery is up to date for validation, the cached version is used if this fails
+	if c.hasDiscovery() {
+		if _, err := c.cfg.Discovery().Organizations(ck.Context()); err != nil {
+			log.Logger.Debugf("failed to update discovery organizations for importing: %v", err)
+		}
+		if _, err := c.cfg.Discovery().Servers(ck.Context()); err != nil {
+			log.Logger.Debugf("failed to update discovery servers for importing: %v", err)
+		}
+	}
+
+	keys := make([]v3.ServerKey, len(exp.Servers))
+	seen := make(map[v3.ServerKey]bool)
+	var secure *v3.ServerKey
+	var current *v3.ServerKey
+	for i, es := range exp.Servers {
+		k, err := c.validateExported(es)
+		if err != nil {
+			return i18nerr.Wrapf(err, "The server: '%s' in the server list is not valid", es.Identifier)
+		}
+		if seen[*k] {
+			return i18nerr.Newf("The server: '%s' is in the server list more than once", es.Identifier)
+		}
+		seen[*k] = true
+		if k.T == srvtypes.TypeSecureInternet {
+			if secure != nil {
+				return i18nerr.New("The server list contains more than one secure internet server")
+			}
+			secure = k
+		}
+		if es.Current {
+			if current != nil {
+				return i18nerr.New("The server list contains more than one current server")
+			}
+			current = k
+		}
+		keys[i] = *k
+	}
+
+	cfg := c.cfg.V3
+	for k := range cfg.List {
+		// remove all servers when replacing, when merging only another secure internet server is removed
+		if !replace && (secure == nil || k.T != srvtypes.TypeSecureInternet || k == *secure) {
+			continue
+		}
+		if err := cfg.RemoveServer(k.ID, k.T); err != nil {
+			return i18nerr.WrapInternalf(err, "The server: '%s' could not be removed", k.ID)
+		}
+		if err := c.tokenStore().Delete(k.ID, k.T); err != nil {
+			log.Logger.Warningf("failed to delete tokens from the token store with error: %v", err)
+		}
+	}
+
+	for i, es := range exp.Servers {
+		k := keys[i]
+		srv, err := cfg.GetServer(k.ID, k.T)
+		if err != nil {
+			// a new server, set the authorize time like when adding a server
+			if err = cfg.AddServer(k.ID, k.T, v3.Server{Base: v3.Base{LastAuthorizeTime: time.Now()}}); err != nil {
+				return i18nerr.WrapInternalf(err, "The server: '%s' could not be added", k.ID)
+			}
+			srv, err = cfg.GetServer(k.ID, k.T)
+			if err != nil {
+				return i18nerr.WrapInternalf(err, "The server: '%s' could not be found after adding", k.ID)
+			}
+		}
+		if es.ProfileID != "" {
+			srv.Profiles.Current = es.ProfileID
+		}
+		if es.CountryCode != "" {
+			srv.CountryCode = es.CountryCode
+		}
+		if es.Tokens != nil {
+			c.TokensUpdated(k.ID, k.T, eduoauth.Token{
+				Access:           es.Tokens.Access,
+				Refresh:          es.Tokens.Refresh,
+				ExpiredTimestamp: time.Unix(es.Tokens.Expires, 0),
+			})
+		}
+	}
+	if current != nil {
+		cfg.LastChosen = current
+	}
+	c.TrySave()
+	return nil
+}
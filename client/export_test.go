@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/types/cookie"
+	"github.com/eduvpn/eduvpn-common/types/protocol"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+	"github.com/jwijenbergh/eduoauth-go"
+)
+
+func newTestClient(t *testing.T) *Client {
+	c, err := New(
+		"org.letsconnect-vpn.app.linux",
+		"0.1.0-test",
+		t.TempDir(),
+		func(_ FSMStateID, _ FSMStateID, _ interface{}) bool {
+			return true
+		},
+		false,
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(c.Deregister)
+	return c
+}
+
+func TestExportImport(t *testing.T) {
+	ck := cookie.NewWithContext(context.Background())
+	defer ck.Cancel() //nolint:errcheck
+
+	c := newTestClient(t)
+	in := &srvtypes.Exported{
+		Version: srvtypes.ExportVersion,
+		Servers: []srvtypes.ExportedServer{
+			{
+				Type:       srvtypes.TypeCustom,
+				Identifier: "https://b.example.com/",
+				ProfileID:  "internet",
+				Current:    true,
+				Tokens: &srvtypes.Tokens{
+					Access:  "access",
+					Refresh: "refresh",
+					Expires: 1700000000,
+				},
+			},
+			{
+				Type:       srvtypes.TypeCustom,
+				Identifier: "https://a.example.com/",
+			},
+		},
+	}
+	if err := c.ImportServers(ck, in, false); err != nil {
+		t.Fatalf("failed to import servers: %v", err)
+	}
+
+	// without tokens the tokens are omitted and the output is sorted
+	got, err := c.ExportServers(false)
+	if err != nil {
+		t.Fatalf("failed to export servers: %v", err)
+	}
+	want := &srvtypes.Exported{
+		Version: srvtypes.ExportVersion,
+		Servers: []srvtypes.ExportedServer{in.Servers[1], in.Servers[0]},
+	}
+	want.Servers[1].Tokens = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("exported servers not equal, got: %v, want: %v", got, want)
+	}
+
+	got, err = c.ExportServers(true)
+	if err != nil {
+		t.Fatalf("failed to export servers with tokens: %v", err)
+	}
+	if !reflect.DeepEqual(got.Servers[1].Tokens, in.Servers[0].Tokens) {
+		t.Fatalf("exported tokens not equal, got: %v, want: %v", got.Servers[1].Tokens, in.Servers[0].Tokens)
+	}
+
+	// importing into a new client with replace gives the same state
+	c2 := newTestClient(t)
+	err = c2.tokStore.Set("https://c.example.com/", srvtypes.TypeCustom, eduoauth.Token{Access: "c"})
+	if err != nil {
+		t.Fatalf("failed to set tokens: %v", err)
+	}
+	if err = c2.ImportServers(ck, &srvtypes.Exported{
+		Version: srvtypes.ExportVersion,
+		Servers: []srvtypes.ExportedServer{{Type: srvtypes.TypeCustom, Identifier: "https://c.example.com/"}},
+	}, false); err != nil {
+		t.Fatalf("failed to import servers: %v", err)
+	}
+	if err = c2.ImportServers(ck, got, true); err != nil {
+		t.Fatalf("failed to import servers with replace: %v", err)
+	}
+	got2, err := c2.ExportServers(true)
+	if err != nil {
+		t.Fatalf("failed to export servers: %v", err)
+	}
+	if !reflect.DeepEqual(got, got2) {
+		t.Fatalf("exported servers not equal after import, got: %v, want: %v", got2, got)
+	}
+	if _, err = c2.tokStore.Get("https://c.example.com/", srvtypes.TypeCustom); err == nil {
+		t.Fatalf("tokens of a replaced server were not removed")
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	ck := cookie.NewWithContext(context.Background())
+	defer ck.Cancel() //nolint:errcheck
+
+	cases := []struct {
+		exp     *srvtypes.Exported
+		wantErr string
+	}{
+		{
+			exp:     &srvtypes.Exported{Version: 2},
+			wantErr: "The server list has version: 2, which is not supported",
+		},
+		{
+			exp: &srvtypes.Exported{
+				Version: 1,
+				Servers: []srvtypes.ExportedServer{
+					{Type: srvtypes.TypeInstituteAccess, Identifier: "https://a.example.com/"},
+				},
+			},
+			wantErr: "The server: 'https://a.example.com/' in the server list is not valid with cause: institute access servers are not supported with this client ID",
+		},
+		{
+			exp: &srvtypes.Exported{
+				Version: 1,
+				Servers: []srvtypes.ExportedServer{
+					{Type: srvtypes.TypeCustom, Identifier: "https://a.example.com/"},
+					{Type: srvtypes.TypeCustom, Identifier: "a.example.com"},
+				},
+			},
+			wantErr: "The server: 'a.example.com' is in the server list more than once",
+		},
+	}
+
+	c := newTestClient(t)
+	for _, v := range cases {
+		err := c.ImportServers(ck, v.exp, false)
+		if err == nil || err.Error() != v.wantErr {
+			t.Fatalf("errors not equal, got: %v, want: %v", err, v.wantErr)
+		}
+		if len(c.cfg.V3.List) != 0 {
+			t.Fatalf("servers were added for an invalid import: %v", c.cfg.V3.List)
+		}
+	}
+}
+
+func TestProtocolPreference(t *testing.T) {
+	ck := cookie.NewWithContext(context.Background())
+	defer ck.Cancel() //nolint:errcheck
+
+	c := newTestClient(t)
+	if err := c.SetProtocolPreference(protocol.PreferenceOnlyWireGuard); err != nil {
+		t.Fatalf("failed to set protocol preference: %v", err)
+	}
+	if c.Servers.Preference != protocol.PreferenceOnlyWireGuard {
+		t.Fatalf("protocol preference not equal, got: %v, want: %v", c.Servers.Preference, protocol.PreferenceOnlyWireGuard)
+	}
+	err := c.SetProtocolPreference(5)
+	if err == nil || err.Error() != "An internal error occurred with cause: Unknown protocol preference: 5" {
+		t.Fatalf("expected an unknown preference error, got: %v", err)
+	}
+
+	err = c.SetServerProtocolPreference("https://a.example.com/", srvtypes.TypeCustom, protocol.PreferenceOpenVPN)
+	if err == nil {
+		t.Fatalf("expected an error when setting the preference for a server that does not exist")
+	}
+	if err = c.ImportServers(ck, &srvtypes.Exported{
+		Version: srvtypes.ExportVersion,
+		Servers: []srvtypes.ExportedServer{{Type: srvtypes.TypeCustom, Identifier: "https://a.example.com/"}},
+	}, false); err != nil {
+		t.Fatalf("failed to import servers: %v", err)
+	}
+	if err = c.SetServerProtocolPreference("a.example.com", srvtypes.TypeCustom, protocol.PreferenceOpenVPN); err != nil {
+		t.Fatalf("failed to set server protocol preference: %v", err)
+	}
+	srv, err := c.Servers.GetServer("https://a.example.com/", srvtypes.TypeCustom)
+	if err != nil {
+		t.Fatalf("failed to get server: %v", err)
+	}
+	if srv.Preferences.Protocol != protocol.PreferenceOpenVPN {
+		t.Fatalf("server protocol preference not equal, got: %v, want: %v", srv.Preferences.Protocol, protocol.PreferenceOpenVPN)
+	}
+}
@@ -17,8 +17,22 @@ type (
 	FSMState = fsm.State
 	// FSMTransition is an alias to the fsm transition type
 	FSMTransition = fsm.Transition
+	// FSMHistoryEntry is an alias to a transition in the fsm history
+	FSMHistoryEntry = fsm.HistoryEntry
+	// FSMGraphFormat is an alias to the format of a graph of the fsm
+	FSMGraphFormat = fsm.GraphFormat
 )
 
+const (
+	// FSMGraphMermaid is a graph that can be converted by the mermaid.js tool
+	FSMGraphMermaid = fsm.GraphMermaid
+	// FSMGraphDOT is a graph in the Graphviz DOT language
+	FSMGraphDOT = fsm.GraphDOT
+)
+
+// debugHistorySize is the size of the transition history when debugging is enabled
+const debugHistorySize = 50
+
 const (
 	// StateDeregistered is the state where we are deregistered
 	StateDeregistered FSMStateID = iota
@@ -55,6 +69,10 @@ const (
 
 	// StateDisconnected is the state where the VPN is disconnected
 	StateDisconnected
+
+	// StateOAuthDeviceStarted is the state where the OAuth device authorization grant is started
+	// The client should show the verification URI and the user code
+	StateOAuthDeviceStarted
 )
 
 // GetStateName gets the State name for state `s`
@@ -84,6 +102,8 @@ func GetStateName(s FSMStateID) string {
 		return "Disconnecting"
 	case StateDisconnected:
 		return "Disconnected"
+	case StateOAuthDeviceStarted:
+		return "OAuthDeviceStarted"
 	default:
 		panic(fmt.Sprintf("unknown conversion of state: %d to string", s))
 	}
@@ -91,8 +111,6 @@ func GetStateName(s FSMStateID) string {
 
 func newFSM(
 	callback func(FSMStateID, FSMStateID, interface{}) bool,
-	directory string,
-	debug bool,
 ) fsm.FSM {
 	states := FSMStates{
 		StateDeregistered: FSMState{
@@ -111,6 +129,7 @@ func newFSM(
 		StateAddingServer: FSMState{
 			Transitions: []FSMTransition{
 				{To: StateOAuthStarted, Description: "Authorize"},
+				{To: StateOAuthDeviceStarted, Description: "Authorize with a device code"},
 			},
 		},
 		StateOAuthStarted: FSMState{
@@ -118,12 +137,18 @@ func newFSM(
 				{To: StateMain, Description: "Authorized"},
 			},
 		},
+		StateOAuthDeviceStarted: FSMState{
+			Transitions: []FSMTransition{
+				{To: StateMain, Description: "Authorized"},
+			},
+		},
 		StateGettingConfig: FSMState{
 			Transitions: []FSMTransition{
 				{To: StateAskLocation, Description: "Invalid location"},
 				{To: StateAskProfile, Description: "Invalid or no profile"},
 				{To: StateGotConfig, Description: "Successfully got a configuration"},
 				{To: StateOAuthStarted, Description: "Authorize"},
+				{To: StateOAuthDeviceStarted, Description: "Authorize with a device code"},
 			},
 		},
 		StateAskLocation: FSMState{
@@ -163,11 +188,12 @@ func newFSM(
 			Transitions: []FSMTransition{
 				{To: StateGettingConfig, Description: "Connect again"},
 				{To: StateOAuthStarted, Description: "Renew"},
+				{To: StateOAuthDeviceStarted, Description: "Renew with a device code"},
 			},
 		},
 	}
 	returnedFSM := fsm.FSM{}
-	returnedFSM.Init(StateMain, states, callback, directory, GetStateName, debug)
+	returnedFSM.Init(StateMain, states, callback, GetStateName)
 	return returnedFSM
 }
 
@@ -185,9 +211,35 @@ func (c *Client) SetState(state FSMStateID) error {
 		}
 		return i18nerr.WrapInternalf(err, "Failed internal state transition requested by the client from: '%s' to '%s'", GetStateName(curr), GetStateName(state))
 	}
+	c.updateExpiry(state)
 	return nil
 }
 
+// SetTransitionHistory sets the maximum number of state transitions that are recorded to `size`
+// A size of zero disables recording the transitions, this is the default unless debugging is enabled
+// The transitions that were recorded before are removed
+func (c *Client) SetTransitionHistory(size int) {
+	c.FSM.SetHistorySize(size)
+}
+
+// TransitionHistory returns the recorded state transitions with the oldest first
+// It does not wait for a transition that is in progress, such that it can be used to debug a client that seems stuck
+func (c *Client) TransitionHistory() []FSMHistoryEntry {
+	return c.FSM.History()
+}
+
+// StateGraph returns a graph of the state machine in format `format`
+// The current state and the transitions in the history, see SetTransitionHistory, are highlighted
+func (c *Client) StateGraph(format FSMGraphFormat) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, err := c.FSM.GenerateGraph(format)
+	if err != nil {
+		return "", i18nerr.WrapInternal(err, "The state graph could not be generated")
+	}
+	return g, nil
+}
+
 // InState returns whether or not the client is in state `state`
 func (c *Client) InState(state FSMStateID) bool {
 	c.mu.Lock()
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"github.com/eduvpn/eduvpn-common/i18nerr"
+	"github.com/eduvpn/eduvpn-common/internal/log"
+)
+
+// LogFormat is an alias to the format of the log
+type LogFormat = log.Format
+
+const (
+	// LogText writes a line of text for each log entry, this is the default
+	LogText = log.FormatText
+	// LogJSON writes a JSON object with the time, level, component and message on a single line for each log entry
+	LogJSON = log.FormatJSON
+)
+
+// LogLevel is an alias to the level of the log
+type LogLevel = log.Level
+
+const (
+	// LogNotSet removes the level of a component such that the default level is used
+	LogNotSet = log.LevelNotSet
+	// LogDebug logs everything
+	LogDebug = log.LevelDebug
+	// LogInfo logs informational messages and everything above
+	LogInfo = log.LevelInfo
+	// LogWarning logs warnings and everything above, this is the default if the client is not registered with debugging
+	LogWarning = log.LevelWarning
+	// LogError logs errors and everything above
+	LogError = log.LevelError
+	// LogFatal logs only fatal errors
+	LogFatal = log.LevelFatal
+)
+
+// LogComponents are the components of which the log level can be set
+var LogComponents = log.Components
+
+// SetLogLevel sets the log level `lvl` of component `component` at runtime, e.g. to only debug discovery
+// An empty component sets the default level for all components that have no level of their own
+// LogNotSet removes the level of a component such that it uses the default level again
+func (c *Client) SetLogLevel(component string, lvl LogLevel) error {
+	var err error
+	if component == "" {
+		err = log.Logger.SetLevel(lvl)
+	} else {
+		err = log.Logger.SetComponentLevel(component, lvl)
+	}
+	if err != nil {
+		return i18nerr.WrapInternalf(err, "The log level: '%d' could not be set for component: '%s'", lvl, component)
+	}
+	log.Logger.Infof("log level set to: %v for component: '%s'", lvl, component)
+	return nil
+}
+
+// SetLogFormat sets the format `f` of the log that is written to the log file and stdout
+func (c *Client) SetLogFormat(f LogFormat) error {
+	if err := log.Logger.SetFormat(f); err != nil {
+		return i18nerr.WrapInternal(err, "The log format could not be set")
+	}
+	return nil
+}
+
+// SetLogRotation sets that the log file is rotated when it becomes larger than `maxSize` bytes and that `maxFiles` rotated files are kept
+// A `maxSize` of zero disables rotation
+func (c *Client) SetLogRotation(maxSize int64, maxFiles int) error {
+	if err := log.Logger.SetRotation(maxSize, maxFiles); err != nil {
+		return i18nerr.WrapInternal(err, "The log rotation could not be set")
+	}
+	return nil
+}
@@ -8,9 +8,23 @@ import (
 	"github.com/jwijenbergh/eduoauth-go"
 )
 
+// TokenStore is the interface that stores OAuth tokens for servers
+// It is used by the client for retrieving tokens and for saving updated tokens
+type TokenStore interface {
+	// Get gets the tokens for the server with id `id` and type `t`
+	// It returns an error if no tokens are found
+	Get(id string, t srvtypes.Type) (*eduoauth.Token, error)
+	// Set sets the tokens `tok` for the server with id `id` and type `t`
+	Set(id string, t srvtypes.Type, tok eduoauth.Token) error
+	// Delete deletes the tokens for the server with id `id` and type `t`
+	// It is a no-op if no tokens exist
+	Delete(id string, t srvtypes.Type) error
+}
+
 type cacheMap map[string]eduoauth.Token
 
 // TokenCacher is a structure that caches tokens for each type of server
+// It is the in-memory TokenStore that is used by default
 type TokenCacher struct {
 	// InstituteAccess is the cached map for institute access servers
 	InstituteAccess cacheMap
@@ -70,3 +84,27 @@ func (tc *TokenCacher) Set(id string, t srvtypes.Type, tok eduoauth.Token) error
 	}
 	return fmt.Errorf("invalid type for token cacher set: %d", t)
 }
+
+// Delete deletes the tokens for server id `id` from the cache map
+func (c *cacheMap) Delete(id string) {
+	if c == nil || *c == nil {
+		return
+	}
+	delete(*c, id)
+}
+
+// Delete deletes the tokens for a specific server type from the top-level cacher
+func (tc *TokenCacher) Delete(id string, t srvtypes.Type) error {
+	switch t {
+	case srvtypes.TypeCustom:
+		tc.CustomServer.Delete(id)
+		return nil
+	case srvtypes.TypeInstituteAccess:
+		tc.InstituteAccess.Delete(id)
+		return nil
+	case srvtypes.TypeSecureInternet:
+		tc.SecureInternet = nil
+		return nil
+	}
+	return fmt.Errorf("invalid type for token cacher delete: %d", t)
+}
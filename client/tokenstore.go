@@ -0,0 +1,273 @@
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/internal/util"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+	"github.com/jwijenbergh/eduoauth-go"
+	"golang.org/x/crypto/scrypt"
+)
+
+// tokenFile is the name of the encrypted token file that is stored next to the state file
+const tokenFile = "tokens.enc"
+
+const (
+	// kdfScrypt means the encryption key is derived from a passphrase using scrypt
+	kdfScrypt = "scrypt"
+	// kdfKeyFile means the encryption key is derived from the contents of a key file
+	kdfKeyFile = "keyfile"
+
+	// minKeyFileSize is the minimum size in bytes of a key file
+	minKeyFileSize = 32
+	// saltSize is the size of the random salt in bytes
+	saltSize = 16
+)
+
+// encryptedTokens is the format of the encrypted token file on disk
+type encryptedTokens struct {
+	// Version is the version of the file format
+	Version int `json:"v"`
+	// KDF is the key derivation function that was used, "scrypt" or "keyfile"
+	KDF string `json:"kdf"`
+	// Salt is the salt that is passed to the key derivation function
+	Salt []byte `json:"salt"`
+	// Nonce is the AES-GCM nonce
+	Nonce []byte `json:"nonce"`
+	// Data is the AES-GCM encrypted JSON map of tokens
+	Data []byte `json:"data"`
+}
+
+// FileTokenStore is a TokenStore that saves the tokens encrypted at rest to a file
+// The encryption key is derived from a passphrase or from a key file
+type FileTokenStore struct {
+	// filename is the full path to the encrypted token file
+	filename string
+	// kdf is the key derivation function that is used
+	kdf string
+	// secret is the passphrase or the contents of the key file
+	secret []byte
+
+	// salt is the salt for the current key
+	salt []byte
+	// key is the cached derived key
+	key []byte
+	// tokens is the decrypted token map, loaded lazily
+	tokens map[string]srvtypes.Tokens
+
+	mu sync.Mutex
+}
+
+// NewPassphraseTokenStore creates a new encrypted token store in directory `dir`
+// The encryption key is derived from `passphrase` using scrypt
+func NewPassphraseTokenStore(dir string, passphrase string) (*FileTokenStore, error) {
+	if passphrase == "" {
+		return nil, errors.New("the passphrase for the token store cannot be empty")
+	}
+	return &FileTokenStore{
+		filename: path.Join(dir, tokenFile),
+		kdf:      kdfScrypt,
+		secret:   []byte(passphrase),
+	}, nil
+}
+
+// NewKeyFileTokenStore creates a new encrypted token store in directory `dir`
+// The encryption key is derived from the contents of the file `keyFile`
+// This file must be at least 32 bytes
+func NewKeyFileTokenStore(dir string, keyFile string) (*FileTokenStore, error) {
+	secret, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token store key file: %w", err)
+	}
+	if len(secret) < minKeyFileSize {
+		return nil, fmt.Errorf("the token store key file must be at least %d bytes, got: %d", minKeyFileSize, len(secret))
+	}
+	return &FileTokenStore{
+		filename: path.Join(dir, tokenFile),
+		kdf:      kdfKeyFile,
+		secret:   secret,
+	}, nil
+}
+
+// deriveKey derives an AES-256 key using the salt `salt`
+func (fs *FileTokenStore) deriveKey(salt []byte) ([]byte, error) {
+	switch fs.kdf {
+	case kdfScrypt:
+		return scrypt.Key(fs.secret, salt, 1<<15, 8, 1, 32)
+	case kdfKeyFile:
+		h := sha256.New()
+		h.Write(salt)
+		h.Write(fs.secret)
+		return h.Sum(nil), nil
+	}
+	return nil, fmt.Errorf("unknown key derivation function: '%s'", fs.kdf)
+}
+
+// keyFor returns the key for salt `salt`, using the cached key if the salt is equal
+func (fs *FileTokenStore) keyFor(salt []byte) ([]byte, error) {
+	if fs.key != nil && string(fs.salt) == string(salt) {
+		return fs.key, nil
+	}
+	k, err := fs.deriveKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	fs.salt = salt
+	fs.key = k
+	return k, nil
+}
+
+// load reads and decrypts the token file if it has not been loaded yet
+// A non-existing file results in an empty token map
+func (fs *FileTokenStore) load() error {
+	if fs.tokens != nil {
+		return nil
+	}
+	b, err := os.ReadFile(fs.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		fs.tokens = make(map[string]srvtypes.Tokens)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token file: %w", err)
+	}
+	var et encryptedTokens
+	if err = json.Unmarshal(b, &et); err != nil {
+		return fmt.Errorf("failed to parse token file: %w", err)
+	}
+	if et.KDF != fs.kdf {
+		return fmt.Errorf("token file was encrypted with key derivation: '%s', but the store uses: '%s'", et.KDF, fs.kdf)
+	}
+	k, err := fs.keyFor(et.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(k)
+	if err != nil {
+		return err
+	}
+	plain, err := gcm.Open(nil, et.Nonce, et.Data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt token file, is the passphrase or key file correct?: %w", err)
+	}
+	toks := make(map[string]srvtypes.Tokens)
+	if err = json.Unmarshal(plain, &toks); err != nil {
+		return fmt.Errorf("failed to parse decrypted tokens: %w", err)
+	}
+	fs.tokens = toks
+	return nil
+}
+
+// save encrypts and writes the token map to disk
+func (fs *FileTokenStore) save() error {
+	plain, err := json.Marshal(fs.tokens)
+	if err != nil {
+		return err
+	}
+	salt := fs.salt
+	if salt == nil {
+		salt = make([]byte, saltSize)
+		if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+			return err
+		}
+	}
+	k, err := fs.keyFor(salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(k)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	b, err := json.Marshal(encryptedTokens{
+		Version: 1,
+		KDF:     fs.kdf,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		return err
+	}
+	if err = util.EnsureDirectory(path.Dir(fs.filename)); err != nil {
+		return err
+	}
+	// a crash while writing must not lose all tokens
+	return util.WriteFileAtomic(fs.filename, b)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// storeKey returns the key in the token map for server id `id` and type `t`
+func storeKey(id string, t srvtypes.Type) string {
+	return fmt.Sprintf("%d,%s", t, id)
+}
+
+// Get gets the tokens for the server with id `id` and type `t` from the encrypted file
+func (fs *FileTokenStore) Get(id string, t srvtypes.Type) (*eduoauth.Token, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	v, ok := fs.tokens[storeKey(id, t)]
+	if !ok {
+		return nil, fmt.Errorf("identifier: '%s' does not exist in the token file", id)
+	}
+	return &eduoauth.Token{
+		Access:           v.Access,
+		Refresh:          v.Refresh,
+		ExpiredTimestamp: time.Unix(v.Expires, 0),
+	}, nil
+}
+
+// Set sets the tokens for the server with id `id` and type `t` and writes them encrypted to disk
+func (fs *FileTokenStore) Set(id string, t srvtypes.Type, tok eduoauth.Token) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.load(); err != nil {
+		return err
+	}
+	fs.tokens[storeKey(id, t)] = srvtypes.Tokens{
+		Access:  tok.Access,
+		Refresh: tok.Refresh,
+		Expires: tok.ExpiredTimestamp.Unix(),
+	}
+	return fs.save()
+}
+
+// Delete deletes the tokens for the server with id `id` and type `t` and updates the file on disk
+func (fs *FileTokenStore) Delete(id string, t srvtypes.Type) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.load(); err != nil {
+		return err
+	}
+	k := storeKey(id, t)
+	if _, ok := fs.tokens[k]; !ok {
+		return nil
+	}
+	delete(fs.tokens, k)
+	return fs.save()
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+	"github.com/jwijenbergh/eduoauth-go"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := path.Join(dir, "key")
+	if err := os.WriteFile(keyFile, bytes.Repeat([]byte("k"), minKeyFileSize), 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	stores := map[string]func(string) (*FileTokenStore, error){
+		"passphrase": func(d string) (*FileTokenStore, error) {
+			return NewPassphraseTokenStore(d, "correct horse battery staple")
+		},
+		"keyfile": func(d string) (*FileTokenStore, error) {
+			return NewKeyFileTokenStore(d, keyFile)
+		},
+	}
+
+	tok := eduoauth.Token{
+		Access:           "access",
+		Refresh:          "refresh",
+		ExpiredTimestamp: time.Unix(1700000000, 0),
+	}
+	for name, newStore := range stores {
+		sdir := path.Join(dir, name)
+		ts, err := newStore(sdir)
+		if err != nil {
+			t.Fatalf("[%s] failed to create store: %v", name, err)
+		}
+		if _, err = ts.Get("https://example.com/", srvtypes.TypeCustom); err == nil {
+			t.Fatalf("[%s] got no error for getting tokens from an empty store", name)
+		}
+		if err = ts.Set("https://example.com/", srvtypes.TypeCustom, tok); err != nil {
+			t.Fatalf("[%s] failed to set tokens: %v", name, err)
+		}
+
+		// the tokens must not be saved in plain text
+		b, err := os.ReadFile(path.Join(sdir, tokenFile))
+		if err != nil {
+			t.Fatalf("[%s] failed to read token file: %v", name, err)
+		}
+		if strings.Contains(string(b), "refresh") {
+			t.Fatalf("[%s] token file contains the refresh token in plain text", name)
+		}
+
+		// a new store reads the tokens from disk
+		ts2, err := newStore(sdir)
+		if err != nil {
+			t.Fatalf("[%s] failed to create second store: %v", name, err)
+		}
+		got, err := ts2.Get("https://example.com/", srvtypes.TypeCustom)
+		if err != nil {
+			t.Fatalf("[%s] failed to get tokens: %v", name, err)
+		}
+		if got.Access != tok.Access || got.Refresh != tok.Refresh || !got.ExpiredTimestamp.Equal(tok.ExpiredTimestamp) {
+			t.Fatalf("[%s] tokens not equal, got: %v, want: %v", name, got, tok)
+		}
+
+		if err = ts2.Delete("https://example.com/", srvtypes.TypeCustom); err != nil {
+			t.Fatalf("[%s] failed to delete tokens: %v", name, err)
+		}
+		if _, err = ts2.Get("https://example.com/", srvtypes.TypeCustom); err == nil {
+			t.Fatalf("[%s] got no error for getting deleted tokens", name)
+		}
+	}
+}
+
+func TestFileTokenStoreWrongPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	ts, err := NewPassphraseTokenStore(dir, "right")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if err = ts.Set("org", srvtypes.TypeSecureInternet, eduoauth.Token{Access: "a"}); err != nil {
+		t.Fatalf("failed to set tokens: %v", err)
+	}
+	ts2, err := NewPassphraseTokenStore(dir, "wrong")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	_, err = ts2.Get("org", srvtypes.TypeSecureInternet)
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to decrypt token file") {
+		t.Fatalf("expected a decrypt error with the wrong passphrase, got: %v", err)
+	}
+}
+
+func TestKeyFileTokenStoreTooShort(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := path.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("short"), 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	if _, err := NewKeyFileTokenStore(dir, keyFile); err == nil {
+		t.Fatal("got no error for a too short key file")
+	}
+}
@@ -24,6 +24,8 @@ typedef int (*StateCB)(int oldstate, int newstate, void* data);
 typedef void (*TokenGetter)(const char* server_id, int server_type, char* out, size_t len);
 typedef void (*TokenSetter)(const char* server_id, int server_type, const char* tokens);
 typedef void (*ProxyFD)(int fd);
+typedef void (*LivenessCB)(int health);
+typedef void (*ExpiryCB)(const char* event);
 
 static long long int get_read_rx_bytes(ReadRxBytes read)
 {
@@ -45,6 +47,14 @@ static void call_proxy_fd(ProxyFD proxyfd, int fd)
 {
     proxyfd(fd);
 }
+static void call_liveness_cb(LivenessCB cb, int health)
+{
+    cb(health);
+}
+static void call_expiry_cb(ExpiryCB cb, const char* event)
+{
+    cb(event);
+}
 */
 import "C"
 
@@ -52,20 +62,35 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"math"
+	"os"
 	"runtime/cgo"
+	"time"
 	"unsafe"
 
 	"github.com/eduvpn/eduvpn-common/client"
 	"github.com/eduvpn/eduvpn-common/i18nerr"
 	"github.com/eduvpn/eduvpn-common/internal/log"
 	"github.com/eduvpn/eduvpn-common/types/cookie"
+	discotypes "github.com/eduvpn/eduvpn-common/types/discovery"
 	errtypes "github.com/eduvpn/eduvpn-common/types/error"
+	failovertypes "github.com/eduvpn/eduvpn-common/types/failover"
+	"github.com/eduvpn/eduvpn-common/types/protocol"
 	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
 )
 
 // VPNState is the current state of the library
 var VPNState *client.Client
 
+// int8Enum range-checks `v` before it is converted to an enum that is an int8, such that e.g. 259 does not wrap around to 3
+// `name` is what the value is, this is used in the error
+func int8Enum(v C.int, name string) (int8, error) {
+	if v < math.MinInt8 || v > math.MaxInt8 {
+		return 0, i18nerr.NewInternalf("The %s: '%d' is out of range", name, int(v))
+	}
+	return int8(v), nil
+}
+
 func getCError(err error) *C.char {
 	if err == nil {
 		return nil
@@ -143,7 +168,10 @@ func getVPNState() (*client.Client, error) {
 //
 //   - Log everything in debug mode, so you can get more detail of what is going on
 //
-//   - Write the state graph to a file in the configDirectory. This can be used to create a FSM png file with mermaid https://mermaid.js.org/
+//   - Record the last 50 state transitions, see `TransitionHistory`. These are highlighted in the graph of `StateGraph`
+//
+// The configuration directory is locked while the client is registered, registering fails if another process uses the same directory.
+// If the state file was corrupt, this is reported by `StateRecovered`.
 //
 // After registering, the FSM is initialized and the state transition NO_SERVER should have been completed
 // If some error occurs during registering, it is returned as a types/error/error.go Error
@@ -199,6 +227,38 @@ func Register(
 	return getCError(err)
 }
 
+// StateRecovered returns whether or not the state file could not be loaded normally when registering
+//
+// The state file is written atomically and the last good version is kept as a backup.
+// If the state file cannot be parsed when registering, e.g. due to disk corruption, it is restored from this backup.
+// The state file that cannot be parsed is kept as `state.json.corrupt` in the configuration directory.
+// If there is no usable backup, the client starts without servers and this also returns an error.
+// This also returns an error if the state file was written by a newer version of the library, e.g. after a downgrade.
+// The client then starts without servers and the state file is never overwritten, so changes are not saved.
+// Clients should call this after `Register` and show the error to the user as servers that were added after the backup may be missing.
+//
+// It returns null if the state file was loaded normally, otherwise the error as types/error/error.go Error.
+//
+// Example Input: ```StateRecovered()```
+//
+// Example Output:
+//
+//	{
+//	  "message": {
+//	    "en": "The state file was corrupt and has been restored from a backup, recently added servers may be missing with cause: unexpected end of JSON input"
+//	  },
+//	  "misc": false
+//	}
+//
+//export StateRecovered
+func StateRecovered() *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	return getCError(state.StateRecovered())
+}
+
 // ExpiryTimes gets the expiry times for the current server
 //
 // Expiry times are just fields that represent unix timestamps at which to do certain events regarding expiry,
@@ -240,6 +300,76 @@ func ExpiryTimes() (*C.char, *C.char) {
 	return C.CString(ret), nil
 }
 
+// SetExpiryCallback sets the callback that is called for the VPN expiry events of the current server
+//
+// Instead of calculating timers from `ExpiryTimes`, a client can use this to get notified when to show the renew button,
+// when to start the countdown, when to show a notification and when the VPN has expired.
+// The events are scheduled when the state machine goes to the connected state and they are cancelled when it leaves this state.
+// Events that are already in the past when connecting are sent right away, for notifications only the last one that has passed is sent.
+//
+//   - `cb` is called with the internal/expiry/expiry.go Event marshalled as JSON. The type is: 0=renew button, 1=countdown, 2=notification, 3=expired, 5=renewed.
+//     The time is the unix timestamp of the event and remaining is the number of seconds until the VPN expires. Pass NULL to disable the callback
+//
+// The renewed event is only sent if the configuration is renewed ahead of expiry, see `SetConfigRenewal`.
+// This event has the new configuration in the `config` key, in the same format as `GetConfig`. The client should reconnect using this configuration
+//
+// Example Input: ```SetExpiryCallback(myExpiryHandler)```
+//
+// Example Output: ```null```
+//
+// Example event:
+//
+//	{
+//	  "type": 2,
+//	  "time": 1700000000,
+//	  "remaining": 3600
+//	}
+//
+//export SetExpiryCallback
+func SetExpiryCallback(cb C.ExpiryCB) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	if cb == nil {
+		state.SetExpiryHandler(nil)
+		return nil
+	}
+	state.SetExpiryHandler(func(e client.ExpiryEvent) {
+		ev, err := getReturnData(e)
+		if err != nil {
+			log.Logger.Warningf("failed to marshal the expiry event: %v", err)
+			return
+		}
+		evC := C.CString(ev)
+		C.call_expiry_cb(cb, evC)
+		C.free(unsafe.Pointer(evC))
+	})
+	return nil
+}
+
+// SetConfigRenewal sets how many seconds before the VPN expires a new configuration is obtained without user interaction
+//
+// This avoids that the user has to renew the session and reconnect when the OAuth tokens can still be refreshed.
+// The new configuration is sent to the callback that is set with `SetExpiryCallback` as a renewed event, so the renewal is only done if this callback is set.
+// If the renewal fails, e.g. because the user needs to authorize again, the renew button, countdown and notification events are sent as usual and the client should use `RenewSession`.
+// For WireGuard the key of the previous configuration is reused if the server allows it.
+//
+//   - `seconds` is the number of seconds before expiry to renew the configuration, 0 disables the renewal. This is disabled by default
+//
+// Example Input: ```SetConfigRenewal(3600)```
+//
+// Example Output: ```null```
+//
+//export SetConfigRenewal
+func SetConfigRenewal(seconds C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	return getCError(state.SetConfigRenewal(time.Duration(seconds) * time.Second))
+}
+
 // Deregister cleans up the state for the client.
 //
 // This function SHOULD be called when the application exits such that the configuration file is saved correctly.
@@ -298,6 +428,9 @@ func Deregister() *C.char {
 //     This `url` should also be opened in the browser like desktop platforms. But these platforms also need to reply to the library to give back the full authorization code URI with `CookieReply(x, uri)`.
 //     E.g. `CookieReply(x, "/callback?code=...&state=...&iss=...")` this is the path of the request that the apps get back when the user clicks approve. For this, apps need to register an app url or sorts. For the valid values for app URLs, see the redirect URIs for mobile platforms here https://git.sr.ht/~fkooman/vpn-user-portal/tree/v3/item/src/OAuth/VpnClientDb.php
 //
+//   - OAUTH_DEVICE_STARTED: Instead of OAUTH_STARTED when the device flow is set with `SetAuthFlow`. The data is the JSON `{"user_code": "...", "verification_uri": "...", "verification_uri_complete": "...", "expires_at": 1700000000}`.
+//     The client should show the user code and verification URI so that the user can authorize on another device. eduvpn-common polls for the tokens itself.
+//
 // Example Input (3=custom server):
 // ```AddServer(mycookie, 3, "https://demo.eduvpn.nl", 0)```
 //
@@ -325,6 +458,100 @@ func AddServer(c C.uintptr_t, _type C.int, id *C.char, ni C.int) *C.char {
 	return getCError(err)
 }
 
+// ExportServers exports the list of added servers as a portable JSON document
+//
+// This document can be imported on another machine using `ImportServers`, e.g. to pre-seed laptops.
+//
+// `withTokens`, if non-zero, also exports the OAuth tokens of the servers.
+// These tokens give access to the VPN, so only set this if the document is stored securely.
+//
+// It returns the document as a JSON string defined in types/server/server.go Exported.
+// If the servers cannot be exported it returns a nil string and an error
+//
+// Example Input:
+// ```ExportServers(0)```
+//
+// Example Output:
+//
+//	{
+//	  "v": 1,
+//	  "servers": [
+//	    {
+//	      "server_type": 1,
+//	      "identifier": "https://demo.eduvpn.nl/",
+//	      "profile_id": "internet",
+//	      "current": true
+//	    },
+//	    {
+//	      "server_type": 2,
+//	      "identifier": "https://idp.geant.org",
+//	      "country_code": "nl"
+//	    }
+//	  ]
+//	}, null
+//
+//export ExportServers
+func ExportServers(withTokens C.int) (*C.char, *C.char) {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return nil, getCError(stateErr)
+	}
+	exp, err := state.ExportServers(withTokens != 0)
+	if err != nil {
+		return nil, getCError(err)
+	}
+	ret, err := getReturnData(exp)
+	if err != nil {
+		return nil, getCError(err)
+	}
+	return C.CString(ret), nil
+}
+
+// ImportServers imports a list of servers that was exported with `ExportServers`
+//
+// `c` is the cookie that is used for cancellation, discovery is updated to validate the servers.
+//
+// `data` is the JSON document defined in types/server/server.go Exported.
+//
+// `replace`, if non-zero, removes all current servers first. Otherwise the servers are merged with the current ones.
+// When merging, an existing secure internet server is replaced if the document contains a different one.
+//
+// All servers are validated before anything is changed.
+// Institute access and secure internet servers must be in discovery.
+// No state transitions happen, tokens that are in the document are passed to the token setter.
+//
+// If the servers cannot be imported it returns the error as types/error/error.go Error.
+//
+// Example Input:
+// ```ImportServers(myCookie, "{\"v\": 1, \"servers\": [{\"server_type\": 3, \"identifier\": \"https://vpn.example.com/\"}]}", 0)```
+//
+// Example Output:
+//
+//	{
+//	  "message": {
+//	    "en": "The server list has version: 2, which is not supported"
+//	  },
+//	  "misc": false
+//	}
+//
+//export ImportServers
+func ImportServers(c C.uintptr_t, data *C.char, replace C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	ck, err := getCookie(c)
+	if err != nil {
+		return getCError(err)
+	}
+	var exp srvtypes.Exported
+	if err = json.Unmarshal([]byte(C.GoString(data)), &exp); err != nil {
+		return getCError(i18nerr.Wrap(err, "The server list could not be parsed"))
+	}
+	err = state.ImportServers(ck, &exp, replace != 0)
+	return getCError(err)
+}
+
 // RemoveServer removes a server from the eduvpn-common server list
 //
 // `_type` is the type of server that needs to be added. This type is defined in types/server/server.go Type
@@ -386,18 +613,30 @@ func RemoveServer(_type C.int, id *C.char) *C.char {
 //	          "display_name": {
 //	            "en": "Internet"
 //	          },
-//	          "supported_protocols": [
-//	            1,
-//	            2
+//	          "default_gateway": true,
+//	          "vpn_proto_list": [
+//	            "openvpn",
+//	            "wireguard"
+//	          ],
+//	          "vpn_proto_transport_list": [
+//	            "openvpn+udp",
+//	            "openvpn+tcp",
+//	            "wireguard+udp"
 //	          ]
 //	        },
 //	        "internet-split": {
 //	          "display_name": {
 //	            "en": "No rfc1918 routes"
 //	          },
-//	          "supported_protocols": [
-//	            1,
-//	            2
+//	          "default_gateway": false,
+//	          "vpn_proto_list": [
+//	            "openvpn",
+//	            "wireguard"
+//	          ],
+//	          "vpn_proto_transport_list": [
+//	            "openvpn+udp",
+//	            "openvpn+tcp",
+//	            "wireguard+udp"
 //	          ]
 //	        }
 //	      },
@@ -552,6 +791,9 @@ func ServerList() (*C.char, *C.char) {
 //     This `url` should also be opened in the browser like desktop platforms. But these platforms also need to reply to the library to give back the full authorization code URI with `CookieReply(x, uri)`.
 //     E.g. `CookieReply(x, "/callback?code=...&state=...&iss=...")` this is the path of the request that the apps get back when the user clicks approve. For this, apps need to register an app url or sorts. For the valid values for app URLs, see the redirect URIs for mobile platforms here https://git.sr.ht/~fkooman/vpn-user-portal/tree/v3/item/src/OAuth/VpnClientDb.php
 //
+//   - OAUTH_DEVICE_STARTED: Instead of OAUTH_STARTED when the device flow is set with `SetAuthFlow`. The data is the JSON `{"user_code": "...", "verification_uri": "...", "verification_uri_complete": "...", "expires_at": 1700000000}`.
+//     The client should show the user code and verification URI so that the user can authorize on another device. eduvpn-common polls for the tokens itself.
+//
 // The client should open the webbrowser with this URL and continue the authorization process.
 // This is only called if authorization needs to be retriggered
 //
@@ -565,6 +807,27 @@ func ServerList() (*C.char, *C.char) {
 //	 "protocol": 2,
 //	 "default_gateway": true,
 //	 "should_failover": true, <- whether or not the failover procedure should happen
+//	 "wireguard": { <- the same WireGuard config but parsed, see types/server/server.go WireGuardConfig
+//	   "interface": {"private_key": "...", "addresses": ["10.0.0.2/24", "fd00::2/64"], "dns": ["9.9.9.9"]},
+//	   "peers": [{"public_key": "...", "allowed_ips": ["0.0.0.0/0", "::/0"], "endpoint": "..."}]
+//	 }
+//	}
+//
+// Example Output (1=OpenVPN):
+//
+//	{
+//	 "config": "dev tun\nclient\n...\nremote ... 1194 udp\nremote ... 1194 tcp\nscript-security 0", <- hardened, e.g. script and plugin directives are removed or rejected
+//	 "protocol": 1,
+//	 "default_gateway": true,
+//	 "should_failover": false,
+//	 "openvpn": { <- a structured view of the OpenVPN config, see types/server/server.go OpenVPNConfig
+//	   "remotes": [{"host": "...", "port": 1194, "protocol": "udp"}, {"host": "...", "port": 1194, "protocol": "tcp"}],
+//	   "protocols": ["udp", "tcp"],
+//	   "ciphers": ["AES-256-GCM"]
+//	 },
+//	 "expires": 1700000000, <- the Unix timestamp of the "Expires" header
+//	 "certificate_expires": 1700000000, <- the Unix timestamp when the inline client certificate expires
+//	 "expiry_mismatch": false <- true if the two expiry times differ too much, e.g. due to clock skew
 //	}
 //
 // Example Output (3=WireGuard + Proxyguard):
@@ -574,7 +837,8 @@ func ServerList() (*C.char, *C.char) {
 //	"protocol":3,
 //	"default_gateway":true,
 //	"should_failover":true,
-//	"proxy":{"source_port":38683,"listen":"127.0.0.1:59812","peer":"https://..."}
+//	"proxy":{"source_port":38683,"listen":"127.0.0.1:59812","peer":"https://..."},
+//	"wireguard":{"interface":{...},"peers":[{...,"endpoint":"127.0.0.1:x"}]}
 //	}
 //
 //export GetConfig
@@ -710,6 +974,87 @@ func DiscoServers(c C.uintptr_t) (*C.char, *C.char) {
 	return C.CString(s), getCError(err)
 }
 
+// DiscoSearch searches the discovery organizations and servers, returned as types/discovery/discovery.go SearchResults marshalled as JSON
+//
+// The display names and keywords in all languages are matched, ignoring case and accents.
+// Every word of the query must match. The results are sorted by their score from high to low.
+// This does not contact the discovery server, so it is fast enough to call on every keystroke.
+// Call `DiscoOrganizations` and `DiscoServers` first to make sure the lists are up to date.
+//
+//   - `query` is the search query that the user typed
+//
+//   - `_type` filters the results: 0 (unknown) gives both, 1 (institute access) gives only servers, 2 (secure internet) gives only organizations with a secure internet home
+//
+// If it was unsuccessful, it returns an error.
+//
+// Example Input: ```DiscoSearch("univ amsterdam", 0)```
+//
+// Example Output:
+//
+//	{
+//	 "organizations": [
+//	   {
+//	     "display_name": {
+//	       "en": "University of Amsterdam",
+//	       "nl": "Universiteit van Amsterdam"
+//	     },
+//	     "org_id": "http://www.uva.nl/",
+//	     "secure_internet_home": "https://nl.eduvpn.org/",
+//	     "score": 170
+//	   }
+//	 ]
+//	}, null
+//
+//export DiscoSearch
+func DiscoSearch(query *C.char, _type C.int) (*C.char, *C.char) {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return nil, getCError(stateErr)
+	}
+	t, err := int8Enum(_type, "server type")
+	if err != nil {
+		return nil, getCError(err)
+	}
+	res, err := state.DiscoSearch(C.GoString(query), srvtypes.Type(t))
+	if err != nil {
+		return nil, getCError(err)
+	}
+	s, err := getReturnData(res)
+	if err != nil {
+		return nil, getCError(err)
+	}
+	return C.CString(s), nil
+}
+
+// SetDiscoveryConfig sets the discovery source, e.g. a private discovery mirror signed with an own minisign key
+//
+// The configuration is saved in the state file. The cached discovery lists are removed, so call `DiscoOrganizations` and `DiscoServers` again afterwards.
+//
+//   - `config` is the types/discovery/discovery.go Config marshalled as JSON.
+//     An empty "url" means the default of https://disco.eduvpn.org/v2/ and empty "keys" mean the keys of disco.eduvpn.org.
+//     An empty string or `{}` resets the configuration to the defaults
+//
+// It returns an error when the URL or one of the public keys is invalid or when discovery is not supported with the client ID.
+//
+// Example Input: ```SetDiscoveryConfig("{\"url\": \"https://disco.example.com/v2/\", \"keys\": [\"RWRtBSX1alxyGX+Xn3LuZnWUT0w//B6EmTJvgaAxBMYzlQeI+jdrO6KF\"], \"force_prehash\": true}")```
+//
+// Example Output: ```null```
+//
+//export SetDiscoveryConfig
+func SetDiscoveryConfig(config *C.char) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	var cfg discotypes.Config
+	if j := C.GoString(config); j != "" {
+		if err := json.Unmarshal([]byte(j), &cfg); err != nil {
+			return getCError(i18nerr.WrapInternal(err, "The discovery configuration is not valid JSON"))
+		}
+	}
+	return getCError(state.SetDiscoveryConfig(cfg))
+}
+
 // DiscoOrganizations gets the organizations from discovery, returned as types/discovery/discovery.go Organizations marshalled as JSON
 //
 // `c` is the Cookie that needs to be passed. Create a new Cookie using `CookieNew`
@@ -853,6 +1198,17 @@ func SetSupportWireguard(support C.int) *C.char {
 	return nil
 }
 
+// getProbe parses the failover probe JSON, an empty string gives the default ICMP probe
+func getProbe(probe *C.char) (failovertypes.Probe, error) {
+	var p failovertypes.Probe
+	if j := C.GoString(probe); j != "" {
+		if err := json.Unmarshal([]byte(j), &p); err != nil {
+			return p, i18nerr.WrapInternal(err, "The failover probe is not valid JSON")
+		}
+	}
+	return p, nil
+}
+
 // StartFailover starts the 'failover' procedure in eduvpn-common
 //
 // Failover has one primary goal: check if the VPN can reach the gateway.
@@ -860,18 +1216,54 @@ func SetSupportWireguard(support C.int) *C.char {
 // Which is useful to go from a broken WireGuard connection to OpenVPN over TCP
 //
 //   - `c` is the cookie that is passed for cancellation. To create a cookie, use the `CookieNew` function
-//   - `gateway` is the gateway IP of the VPN
+//   - `gateway` is the gateway IP of the VPN, this can be an IPv4 or an IPv6 address
+//   - `mtu` is the MTU of the VPN, this is used as the size of the ICMP probes
 //   - `readRxBytes` is a function that returns the current rx bytes of the VPN interface, this should return a `long long int` in c
 //
 // It returns a boolean whether or not the common lib has determined that it cannot reach the gateway. Non-zero=dropped, zero=not dropped.
 // It also returns an error, if it fails to indicate if it has dropped or not. In this case, dropped is also set to zero
 //
+// The gateway is pinged using ICMP, to use another probe see `StartFailoverWithProbe`
+//
 // Example Input: ```StartFailover(myCookie, "10.10.10.1", 1400, myRxBytesReader)```
 //
 // Example Output: ```1, null```
 //
 //export StartFailover
 func StartFailover(c C.uintptr_t, gateway *C.char, mtu C.int, readRxBytes C.ReadRxBytes) (C.int, *C.char) {
+	return startFailover(c, gateway, mtu, failovertypes.Probe{}, readRxBytes)
+}
+
+// StartFailoverWithProbe starts the 'failover' procedure in eduvpn-common with a custom probe
+//
+// This is the same as `StartFailover`, except that the way the gateway is probed can be chosen.
+// As ICMP is filtered by some networks, this can be used to probe the gateway in another way
+//
+//   - `c` is the cookie that is passed for cancellation. To create a cookie, use the `CookieNew` function
+//   - `gateway` is the gateway IP of the VPN, this can be an IPv4 or an IPv6 address
+//   - `mtu` is the MTU of the VPN, this is used as the size of the ICMP and UDP probes
+//   - `probe` is the types/failover/failover.go Probe marshalled as JSON, an empty string means ICMP pings.
+//     A TCP connect (type 1, with "port"), a UDP datagram (type 2, with "port") or a HTTPS HEAD request (type 3, with "url") can be used instead
+//   - `readRxBytes` is a function that returns the current rx bytes of the VPN interface, this should return a `long long int` in c
+//
+// It returns a boolean whether or not the common lib has determined that it cannot reach the gateway. Non-zero=dropped, zero=not dropped.
+// It also returns an error, if it fails to indicate if it has dropped or not. In this case, dropped is also set to zero
+//
+// Example Input: ```StartFailoverWithProbe(myCookie, "10.10.10.1", 1400, "{\"type\": 1, \"port\": 443}", myRxBytesReader)```
+//
+// Example Output: ```1, null```
+//
+//export StartFailoverWithProbe
+func StartFailoverWithProbe(c C.uintptr_t, gateway *C.char, mtu C.int, probe *C.char, readRxBytes C.ReadRxBytes) (C.int, *C.char) {
+	p, err := getProbe(probe)
+	if err != nil {
+		return C.int(0), getCError(err)
+	}
+	return startFailover(c, gateway, mtu, p, readRxBytes)
+}
+
+// startFailover is the implementation of StartFailover and StartFailoverWithProbe using probe `p`
+func startFailover(c C.uintptr_t, gateway *C.char, mtu C.int, p failovertypes.Probe, readRxBytes C.ReadRxBytes) (C.int, *C.char) {
 	state, stateErr := getVPNState()
 	if stateErr != nil {
 		return C.int(0), getCError(stateErr)
@@ -880,7 +1272,7 @@ func StartFailover(c C.uintptr_t, gateway *C.char, mtu C.int, readRxBytes C.Read
 	if err != nil {
 		return C.int(0), getCError(err)
 	}
-	dropped, droppedErr := state.StartFailover(ck, C.GoString(gateway), int(mtu), func() (int64, error) {
+	dropped, droppedErr := state.StartFailover(ck, C.GoString(gateway), int(mtu), p, func() (int64, error) {
 		rxBytes := int64(C.get_read_rx_bytes(readRxBytes))
 		if rxBytes < 0 {
 			return 0, i18nerr.NewInternal("client gave an invalid rx bytes value")
@@ -897,6 +1289,54 @@ func StartFailover(c C.uintptr_t, gateway *C.char, mtu C.int, readRxBytes C.Read
 	return droppedC, nil
 }
 
+// StartLivenessMonitor starts monitoring whether or not the VPN can reach the gateway, until the cookie is cancelled
+//
+// Whereas `StartFailover` is a single check right after connecting, this keeps running for as long as the VPN is connected.
+// This can be used to show in the UI that the tunnel is broken instead of showing that it is connected.
+// Every 2 seconds a probe, by default a ping, is sent to the gateway through the tunnel and the rx bytes are read.
+// If there is no reply and the rx bytes have not increased the connection is degraded, if this happens 5 times in a row the connection is dropped.
+// The monitor keeps running after the connection is dropped, such that it is reported when the connection is healthy again.
+//
+//   - `c` is the cookie that is passed for cancellation. To create a cookie, use the `CookieNew` function
+//   - `gateway` is the gateway IP of the VPN, this can be an IPv4 or an IPv6 address
+//   - `mtu` is the MTU of the VPN, this is used as the size of the ICMP and UDP probes
+//   - `probe` is the types/failover/failover.go Probe marshalled as JSON, an empty string means ICMP pings. See `StartFailoverWithProbe`
+//   - `readRxBytes` is a function that returns the current rx bytes of the VPN interface, this should return a `long long int` in c
+//   - `onEvent` is a function that is called with the health each time it changes, starting with the first check: 0=healthy, 1=degraded, 2=dropped
+//
+// This function blocks, so run it in a separate thread. It returns null when the cookie is cancelled.
+// It returns an error if the monitor could not be started or the rx bytes could not be read.
+//
+// Example Input: ```StartLivenessMonitor(myCookie, "10.10.10.1", 1400, "", myRxBytesReader, myHealthHandler)```
+//
+// Example Output: ```null```
+//
+//export StartLivenessMonitor
+func StartLivenessMonitor(c C.uintptr_t, gateway *C.char, mtu C.int, probe *C.char, readRxBytes C.ReadRxBytes, onEvent C.LivenessCB) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	ck, err := getCookie(c)
+	if err != nil {
+		return getCError(err)
+	}
+	p, err := getProbe(probe)
+	if err != nil {
+		return getCError(err)
+	}
+	err = state.StartLivenessMonitor(ck, C.GoString(gateway), int(mtu), p, func() (int64, error) {
+		rxBytes := int64(C.get_read_rx_bytes(readRxBytes))
+		if rxBytes < 0 {
+			return 0, i18nerr.NewInternal("client gave an invalid rx bytes value")
+		}
+		return rxBytes, nil
+	}, func(h client.Health) {
+		C.call_liveness_cb(onEvent, C.int(h))
+	})
+	return getCError(err)
+}
+
 // StartProxyguard starts the 'proxyguard' procedure in eduvpn-common.
 // This proxies WireGuard UDP connections over HTTP: https://codeberg.org/eduvpn/proxyguard.
 // These input variables can be gotten from the configuration that is retrieved using the `proxy` JSON key
@@ -930,6 +1370,117 @@ func StartProxyguard(c C.uintptr_t, listen *C.char, tcpsp C.int, peer *C.char, p
 	return getCError(proxyErr)
 }
 
+// Diagnostics writes a zip archive to `path` that users can attach to a bug report
+//
+// This can be used for a "copy diagnostics" button instead of asking users for the log file and the state file.
+// Secrets such as OAuth tokens and WireGuard private keys are redacted. The archive contains:
+//
+//   - `info.json`: the library version, the client ID, the current state, the discovery versions and timestamps and the log levels
+//   - `state.json`: the state file without the cached discovery lists
+//   - `log.jsonl`: the last 500 log entries as JSON lines, see `SetLogFormat`
+//   - `transitions.json`: the recorded state transitions, see `TransitionHistory`
+//
+// If the client is busy, e.g. getting a configuration, the current state, the state file and discovery are left out such that this does not block.
+// The file is created with permissions that only allow the current user to read it, an existing file is overwritten.
+//
+// Example Input: ```Diagnostics("/tmp/eduvpn-diagnostics.zip")```
+//
+// Example Output: ```null```
+//
+//export Diagnostics
+func Diagnostics(path *C.char) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	b, err := state.Diagnostics()
+	if err != nil {
+		return getCError(err)
+	}
+	p := C.GoString(path)
+	if err = os.WriteFile(p, b, 0o600); err != nil {
+		return getCError(i18nerr.Wrapf(err, "The diagnostics could not be written to: '%s'", p))
+	}
+	return nil
+}
+
+// SetLogLevel sets the log level of a component at runtime
+//
+// This can be used to debug a single component without registering the client again with debugging enabled.
+//
+//   - `component` is the component to set the level for: "general", "api", "oauth", "discovery", "failover", "proxyguard" or "fsm".
+//     An empty string sets the default level for all components that have no level of their own
+//   - `level` is the level: 1=debug, 2=info, 3=warning, 4=error, 5=fatal.
+//     0 removes the level of the component such that it uses the default level again, this is not allowed for the default level
+//
+// By default the level is warning, or debug if the client was registered with debugging enabled.
+//
+// Example Input: ```SetLogLevel("discovery", 1)```
+//
+// Example Output: ```null```
+//
+//export SetLogLevel
+func SetLogLevel(component *C.char, level C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	lvl, err := int8Enum(level, "log level")
+	if err != nil {
+		return getCError(err)
+	}
+	return getCError(state.SetLogLevel(C.GoString(component), client.LogLevel(lvl)))
+}
+
+// SetLogFormat sets the format of the log that is written to the log file in the config directory and to stdout
+//
+//   - `format` is 0 for a line of text for each entry, this is the default, and 1 for JSON lines.
+//     In the JSON format each line is an internal/log/log.go Entry with the time, level, component and message
+//
+// OAuth tokens, the authorization code and state parameters and WireGuard private keys are redacted in both formats.
+//
+// Example Input: ```SetLogFormat(1)```
+//
+// Example Output: ```null```
+//
+// Example JSON log line:
+//
+//	{"time":"2024-01-02T03:04:05.000000006+01:00","level":"DEBUG","component":"failover","message":"Monitor check: 1, rx bytes: 100, missed: 0, health: healthy"}
+//
+//export SetLogFormat
+func SetLogFormat(format C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	f, err := int8Enum(format, "log format")
+	if err != nil {
+		return getCError(err)
+	}
+	return getCError(state.SetLogFormat(client.LogFormat(f)))
+}
+
+// SetLogRotation sets when the log file in the config directory is rotated
+//
+// By default the log file is rotated when it becomes larger than 5 MiB and 3 rotated files are kept.
+// The rotated files are named `log.1` to `log.N` where `log.1` is the most recent.
+//
+//   - `maxSize` is the size in bytes after which the log file is rotated, 0 disables rotation
+//   - `maxFiles` is the number of rotated log files that are kept
+//
+// Example Input: ```SetLogRotation(1048576, 5)```
+//
+// Example Output: ```null```
+//
+//export SetLogRotation
+func SetLogRotation(maxSize C.longlong, maxFiles C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	return getCError(state.SetLogRotation(int64(maxSize), int(maxFiles)))
+}
+
 // SetState sets the state of the statemachine
 //
 // Note: this transitions the FSM into the new state without passing any data to it.
@@ -965,6 +1516,113 @@ func InState(fsmState C.int) (C.int, *C.char) {
 	return 0, nil
 }
 
+// SetTransitionHistory sets the maximum number of state transitions that are recorded
+//
+// By default no transitions are recorded, unless the client was registered with debug enabled, then the last 50 transitions are recorded.
+// The recorded transitions can be retrieved with `TransitionHistory`, e.g. to include them in a bug report when a client seems stuck in a state.
+//
+//   - `size` is the maximum number of transitions, 0 disables recording. The transitions that were recorded before are removed
+//
+// Example Input: ```SetTransitionHistory(100)```
+//
+// Example Output: ```null```
+//
+//export SetTransitionHistory
+func SetTransitionHistory(size C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	state.SetTransitionHistory(int(size))
+	return nil
+}
+
+// TransitionHistory gets the recorded state transitions with the oldest first
+//
+// The transitions are only recorded if this is enabled with `SetTransitionHistory` or when debugging is enabled.
+// This function does not wait for a transition that is in progress.
+//
+// It returns the list of internal/fsm/history.go HistoryEntry marshalled as JSON, this is `null` when no transitions were recorded.
+// For each transition this has the old state, the new state, the time, whether or not the client handled the transition and the Go type of the data.
+//
+// Example Input: ```TransitionHistory()```
+//
+// Example Output:
+//
+//	[
+//	  {
+//	    "from": 1,
+//	    "to": 4,
+//	    "time": "2023-09-01T12:00:00.123456789+02:00",
+//	    "handled": true,
+//	    "data_type": "string"
+//	  },
+//	  {
+//	    "from": 4,
+//	    "to": 6,
+//	    "time": "2023-09-01T12:00:01.123456789+02:00",
+//	    "handled": true,
+//	    "data_type": "*server.RequiredAskTransition"
+//	  }
+//	], null
+//
+//export TransitionHistory
+func TransitionHistory() (*C.char, *C.char) {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return nil, getCError(stateErr)
+	}
+	ret, err := getReturnData(state.TransitionHistory())
+	if err != nil {
+		return nil, getCError(err)
+	}
+	return C.CString(ret), nil
+}
+
+// StateGraph gets a graph of the state machine
+//
+// The current state is highlighted in cyan and the transitions that are in the transition history, see `SetTransitionHistory`, are highlighted in orange.
+// The library does not write this graph to a file, a client can e.g. write it to a file when debugging is enabled.
+//
+//   - `format` is the format of the graph:
+//
+//   - 0: Mermaid, this can be converted to an image with https://mermaid.js.org/
+//
+//   - 1: Graphviz DOT, this can be converted to an image with e.g. `dot -Tpng`
+//
+// It returns an error if the format is unknown.
+//
+// Example Input: ```StateGraph(1)```
+//
+// Example Output:
+//
+//	digraph {
+//		node [shape=box, style="rounded,filled", fillcolor=white];
+//		"Deregistered";
+//		"Main" [fillcolor=cyan];
+//		...
+//		"Deregistered" -> "Main" [label="Register", color=orange, penwidth=3];
+//		"Main" -> "Deregistered" [label="Deregister"];
+//		...
+//	}, null
+//
+//export StateGraph
+func StateGraph(format C.int) (*C.char, *C.char) {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return nil, getCError(stateErr)
+	}
+	f, err := int8Enum(format, "graph format")
+	if err != nil {
+		return nil, getCError(err)
+	}
+	g, err := state.StateGraph(client.FSMGraphFormat(f))
+	if err != nil {
+		return nil, getCError(err)
+	}
+	return C.CString(g), nil
+}
+
 // FreeString frees a string that was allocated by the eduvpn-common Go library
 //
 // This happens when we return strings, such as errors from the Go lib back to the client.
@@ -1073,6 +1731,166 @@ func SetTokenHandler(getter C.TokenGetter, setter C.TokenSetter) *C.char {
 	return nil
 }
 
+// SetTokenFileStore sets an encrypted on-disk store for the OAuth tokens
+//
+// By default eduvpn-common only caches the tokens in memory and uses the handlers of `SetTokenHandler` to persist them.
+// With this function the tokens are saved, encrypted at rest with AES-GCM, in a file next to the state file in the config directory.
+// The token handlers, if set, are still called.
+//
+//   - `passphrase` is the passphrase the encryption key is derived from using scrypt
+//
+//   - `keyFile` is the path to a file, at least 32 bytes, whose contents the encryption key is derived from
+//
+// Exactly one of `passphrase` and `keyFile` must be non-empty.
+//
+// It returns an error when the token store cannot be created.
+// Example Input: ```SetTokenFileStore("", "/etc/eduvpn/token.key")```
+//
+// Example Output: ```null```
+//
+//export SetTokenFileStore
+func SetTokenFileStore(passphrase *C.char, keyFile *C.char) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	err := state.SetFileTokenStore(C.GoString(passphrase), C.GoString(keyFile))
+	return getCError(err)
+}
+
+// SetAuthFlow sets the OAuth flow that is used for new authorizations
+//
+// By default (0) the authorization code flow is used where the user authorizes in a browser and is redirected back.
+// Headless clients, e.g. on servers or routers, can set it to 1 to use the OAuth device authorization grant (RFC 8628).
+// When authorization is needed the FSM then goes to the OAuthDeviceStarted state with the JSON data:
+// `{"user_code": "...", "verification_uri": "...", "verification_uri_complete": "...", "expires_at": 1700000000}`.
+// The client should show the verification URI and the user code, eduvpn-common polls the token endpoint itself.
+//
+//   - `flow` is the OAuth flow, 0 for the browser flow, 1 for the device flow
+//
+// It returns an error when the flow is unknown.
+// Example Input: ```SetAuthFlow(1)```
+//
+// Example Output: ```null```
+//
+//export SetAuthFlow
+func SetAuthFlow(flow C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	f, err := int8Enum(flow, "OAuth flow")
+	if err != nil {
+		return getCError(err)
+	}
+	err = state.SetAuthFlow(client.AuthFlow(f))
+	return getCError(err)
+}
+
+// SetProtocolPreference sets the client wide VPN protocol preference
+//
+// This preference is used for servers that have no preference of their own, see `SetServerProtocolPreference`.
+// When getting a VPN configuration, the preference decides which protocols are accepted and which profiles can be chosen.
+//
+//   - `pref` is the protocol preference, defined in types/protocol/protocol.go Preference:
+//
+//   - 0: Auto, the server chooses the protocol. This is the default
+//
+//   - 1: Prefer OpenVPN, only OpenVPN is accepted if the profile supports both protocols
+//
+//   - 2: Prefer WireGuard, only WireGuard is accepted if the profile supports both protocols
+//
+//   - 3: Only OpenVPN, profiles without OpenVPN cannot be chosen
+//
+//   - 4: Only WireGuard, profiles without WireGuard cannot be chosen
+//
+// It returns an error when the preference is unknown.
+// Example Input: ```SetProtocolPreference(2)```
+//
+// Example Output: ```null```
+//
+//export SetProtocolPreference
+func SetProtocolPreference(pref C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	p, err := int8Enum(pref, "protocol preference")
+	if err != nil {
+		return getCError(err)
+	}
+	err = state.SetProtocolPreference(protocol.Preference(p))
+	return getCError(err)
+}
+
+// SetServerProtocolPreference sets the VPN protocol preference for a server
+//
+// This preference is saved in the state file and takes precedence over the client wide preference set with `SetProtocolPreference`.
+//
+//   - `_type` is the type of server, defined in types/server/server.go Type
+//
+//   - `id` is the identifier of the server, the same as for `AddServer`
+//
+//   - `pref` is the protocol preference, see `SetProtocolPreference`. Auto (0) means that the client wide preference is used
+//
+// It returns an error when the server does not exist or the preference is unknown.
+// Example Input (3=custom server, 4=only WireGuard): ```SetServerProtocolPreference(3, "https://demo.eduvpn.nl/", 4)```
+//
+// Example Output: ```null```
+//
+//export SetServerProtocolPreference
+func SetServerProtocolPreference(_type C.int, id *C.char, pref C.int) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	t, err := int8Enum(_type, "server type")
+	if err != nil {
+		return getCError(err)
+	}
+	p, err := int8Enum(pref, "protocol preference")
+	if err != nil {
+		return getCError(err)
+	}
+	err = state.SetServerProtocolPreference(C.GoString(id), srvtypes.Type(t), protocol.Preference(p))
+	return getCError(err)
+}
+
+// SetCapabilities sets the capabilities that the client declares
+//
+// Profiles that cannot be used with these capabilities are filtered: they are not in the profile list of `ServerList` and `CurrentServer`,
+// they are not in the data of the ASK_PROFILE transition and they are not chosen automatically when getting a config.
+// Whether or not WireGuard is supported and the protocol preference, see `SetProtocolPreference`, are also used for filtering.
+//
+//   - `capabilities` is the types/server/server.go Capabilities marshalled as JSON:
+//
+//   - "tcp_only": The client can only connect over TCP, e.g. because UDP is blocked. TCP is then also always preferred
+//
+//   - "default_gateway_only": The client can only use profiles that are a default gateway
+//
+// An empty string or `{}` removes the capabilities.
+// It returns an error when the JSON is not valid.
+//
+// Example Input: ```SetCapabilities("{\"tcp_only\": true}")```
+//
+// Example Output: ```null```
+//
+//export SetCapabilities
+func SetCapabilities(capabilities *C.char) *C.char {
+	state, stateErr := getVPNState()
+	if stateErr != nil {
+		return getCError(stateErr)
+	}
+	var caps srvtypes.Capabilities
+	if j := C.GoString(capabilities); j != "" {
+		if err := json.Unmarshal([]byte(j), &caps); err != nil {
+			return getCError(i18nerr.WrapInternal(err, "The capabilities are not valid JSON"))
+		}
+	}
+	state.SetCapabilities(caps)
+	return nil
+}
+
 // CookieNew creates a new cookie and returns it
 //
 // This value should not be parsed or converted somehow by the client
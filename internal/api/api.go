@@ -17,6 +17,7 @@ import (
 	"github.com/eduvpn/eduvpn-common/internal/api/profiles"
 	httpw "github.com/eduvpn/eduvpn-common/internal/http"
 	"github.com/eduvpn/eduvpn-common/internal/log"
+	"github.com/eduvpn/eduvpn-common/internal/openvpn"
 	"github.com/eduvpn/eduvpn-common/internal/wireguard"
 	"github.com/eduvpn/eduvpn-common/types/protocol"
 	"github.com/eduvpn/eduvpn-common/types/server"
@@ -27,6 +28,9 @@ import (
 type Callbacks interface {
 	// TriggerAuth is called when authorization should be triggered
 	TriggerAuth(context.Context, string, bool) (string, error)
+	// TriggerDeviceAuth is called when the device authorization grant is started
+	// The client should show the verification URI and user code to the user
+	TriggerDeviceAuth(context.Context, server.DeviceAuthorization) error
 	// AuthDone is called when authorization has just completed
 	AuthDone(string, server.Type)
 	// TokensUpdates is called when tokens are updated
@@ -49,6 +53,8 @@ type ServerData struct {
 	SetAuthorizeTime func(time.Time)
 	// DisableAuthorize indicates whether or not new authorization requests should be disabled
 	DisableAuthorize bool
+	// AuthFlow is the OAuth flow that is used when authorization is needed
+	AuthFlow AuthFlow
 }
 
 // API is the top-level struct that each method is defined on
@@ -58,6 +64,8 @@ type API struct {
 	oauth *eduoauth.OAuth
 	// apiURL is the API url to send a request to
 	apiURL string
+	// deviceURL is the device authorization endpoint, empty if the server does not support it
+	deviceURL string
 	// Data is the server data
 	Data ServerData
 }
@@ -87,10 +95,11 @@ func NewAPI(ctx context.Context, clientID string, sd ServerData, cb Callbacks, t
 	}
 
 	api := &API{
-		cb:     cb,
-		oauth:  &o,
-		apiURL: ep.API,
-		Data:   sd,
+		cb:        cb,
+		oauth:     &o,
+		apiURL:    ep.API,
+		deviceURL: epauth.DeviceAuthorization,
+		Data:      sd,
 	}
 	err = api.authorize(ctx)
 	if err != nil {
@@ -99,6 +108,14 @@ func NewAPI(ctx context.Context, clientID string, sd ServerData, cb Callbacks, t
 	return api, nil
 }
 
+// NoAuthorize returns a copy of the API that never triggers authorization, e.g. to use it without user interaction
+// The OAuth tokens are shared with the original
+func (a *API) NoAuthorize() *API {
+	cp := *a
+	cp.Data.DisableAuthorize = true
+	return &cp
+}
+
 // ErrAuthorizeDisabled is returned when authorization is disabled but is needed to complete
 var ErrAuthorizeDisabled = errors.New("cannot authorize as re-authorization is disabled")
 
@@ -119,6 +136,10 @@ func (a *API) authorize(ctx context.Context) (err error) {
 		}
 	}()
 
+	if a.Data.AuthFlow == AuthFlowDevice {
+		return a.authorizeDevice(ctx)
+	}
+
 	scope := "config"
 	url, err := a.oauth.AuthURL(scope)
 	if err != nil {
@@ -158,7 +179,7 @@ func (a *API) authorizedRetry(ctx context.Context, method string, endpoint strin
 	// Only retry authorized if we get an HTTP 401
 	// TODO: Can the OAuth client handle this instead?
 	if errors.As(err, &statErr) && statErr.Status == 401 {
-		log.Logger.Debugf("Got a 401 error after HTTP method: %s, endpoint: %s. Marking token as expired...", method, endpoint)
+		log.Logger.Debugf("[API] Got a 401 error after HTTP method: %s, endpoint: %s. Marking token as expired...", method, endpoint)
 		// Mark the token as expired and retry, so we trigger the refresh flow
 		a.oauth.SetTokenExpired()
 		h, body, err = a.authorized(ctx, method, endpoint, opts)
@@ -168,7 +189,7 @@ func (a *API) authorizedRetry(ctx context.Context, method string, endpoint strin
 	if err != nil && errors.As(err, &tErr) {
 		// Mark the token as invalid and retry, so we trigger the authorization flow
 		a.oauth.SetTokenRenew()
-		log.Logger.Debugf("the tokens were invalid, trying again...")
+		log.Logger.Debugf("[OAuth] the tokens were invalid, trying again...")
 		if autherr := a.authorize(ctx); autherr != nil {
 			return nil, nil, autherr
 		}
@@ -207,6 +228,31 @@ type ConnectData struct {
 	Expires time.Time
 	// Proxy is filled when WireGuard is proxied
 	Proxy *wireguard.Proxy
+	// WireGuard is the parsed configuration, only filled for WireGuard
+	WireGuard *server.WireGuardConfig
+	// WireGuardKey is the WireGuard private key of the configuration, only filled for WireGuard
+	// It can be reused when renewing the configuration
+	WireGuardKey *wgtypes.Key
+	// OpenVPN is the structured view of the configuration, only filled for OpenVPN
+	OpenVPN *server.OpenVPNConfig
+	// CertificateExpires is when the inline OpenVPN client certificate expires
+	// This is the zero time if the configuration has no inline client certificate
+	CertificateExpires time.Time
+	// ExpiryMismatch is true if Expires and CertificateExpires differ more than ExpiryTolerance
+	ExpiryMismatch bool
+}
+
+// ExpiryTolerance is the maximum difference between the expiry from the "Expires" header and the expiry of the OpenVPN client certificate
+// A larger difference is logged as it indicates clock skew or a misconfigured server
+var ExpiryTolerance = 5 * time.Minute
+
+// expiryMismatch returns whether or not the expiry from the header `hdr` and from the certificate `cert` differ more than ExpiryTolerance
+func expiryMismatch(hdr time.Time, cert time.Time) bool {
+	d := cert.Sub(hdr)
+	if d < 0 {
+		d = -d
+	}
+	return d > ExpiryTolerance
 }
 
 // see https://github.com/eduvpn/documentation/blob/v3/API.md#request-1
@@ -229,10 +275,21 @@ func protocolFromCT(ct string) (protocol.Protocol, error) {
 	return protocol.Unknown, fmt.Errorf("invalid content type: %s", ct)
 }
 
+// keyRejected returns whether or not error `err` from a /connect call means that the server did not accept a reused WireGuard public key
+func keyRejected(err error) bool {
+	statErr := &httpw.StatusError{}
+	if !errors.As(err, &statErr) {
+		return false
+	}
+	return statErr.Status == http.StatusBadRequest || statErr.Status == http.StatusConflict
+}
+
 // Connect sends a /connect to an eduVPN server
 // `ctx` is the context used for cancellation
 // protos is the list of protocols supported and wanted by the client
-func (a *API) Connect(ctx context.Context, prof profiles.Profile, protos []protocol.Protocol, pTCP bool) (*ConnectData, error) {
+// `wgKey` is the WireGuard private key to reuse, if it is nil a new key is generated
+// If the server does not accept a reused key, the call is done again with a new key
+func (a *API) Connect(ctx context.Context, prof profiles.Profile, protos []protocol.Protocol, pTCP bool, wgKey *wgtypes.Key) (*ConnectData, error) {
 	hdrs := http.Header{
 		"content-type": {"application/x-www-form-urlencoded"},
 	}
@@ -244,17 +301,21 @@ func (a *API) Connect(ctx context.Context, prof profiles.Profile, protos []proto
 		return nil, errors.New("no protocols supplied")
 	}
 
-	var wgKey *wgtypes.Key
+	reused := false
 
 	// Loop over the protocols and set the correct headers and values
 	for _, p := range protos {
 		switch p {
 		case protocol.WireGuard:
-			gk, err := wgtypes.GeneratePrivateKey()
-			if err != nil {
-				return nil, err
+			if wgKey == nil {
+				gk, err := wgtypes.GeneratePrivateKey()
+				if err != nil {
+					return nil, err
+				}
+				wgKey = &gk
+			} else {
+				reused = true
 			}
-			wgKey = &gk
 			// Set the public key
 			pubkey := wgKey.PublicKey()
 			uv.Set("public_key", pubkey.String())
@@ -272,6 +333,17 @@ func (a *API) Connect(ctx context.Context, prof profiles.Profile, protos []proto
 	// Construct the parameters
 	params := &httpw.OptionalParams{Headers: hdrs, Body: uv}
 	h, body, err := a.authorizedRetry(ctx, http.MethodPost, "/connect", params)
+	if err != nil && reused && keyRejected(err) {
+		log.Logger.Debugf("[API] the server did not accept the reused WireGuard key with error: %v, trying again with a new key...", err)
+		gk, gerr := wgtypes.GeneratePrivateKey()
+		if gerr != nil {
+			return nil, gerr
+		}
+		wgKey = &gk
+		pubkey := wgKey.PublicKey()
+		uv.Set("public_key", pubkey.String())
+		h, body, err = a.authorizedRetry(ctx, http.MethodPost, "/connect", params)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed API /connect call: %v", err)
 	}
@@ -292,24 +364,52 @@ func (a *API) Connect(ctx context.Context, prof profiles.Profile, protos []proto
 	}
 
 	if proto == protocol.OpenVPN {
-		// ensure scripts are not ran by default by append script-security 0 to the config
-		vpnCfg += "\nscript-security 0"
-		return &ConnectData{
-			Configuration: vpnCfg,
+		ocfg, err := openvpn.Parse(vpnCfg)
+		if err != nil {
+			return nil, err
+		}
+		// remove the dangerous directives and ensure scripts are not ran by default
+		if err = ocfg.Apply(openvpn.DefaultPolicy); err != nil {
+			return nil, err
+		}
+		cd := &ConnectData{
+			Configuration: ocfg.String(),
 			Protocol:      proto,
 			Expires:       expT,
-		}, nil
+			OpenVPN:       ocfg.Structured(),
+		}
+		// the certificate expiry is only used to check the Expires header, a certificate that cannot be parsed is not fatal
+		certT, ok, err := ocfg.CertificateExpiry()
+		if err != nil {
+			log.Logger.Warningf("[API] failed to get the expiry of the OpenVPN certificate: %v", err)
+		}
+		if ok {
+			cd.CertificateExpires = certT
+			cd.ExpiryMismatch = expiryMismatch(expT, certT)
+			if cd.ExpiryMismatch {
+				log.Logger.Warningf("[API] The VPN expiry from the Expires header: %v differs from the certificate expiry: %v by more than: %v, this indicates clock skew or a misconfigured server", expT, certT, ExpiryTolerance)
+			}
+		}
+		return cd, nil
 	}
 
 	vpnCfg, proxy, err := wireguard.Config(vpnCfg, wgKey, proto == protocol.WireGuardProxy)
 	if err != nil {
 		return nil, err
 	}
+	// the structured config is only an extra view of the config, a failure to parse it should not fail connecting
+	wg, err := wireguard.Parse(vpnCfg)
+	if err != nil {
+		log.Logger.Warningf("[API] failed to parse the WireGuard config into a structured config: %v", err)
+		wg = nil
+	}
 	return &ConnectData{
 		Configuration: vpnCfg,
 		Protocol:      proto,
 		Expires:       expT,
 		Proxy:         proxy,
+		WireGuard:     wg,
+		WireGuardKey:  wgKey,
 	}, nil
 }
 
@@ -363,12 +463,12 @@ type OAuthLogger struct{}
 
 // Logf logs a message with parameters
 func (ol *OAuthLogger) Logf(msg string, params ...interface{}) {
-	log.Logger.Debugf(msg, params...)
+	log.Logger.Debugf("[OAuth] "+msg, params...)
 }
 
 // Log logs a message
 func (ol *OAuthLogger) Log(msg string) {
-	log.Logger.Debugf("%s", msg)
+	log.Logger.Debugf("[OAuth] %s", msg)
 }
 
 func init() {
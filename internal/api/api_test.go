@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	httpw "github.com/eduvpn/eduvpn-common/internal/http"
+)
+
+func TestExpiryMismatch(t *testing.T) {
+	hdr := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		cert time.Time
+		want bool
+	}{
+		{cert: hdr},
+		{cert: hdr.Add(ExpiryTolerance)},
+		{cert: hdr.Add(-ExpiryTolerance)},
+		{cert: hdr.Add(ExpiryTolerance + time.Second), want: true},
+		{cert: hdr.Add(-ExpiryTolerance - time.Second), want: true},
+	}
+	for _, c := range cases {
+		if got := expiryMismatch(hdr, c.cert); got != c.want {
+			t.Fatalf("expiry mismatch not equal for certificate: %v, got: %v, want: %v", c.cert, got, c.want)
+		}
+	}
+}
+
+func TestKeyRejected(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("timeout")},
+		{err: &httpw.StatusError{Status: 500}},
+		{err: &httpw.StatusError{Status: 400}, want: true},
+		{err: fmt.Errorf("failed HTTP request with error: %w", &httpw.StatusError{Status: 409}), want: true},
+	}
+	for _, c := range cases {
+		if got := keyRejected(c.err); got != c.want {
+			t.Fatalf("key rejected not equal for error: %v, got: %v, want: %v", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jwijenbergh/eduoauth-go"
+
+	httpw "github.com/eduvpn/eduvpn-common/internal/http"
+	"github.com/eduvpn/eduvpn-common/internal/log"
+	"github.com/eduvpn/eduvpn-common/types/server"
+)
+
+// AuthFlow is the OAuth flow that is used to authorize
+type AuthFlow int8
+
+const (
+	// AuthFlowBrowser is the authorization code flow where the user authorizes in a browser and we get redirected back
+	AuthFlowBrowser AuthFlow = iota
+	// AuthFlowDevice is the device authorization grant, see https://datatracker.ietf.org/doc/html/rfc8628
+	// This is useful for headless clients where no browser can redirect back to the client
+	AuthFlowDevice
+)
+
+// deviceGrantType is the grant type for polling the token endpoint, see https://datatracker.ietf.org/doc/html/rfc8628#section-3.4
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+var (
+	// defaultDeviceInterval is the polling interval when the server does not return one
+	defaultDeviceInterval = 5 * time.Second
+	// slowDownIncrease is how much the polling interval is increased when the server returns slow_down
+	slowDownIncrease = 5 * time.Second
+)
+
+// ErrDeviceAuthUnsupported is returned when the device authorization grant is selected but the server does not support it
+var ErrDeviceAuthUnsupported = errors.New("the server does not support the OAuth device authorization grant")
+
+// deviceAuthResponse is the response of the device authorization endpoint, see https://datatracker.ietf.org/doc/html/rfc8628#section-3.2
+type deviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// deviceErrorResponse is the error response of the token endpoint, see https://datatracker.ietf.org/doc/html/rfc8628#section-3.5
+type deviceErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// formHeaders returns the headers for sending a form encoded POST body
+func formHeaders() http.Header {
+	return http.Header{
+		"Content-Type": {"application/x-www-form-urlencoded"},
+	}
+}
+
+// deviceAuthorize sends the device authorization request to endpoint `ep`
+func deviceAuthorize(ctx context.Context, c *httpw.Client, ep string, clientID string, scope string) (*deviceAuthResponse, error) {
+	if ep == "" {
+		return nil, ErrDeviceAuthUnsupported
+	}
+	opts := &httpw.OptionalParams{
+		Headers: formHeaders(),
+		Body: url.Values{
+			"client_id": {clientID},
+			"scope":     {scope},
+		},
+	}
+	_, body, err := c.PostWithOpts(ctx, ep, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed device authorization request: %w", err)
+	}
+	dar := deviceAuthResponse{}
+	if err = json.Unmarshal(body, &dar); err != nil {
+		return nil, fmt.Errorf("failed parsing device authorization response: %w", err)
+	}
+	if dar.DeviceCode == "" || dar.UserCode == "" || dar.VerificationURI == "" {
+		return nil, errors.New("the device authorization response is missing required fields")
+	}
+	return &dar, nil
+}
+
+// pollDeviceToken polls the token endpoint `tokenURL` until the user has authorized the device code
+// It handles authorization_pending and slow_down and returns an error on any other error or when the device code expires
+func pollDeviceToken(ctx context.Context, c *httpw.Client, tokenURL string, clientID string, dar *deviceAuthResponse) (*eduoauth.Token, error) {
+	interval := time.Duration(dar.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceInterval
+	}
+	exp := time.Now().Add(time.Duration(dar.ExpiresIn) * time.Second)
+	opts := &httpw.OptionalParams{
+		Headers: formHeaders(),
+		Body: url.Values{
+			"client_id":   {clientID},
+			"device_code": {dar.DeviceCode},
+			"grant_type":  {deviceGrantType},
+		},
+	}
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("device authorization was stopped: %w", context.Canceled)
+		}
+		if dar.ExpiresIn > 0 && time.Now().After(exp) {
+			return nil, errors.New("the device code expired before the user authorized")
+		}
+
+		now := time.Now()
+		_, body, err := c.PostWithOpts(ctx, tokenURL, opts)
+		if err == nil {
+			tr := eduoauth.TokenResponse{}
+			if err = json.Unmarshal(body, &tr); err != nil {
+				return nil, fmt.Errorf("failed parsing device token response: %w", err)
+			}
+			return &eduoauth.Token{
+				Access:           tr.Access,
+				Refresh:          tr.Refresh,
+				ExpiredTimestamp: now.Add(time.Duration(tr.Expires) * time.Second),
+			}, nil
+		}
+
+		statErr := &httpw.StatusError{}
+		if !errors.As(err, &statErr) {
+			return nil, err
+		}
+		er := deviceErrorResponse{}
+		if jerr := json.Unmarshal([]byte(statErr.Body), &er); jerr != nil {
+			return nil, err
+		}
+		switch er.Error {
+		case "authorization_pending":
+			log.Logger.Debugf("[OAuth] device authorization is pending, polling again in: %v", interval)
+		case "slow_down":
+			interval += slowDownIncrease
+			log.Logger.Debugf("[OAuth] device authorization got slow_down, polling again in: %v", interval)
+		case "access_denied":
+			return nil, errors.New("the user denied the device authorization request")
+		case "expired_token":
+			return nil, errors.New("the device code expired before the user authorized")
+		default:
+			return nil, fmt.Errorf("device authorization failed with error: '%s' and description: '%s'", er.Error, er.Description)
+		}
+	}
+}
+
+// authorizeDevice authorizes using the OAuth device authorization grant
+// The verification URI and user code are passed to the client using the TriggerDeviceAuth callback
+func (a *API) authorizeDevice(ctx context.Context) error {
+	httpC := httpw.NewClient(nil)
+	dar, err := deviceAuthorize(ctx, httpC, a.deviceURL, a.oauth.ClientID, "config")
+	if err != nil {
+		return err
+	}
+	da := server.DeviceAuthorization{
+		UserCode:                dar.UserCode,
+		VerificationURI:         dar.VerificationURI,
+		VerificationURIComplete: dar.VerificationURIComplete,
+		ExpiresAt:               time.Now().Add(time.Duration(dar.ExpiresIn) * time.Second).Unix(),
+	}
+	if err = a.cb.TriggerDeviceAuth(ctx, da); err != nil {
+		return err
+	}
+	tok, err := pollDeviceToken(ctx, httpC, a.oauth.TokenURL, a.oauth.ClientID, dar)
+	if err != nil {
+		return err
+	}
+	// This also calls the tokens updated callback
+	a.oauth.UpdateTokens(*tok)
+	return nil
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/internal/test"
+)
+
+func TestDeviceAuthorization(t *testing.T) {
+	defaultDeviceInterval = 10 * time.Millisecond
+	slowDownIncrease = 10 * time.Millisecond
+
+	cases := []struct {
+		// token are the responses of the token endpoint in order, the last one is repeated
+		token   []string
+		wantErr string
+	}{
+		{
+			token: []string{
+				`{"error": "authorization_pending"}`,
+				`{"error": "slow_down"}`,
+				`{"error": "authorization_pending"}`,
+				`{"access_token": "access", "refresh_token": "refresh", "token_type": "bearer", "expires_in": 3600}`,
+			},
+			wantErr: "",
+		},
+		{
+			token: []string{
+				`{"error": "authorization_pending"}`,
+				`{"error": "access_denied"}`,
+			},
+			wantErr: "the user denied the device authorization request",
+		},
+		{
+			token: []string{
+				`{"error": "expired_token"}`,
+			},
+			wantErr: "the device code expired before the user authorized",
+		},
+		{
+			token: []string{
+				`{"error": "invalid_client", "error_description": "unknown client"}`,
+			},
+			wantErr: "device authorization failed with error: 'invalid_client' and description: 'unknown client'",
+		},
+	}
+
+	for _, c := range cases {
+		var mu sync.Mutex
+		n := 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("client_id") != "test" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"device_code": "dc", "user_code": "ABCD-EFGH", "verification_uri": "https://example.com/device", "expires_in": 60}`)
+		})
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("device_code") != "dc" || r.PostForm.Get("grant_type") != deviceGrantType {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			resp := c.token[n]
+			if n < len(c.token)-1 {
+				n++
+			}
+			mu.Unlock()
+			if strings.Contains(resp, `"error"`) {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			fmt.Fprint(w, resp)
+		})
+		s := test.NewServer(mux)
+		hc, err := s.Client()
+		if err != nil {
+			t.Fatalf("failed to get test client: %v", err)
+		}
+
+		dar, err := deviceAuthorize(context.Background(), hc, s.URL+"/device", "test", "config")
+		if err != nil {
+			t.Fatalf("failed device authorization request: %v", err)
+		}
+		if dar.UserCode != "ABCD-EFGH" {
+			t.Fatalf("user code not equal, got: %v, want: ABCD-EFGH", dar.UserCode)
+		}
+		tok, err := pollDeviceToken(context.Background(), hc, s.URL+"/token", "test", dar)
+		test.AssertError(t, err, c.wantErr)
+		if err == nil && (tok.Access != "access" || tok.Refresh != "refresh") {
+			t.Fatalf("tokens not equal, got: %v", tok)
+		}
+		s.Close()
+	}
+}
+
+func TestDeviceAuthorizationUnsupported(t *testing.T) {
+	_, err := deviceAuthorize(context.Background(), nil, "", "test", "config")
+	test.AssertError(t, err, ErrDeviceAuthUnsupported.Error())
+}
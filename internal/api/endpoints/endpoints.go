@@ -15,6 +15,9 @@ type List struct {
 	Authorization string `json:"authorization_endpoint"`
 	// Token is the token endpoint for OAuth
 	Token string `json:"token_endpoint"`
+	// DeviceAuthorization is the device authorization endpoint for the OAuth device authorization grant
+	// This is empty if the server does not support it
+	DeviceAuthorization string `json:"device_authorization_endpoint,omitempty"`
 }
 
 // Versions is the endpoints separated by API version
@@ -3,6 +3,8 @@
 package profiles
 
 import (
+	"strings"
+
 	"github.com/eduvpn/eduvpn-common/types/protocol"
 	"github.com/eduvpn/eduvpn-common/types/server"
 )
@@ -100,12 +102,58 @@ func (p *Profile) HasWireGuard() bool {
 	return hasProtocol(p.VPNProtoList, protocol.WireGuard)
 }
 
-// FilterWireGuard gets a profile list but without WireGuard profiles
-func (i Info) FilterWireGuard() *Info {
+// HasTCP returns whether or not the profile supports protocol `proto` over TCP
+// Old servers do not give the transport list, then only OpenVPN is assumed to support TCP
+func (p *Profile) HasTCP(proto protocol.Protocol) bool {
+	if len(p.VPNProtoTransportList) == 0 {
+		return proto == protocol.OpenVPN && p.HasOpenVPN()
+	}
+	for _, c := range p.VPNProtoTransportList {
+		pr, tr, ok := strings.Cut(c, "+")
+		if ok && tr == "tcp" && protocol.New(pr) == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities are the capabilities of the client that decide which profiles can be used
+type Capabilities struct {
+	// Protocols are the VPN protocols that the client supports
+	// If this is empty, all protocols are supported
+	Protocols []protocol.Protocol
+	// TCPOnly indicates that the client can only connect over TCP
+	TCPOnly bool
+	// DefaultGatewayOnly indicates that the client can only use default gateway profiles
+	DefaultGatewayOnly bool
+}
+
+// Supports returns whether or not profile `p` can be used with the capabilities
+func (c Capabilities) Supports(p Profile) bool {
+	if c.DefaultGatewayOnly && !p.DefaultGateway {
+		return false
+	}
+	protos := c.Protocols
+	if len(protos) == 0 {
+		protos = []protocol.Protocol{protocol.OpenVPN, protocol.WireGuard}
+	}
+	for _, proto := range protos {
+		if !hasProtocol(p.VPNProtoList, proto) {
+			continue
+		}
+		if !c.TCPOnly || p.HasTCP(proto) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter gets a profile list with only the profiles that can be used with capabilities `c`
+func (i Info) Filter(c Capabilities) *Info {
 	var ret []Profile
 	for _, p := range i.Info.ProfileList {
-		if !p.HasOpenVPN() {
-			continue
+		if c.Supports(p) {
+			ret = append(ret, p)
 		}
 	}
 	return &Info{
@@ -115,6 +163,11 @@ func (i Info) FilterWireGuard() *Info {
 	}
 }
 
+// FilterWireGuard gets a profile list but without WireGuard only profiles
+func (i Info) FilterWireGuard() *Info {
+	return i.Filter(Capabilities{Protocols: []protocol.Protocol{protocol.OpenVPN}})
+}
+
 // Public gets the server list as a structure that we return to clients
 func (i Info) Public() server.Profiles {
 	m := make(map[string]server.Profile)
@@ -123,6 +176,10 @@ func (i Info) Public() server.Profiles {
 			DisplayName: map[string]string{
 				"en": p.DisplayName,
 			},
+			DefaultGateway:        p.DefaultGateway,
+			DNSSearchDomains:      p.DNSSearchDomains,
+			VPNProtoList:          p.VPNProtoList,
+			VPNProtoTransportList: p.VPNProtoTransportList,
 		}
 	}
 	return server.Profiles{Map: m}
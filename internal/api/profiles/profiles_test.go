@@ -0,0 +1,90 @@
+package profiles
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/types/protocol"
+	"github.com/eduvpn/eduvpn-common/types/server"
+)
+
+func TestPublic(t *testing.T) {
+	i := Info{Info: ListInfo{ProfileList: []Profile{
+		{
+			ID:                    "internet",
+			DisplayName:           "Internet",
+			VPNProtoList:          []string{"openvpn", "wireguard"},
+			VPNProtoTransportList: []string{"openvpn+udp", "openvpn+tcp", "wireguard+udp"},
+			DefaultGateway:        true,
+			DNSSearchDomains:      []string{"example.org"},
+		},
+		{
+			ID:           "split",
+			DisplayName:  "Split",
+			VPNProtoList: []string{"wireguard"},
+		},
+	}}}
+	want := server.Profiles{Map: map[string]server.Profile{
+		"internet": {
+			DisplayName:           map[string]string{"en": "Internet"},
+			DefaultGateway:        true,
+			DNSSearchDomains:      []string{"example.org"},
+			VPNProtoList:          []string{"openvpn", "wireguard"},
+			VPNProtoTransportList: []string{"openvpn+udp", "openvpn+tcp", "wireguard+udp"},
+		},
+		"split": {
+			DisplayName:  map[string]string{"en": "Split"},
+			VPNProtoList: []string{"wireguard"},
+		},
+	}}
+	if got := i.Public(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("public profiles not equal, got: %v, want: %v", got, want)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	i := Info{Info: ListInfo{ProfileList: []Profile{
+		{ID: "both", VPNProtoList: []string{"openvpn", "wireguard"}, VPNProtoTransportList: []string{"openvpn+udp", "openvpn+tcp", "wireguard+udp"}, DefaultGateway: true},
+		{ID: "openvpn", VPNProtoList: []string{"openvpn"}, VPNProtoTransportList: []string{"openvpn+udp"}},
+		{ID: "wireguard", VPNProtoList: []string{"wireguard"}, VPNProtoTransportList: []string{"wireguard+udp", "wireguard+tcp"}, DefaultGateway: true},
+		// an old server without the transport list
+		{ID: "old", VPNProtoList: []string{"openvpn"}},
+	}}}
+
+	cases := []struct {
+		caps Capabilities
+		want []string
+	}{
+		{caps: Capabilities{}, want: []string{"both", "openvpn", "wireguard", "old"}},
+		{caps: Capabilities{Protocols: []protocol.Protocol{protocol.OpenVPN}}, want: []string{"both", "openvpn", "old"}},
+		{caps: Capabilities{Protocols: []protocol.Protocol{protocol.WireGuard}}, want: []string{"both", "wireguard"}},
+		{caps: Capabilities{TCPOnly: true}, want: []string{"both", "wireguard", "old"}},
+		{caps: Capabilities{Protocols: []protocol.Protocol{protocol.OpenVPN}, TCPOnly: true}, want: []string{"both", "old"}},
+		// both only supports WireGuard over UDP
+		{caps: Capabilities{Protocols: []protocol.Protocol{protocol.WireGuard}, TCPOnly: true}, want: []string{"wireguard"}},
+		{caps: Capabilities{DefaultGatewayOnly: true}, want: []string{"both", "wireguard"}},
+		{caps: Capabilities{Protocols: []protocol.Protocol{protocol.OpenVPN}, DefaultGatewayOnly: true}, want: []string{"both"}},
+		{caps: Capabilities{Protocols: []protocol.Protocol{protocol.OpenVPN}, TCPOnly: true, DefaultGatewayOnly: true}, want: []string{"both"}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, p := range i.Filter(c.caps).Info.ProfileList {
+			got = append(got, p.ID)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("filtered profiles not equal for capabilities: %+v, got: %v, want: %v", c.caps, got, c.want)
+		}
+	}
+}
+
+func TestFilterWireGuard(t *testing.T) {
+	i := Info{Info: ListInfo{ProfileList: []Profile{
+		{ID: "both", VPNProtoList: []string{"openvpn", "wireguard"}},
+		{ID: "wireguard", VPNProtoList: []string{"wireguard"}},
+		{ID: "openvpn", VPNProtoList: []string{"openvpn"}},
+	}}}
+	got := i.FilterWireGuard()
+	if got.Len() != 2 || got.MustIndex(0).ID != "both" || got.MustIndex(1).ID != "openvpn" {
+		t.Fatalf("filtered profiles not equal, got: %v", got.Info.ProfileList)
+	}
+}
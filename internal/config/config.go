@@ -4,77 +4,196 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path"
 
-	"github.com/eduvpn/eduvpn-common/internal/config/v1"
 	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
 	"github.com/eduvpn/eduvpn-common/internal/discovery"
 	"github.com/eduvpn/eduvpn-common/internal/log"
 	"github.com/eduvpn/eduvpn-common/internal/util"
 )
 
-const stateFile = "state.json"
+const (
+	stateFile = "state.json"
+	// backupFile is the last state file that could be parsed
+	backupFile = stateFile + ".bak"
+	// corruptFile is where a state file that cannot be parsed is moved to when it is recovered
+	corruptFile = stateFile + ".corrupt"
+)
+
+// ErrNoBackup is the error that is wrapped by Config.Recovered if a state file that cannot be parsed also has no usable backup
+// The state then starts empty, the original state file is kept as state.json.corrupt
+var ErrNoBackup = errors.New("no backup of the state file could be used")
 
 // Config represents the config state file
 type Config struct {
 	directory string
-	// V2 indicates we are version 2
-	V2 *v2.V2
+	// V3 is the current version of the state
+	V3 *v3.V3
+	// Recovered is non-nil if the state file could not be parsed
+	// It contains the parse error of the original state file, this wraps ErrNoBackup if the state file could also not be restored from the backup
+	// It wraps ErrNewerVersion if the state file was written by a newer version, the state is then empty and never saved
+	Recovered error
+	// newer is true if the state file on disk has a newer version, it is then never overwritten
+	newer bool
 }
 
 func (c *Config) filename() string {
 	return path.Join(c.directory, stateFile)
 }
 
+func (c *Config) backupFilename() string {
+	return path.Join(c.directory, backupFile)
+}
+
+// Directory returns the directory where the state file is stored
+func (c *Config) Directory() string {
+	return c.directory
+}
+
 // Discovery gets the discovery list from the state file
 func (c *Config) Discovery() *discovery.Discovery {
-	return &c.V2.Discovery
+	return &c.V3.Discovery
+}
+
+// parse parses the state file bytes `bts` and migrates it to the current version
+// It returns nil if the state file has no version
+func parse(bts []byte) (*v3.V3, error) {
+	var vers map[string]json.RawMessage
+	if err := json.Unmarshal(bts, &vers); err != nil {
+		return nil, err
+	}
+	ver, raw, err := latest(vers)
+	if err != nil {
+		return nil, err
+	}
+	if ver == 0 {
+		return nil, nil
+	}
+	raw, err = migrate(ver, raw)
+	if err != nil {
+		return nil, err
+	}
+	var cfg *v3.V3
+	if err = json.Unmarshal(raw, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// backup copies the current state file to the backup file if it can be parsed
+func (c *Config) backup() error {
+	bts, err := os.ReadFile(c.filename())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = parse(bts); err != nil {
+		log.Logger.Warningf("not backing up the state file as it cannot be parsed: %v", err)
+		return nil
+	}
+	return util.WriteFileAtomic(c.backupFilename(), bts)
 }
 
 // Save saves the state file to disk
+// The state is also written as version 2 such that downgrading to a version of the library that does not know version 3 keeps the servers
+// The previous state file is kept as a backup
+// It refuses to overwrite a state file that was written by a newer version
 func (c *Config) Save() error {
+	if c.newer {
+		return fmt.Errorf("refusing to overwrite the state file: %w", ErrNewerVersion)
+	}
 	if err := util.EnsureDirectory(c.directory); err != nil {
 		return err
 	}
 
-	join := Versioned{V2: c.V2}
+	join := Versioned{V2: v3.ToV2(c.V3), V3: c.V3}
 	cfg, err := json.Marshal(join)
 	if err != nil {
 		return err
 	}
-	if err = os.WriteFile(c.filename(), cfg, 0o600); err != nil {
-		return err
+	if err = c.backup(); err != nil {
+		log.Logger.Warningf("failed to backup the state file: %v", err)
 	}
-	return nil
+	return util.WriteFileAtomic(c.filename(), cfg)
+}
+
+// Redacted returns the state file as indented JSON with secrets redacted, e.g. to include it in a bug report
+// The cached discovery lists are left out as they are public and large, only their configuration is kept
+func (c *Config) Redacted() ([]byte, error) {
+	if c.V3 == nil {
+		return nil, errors.New("no state available")
+	}
+	cp := v3.V3{
+		List:       c.V3.List,
+		LastChosen: c.V3.LastChosen,
+		Discovery:  discovery.Discovery{Config: c.V3.Discovery.Copy().Config},
+	}
+	b, err := json.MarshalIndent(Versioned{V3: &cp}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []byte(log.Redact(string(b))), nil
 }
 
 // Load loads the state file from disk
+// If the state file cannot be parsed, it is kept as state.json.corrupt, restored from the backup and Recovered is set
+// If there is no usable backup, the state is left empty and Recovered wraps ErrNoBackup
 func (c *Config) Load() error {
 	bts, err := os.ReadFile(c.filename())
 	if err != nil {
 		return err
 	}
-	var buf Versioned
-	if err = json.Unmarshal(bts, &buf); err != nil {
-		return err
+	cfg, perr := parse(bts)
+	if perr == nil {
+		if cfg != nil {
+			c.V3 = cfg
+		}
+		return nil
+	}
+	// a newer state file is not corrupt, it must be left alone
+	if errors.Is(perr, ErrNewerVersion) {
+		log.Logger.Errorf("the state file cannot be loaded and changes are not saved: %v", perr)
+		c.newer = true
+		c.Recovered = perr
+		return nil
+	}
+	// keep the corrupt file around for debugging and such that it is never lost by the next save
+	if err = util.WriteFileAtomic(path.Join(c.directory, corruptFile), bts); err != nil {
+		log.Logger.Warningf("failed to keep the corrupt state file: %v", err)
+	}
+	bbts, err := os.ReadFile(c.backupFilename())
+	if err == nil {
+		cfg, err = parse(bbts)
 	}
-	if buf.V2 != nil {
-		c.V2 = buf.V2
+	if err != nil {
+		log.Logger.Errorf("the state file could not be parsed: %v and it could not be restored from the backup: %v", perr, err)
+		c.Recovered = fmt.Errorf("%w, failed to parse state file: %v and its backup: %v", ErrNoBackup, perr, err)
 		return nil
 	}
-	if buf.V1 != nil {
-		c.V2 = v2.FromV1(buf.V1)
+	if err = util.WriteFileAtomic(c.filename(), bbts); err != nil {
+		log.Logger.Warningf("failed to restore the state file from the backup: %v", err)
+	}
+	log.Logger.Warningf("the state file could not be parsed and was restored from the backup: %v", perr)
+	if cfg != nil {
+		c.V3 = cfg
 	}
+	c.Recovered = perr
 	return nil
 }
 
 // Versioned is the final top-level state file that is written to disk
+// Older versions are converted to the current version using the migrations
 type Versioned struct {
-	// V1 is the version 1 state file that is no longer used but converted from
-	V1 *v1.V1 `json:"v1,omitempty"`
-	// V2 is the version 2 state file
+	// V2 is the version 2 state file, it is only written for older versions of the library and never read when V3 is present
 	V2 *v2.V2 `json:"v2,omitempty"`
+	// V3 is the version 3 state file
+	V3 *v3.V3 `json:"v3,omitempty"`
 }
 
 // NewFromDirectory creates a new config struct from a directory
@@ -87,8 +206,8 @@ func NewFromDirectory(dir string) *Config {
 	if err != nil {
 		log.Logger.Debugf("failed to load configuration: %v", err)
 	}
-	if cfg.V2 == nil {
-		cfg.V2 = &v2.V2{}
+	if cfg.V3 == nil {
+		cfg.V3 = &v3.V3{}
 	}
 	return &cfg
 }
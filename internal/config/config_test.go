@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
+	"github.com/eduvpn/eduvpn-common/types/server"
+)
+
+func TestSaveRecover(t *testing.T) {
+	dir := t.TempDir()
+	cfg := NewFromDirectory(dir)
+	key := v3.ServerKey{T: server.TypeCustom, ID: "https://example.com/"}
+	cfg.V3.List = map[v3.ServerKey]*v3.Server{key: {}}
+	// save twice so that the first save becomes the backup
+	for i := 0; i < 2; i++ {
+		if err := cfg.Save(); err != nil {
+			t.Fatalf("failed to save config: %v", err)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, backupFile)); err != nil {
+		t.Fatalf("no backup file after saving: %v", err)
+	}
+	// no temporary files are left behind
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	if len(ents) != 2 {
+		t.Fatalf("expected only the state and backup file, got: %v entries", len(ents))
+	}
+
+	// simulate a crash mid-write
+	if err = os.WriteFile(path.Join(dir, stateFile), []byte(`{"v3": {"server_list": {`), 0o600); err != nil {
+		t.Fatalf("failed to corrupt state file: %v", err)
+	}
+	got := NewFromDirectory(dir)
+	if got.Recovered == nil {
+		t.Fatalf("expected the state file to be recovered")
+	}
+	if _, ok := got.V3.List[key]; !ok {
+		t.Fatalf("server not found in recovered state file: %v", got.V3.List)
+	}
+	if _, err = os.Stat(path.Join(dir, corruptFile)); err != nil {
+		t.Fatalf("corrupt state file was not kept: %v", err)
+	}
+
+	// the restored state file loads normally
+	got = NewFromDirectory(dir)
+	if got.Recovered != nil {
+		t.Fatalf("expected no recovery for the restored state file, got: %v", got.Recovered)
+	}
+}
+
+func TestSaveDowngrade(t *testing.T) {
+	dir := t.TempDir()
+	cfg := NewFromDirectory(dir)
+	key := v3.ServerKey{T: server.TypeCustom, ID: "https://example.com/"}
+	cfg.V3.List = map[v3.ServerKey]*v3.Server{key: {Base: v3.Base{CountryCode: "nl"}, Preferences: v3.Preferences{Nickname: "a"}}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	b, err := os.ReadFile(path.Join(dir, stateFile))
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	// an older version of the library only reads version 2
+	var old struct {
+		V2 *v2.V2 `json:"v2"`
+	}
+	if err = json.Unmarshal(b, &old); err != nil {
+		t.Fatalf("failed to parse state file as version 2: %v", err)
+	}
+	if old.V2 == nil || old.V2.List[key] == nil || old.V2.List[key].CountryCode != "nl" {
+		t.Fatalf("server not found in the version 2 state: %s", b)
+	}
+	// version 3 is still preferred when loading
+	got := NewFromDirectory(dir)
+	if srv := got.V3.List[key]; srv == nil || srv.Preferences.Nickname != "a" {
+		t.Fatalf("server preferences not loaded from version 3: %v", got.V3.List)
+	}
+}
+
+func TestLoadCorruptNoBackup(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, stateFile), []byte(`{`), 0o600); err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+	cfg := NewFromDirectory(dir)
+	if !errors.Is(cfg.Recovered, ErrNoBackup) {
+		t.Fatalf("recovered error not equal, got: %v, want: %v", cfg.Recovered, ErrNoBackup)
+	}
+	if len(cfg.V3.List) != 0 {
+		t.Fatalf("expected an empty config, got: %v", cfg.V3.List)
+	}
+	// the corrupt state file is kept before it is overwritten
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	got, err := os.ReadFile(path.Join(dir, corruptFile))
+	if err != nil {
+		t.Fatalf("corrupt state file was not kept: %v", err)
+	}
+	if string(got) != "{" {
+		t.Fatalf("corrupt state file not equal, got: %s, want: {", got)
+	}
+}
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	l1, err := NewLock(dir)
+	if err != nil {
+		t.Fatalf("failed to lock: %v", err)
+	}
+	// locks in the same process are shared
+	l2, err := NewLock(dir)
+	if err != nil {
+		t.Fatalf("failed to lock a second time in the same process: %v", err)
+	}
+	if err = l1.Release(); err != nil {
+		t.Fatalf("failed to release first lock: %v", err)
+	}
+	fn := l2.filename
+	if _, ok := locks[fn]; !ok {
+		t.Fatalf("lock released while still in use")
+	}
+	if err = l2.Release(); err != nil {
+		t.Fatalf("failed to release second lock: %v", err)
+	}
+	if _, ok := locks[fn]; ok {
+		t.Fatalf("lock not released")
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/eduvpn/eduvpn-common/internal/util"
+)
+
+const lockFile = "state.lock"
+
+// ErrLocked is returned when the state directory is locked by another process
+var ErrLocked = errors.New("the state directory is in use by another process")
+
+// lockEntry is an advisory lock on a state directory that is held by this process
+type lockEntry struct {
+	f *os.File
+	// refs is the number of Lock structs in this process that use this lock
+	refs int
+}
+
+var (
+	// locks are the directory locks held by this process, keyed by the full path of the lock file
+	// The OS lock is exclusive between processes, clients in the same process share it
+	locks   = make(map[string]*lockEntry)
+	locksMu sync.Mutex
+)
+
+// Lock is an advisory lock on the state directory
+// It prevents multiple processes from writing the same state file
+type Lock struct {
+	filename string
+	released bool
+}
+
+// NewLock locks the state directory `dir`
+// It returns ErrLocked if another process holds the lock
+func NewLock(dir string) (*Lock, error) {
+	if err := util.EnsureDirectory(dir); err != nil {
+		return nil, err
+	}
+	fn, err := filepath.Abs(filepath.Join(dir, lockFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the lock file path: %w", err)
+	}
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if e, ok := locks[fn]; ok {
+		e.refs++
+		return &Lock{filename: fn}, nil
+	}
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the lock file: %w", err)
+	}
+	if err = lockFileHandle(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	locks[fn] = &lockEntry{f: f, refs: 1}
+	return &Lock{filename: fn}, nil
+}
+
+// Release releases the lock
+// The OS lock is only released if no other lock in this process uses it
+func (l *Lock) Release() error {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if l.released {
+		return nil
+	}
+	l.released = true
+	e, ok := locks[l.filename]
+	if !ok {
+		return nil
+	}
+	e.refs--
+	if e.refs > 0 {
+		return nil
+	}
+	delete(locks, l.filename)
+	err := unlockFileHandle(e.f)
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
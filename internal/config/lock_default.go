@@ -0,0 +1,27 @@
+//go:build !windows
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFileHandle takes an exclusive non-blocking advisory lock on file `f`
+func lockFileHandle(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock the state directory: %w", err)
+	}
+	return nil
+}
+
+// unlockFileHandle releases the advisory lock on file `f`
+func unlockFileHandle(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eduvpn/eduvpn-common/internal/config/v1"
+	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
+)
+
+// Version is the current version of the state file
+const Version = 3
+
+// ErrNewerVersion is returned when the state file was written by a newer version of the library
+// Such a state file is never overwritten as that would lose the data of the newer version
+var ErrNewerVersion = errors.New("the state file was written by a newer version")
+
+// migration converts the raw JSON state of version `from` into the raw JSON state of version `from+1`
+type migration struct {
+	from    int
+	migrate func(json.RawMessage) (json.RawMessage, error)
+}
+
+// migrations is the ordered chain of migrations
+// When a new version is added, a migration from the previous version must be registered here and Version must be increased
+var migrations = []migration{
+	{from: 1, migrate: migrateV1},
+	{from: 2, migrate: migrateV2},
+}
+
+func migrateV1(raw json.RawMessage) (json.RawMessage, error) {
+	var ver1 v1.V1
+	if err := json.Unmarshal(raw, &ver1); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v2.FromV1(&ver1))
+}
+
+func migrateV2(raw json.RawMessage) (json.RawMessage, error) {
+	var ver2 v2.V2
+	if err := json.Unmarshal(raw, &ver2); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v3.FromV2(&ver2))
+}
+
+// versionKey returns the top-level JSON key for version `v`, e.g. "v3"
+func versionKey(v int) string {
+	return "v" + strconv.Itoa(v)
+}
+
+// latest returns the highest version and its raw state from the top-level versioned JSON object
+// A version of 0 means that no version was found
+func latest(vers map[string]json.RawMessage) (int, json.RawMessage, error) {
+	ver := 0
+	var raw json.RawMessage
+	for k, v := range vers {
+		if !strings.HasPrefix(k, "v") {
+			continue
+		}
+		n, err := strconv.Atoi(k[1:])
+		if err != nil || n <= 0 {
+			return 0, nil, fmt.Errorf("invalid state file version: '%s'", k)
+		}
+		if n > ver {
+			ver = n
+			raw = v
+		}
+	}
+	return ver, raw, nil
+}
+
+// migrate migrates the raw state `raw` of version `from` to the current version
+func migrate(from int, raw json.RawMessage) (json.RawMessage, error) {
+	if from > Version {
+		return nil, fmt.Errorf("%w, version: %d, supported version: %d", ErrNewerVersion, from, Version)
+	}
+	for _, m := range migrations {
+		if m.from < from {
+			continue
+		}
+		if m.from != from {
+			return nil, fmt.Errorf("no migration registered from state file version: %d", from)
+		}
+		var err error
+		raw, err = m.migrate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate state file from version: %d with error: %w", from, err)
+		}
+		from++
+	}
+	if from != Version {
+		return nil, fmt.Errorf("no migration registered from state file version: %d", from)
+	}
+	return raw, nil
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
+	"github.com/eduvpn/eduvpn-common/internal/test"
+	"github.com/eduvpn/eduvpn-common/types/server"
+)
+
+func TestMigrateV1(t *testing.T) {
+	raw := `
+{
+    "servers": {
+	"custom_servers": {
+	    "map": {
+		"https://example.com/": {
+		    "base": {
+			"base_url": "https://example.com/",
+			"profiles": {"current_profile": "a"}
+		    },
+		    "profiles": {"current_profile": "a"}
+		}
+	    },
+	    "current_url": "https://example.com/"
+	},
+	"is_secure_internet": 3
+    }
+}
+`
+	got, err := migrateV1(json.RawMessage(raw))
+	if err != nil {
+		t.Fatalf("failed to migrate v1: %v", err)
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(got, &m); err != nil {
+		t.Fatalf("failed to parse migrated v1: %v", err)
+	}
+	if m["last_chosen_id"] == nil {
+		t.Fatalf("last chosen not migrated from v1: %s", got)
+	}
+	if _, ok := m["server_list"].(map[string]interface{})["3,https://example.com/"]; !ok {
+		t.Fatalf("server not migrated from v1: %s", got)
+	}
+}
+
+func TestMigrateV2(t *testing.T) {
+	raw := `
+{
+    "server_list": {
+	"1,https://institute.example.com/": {
+	    "profiles": {"current": "a"},
+	    "country_code": ""
+	}
+    },
+    "last_chosen_id": "1,https://institute.example.com/"
+}
+`
+	got, err := migrateV2(json.RawMessage(raw))
+	if err != nil {
+		t.Fatalf("failed to migrate v2: %v", err)
+	}
+	var ver3 v3.V3
+	if err = json.Unmarshal(got, &ver3); err != nil {
+		t.Fatalf("failed to parse migrated v2: %v", err)
+	}
+	key := v3.ServerKey{T: server.TypeInstituteAccess, ID: "https://institute.example.com/"}
+	want := &v3.Server{Base: v3.Base{Profiles: server.Profiles{Current: "a"}}}
+	if !reflect.DeepEqual(ver3.List[key], want) {
+		t.Fatalf("servers not equal, got: %v, want: %v", ver3.List[key], want)
+	}
+	if ver3.LastChosen == nil || *ver3.LastChosen != key {
+		t.Fatalf("last chosen not equal, got: %v, want: %v", ver3.LastChosen, key)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		json    string
+		want    int
+		wantErr string
+	}{
+		{json: `{}`, want: 0},
+		{json: `{"v1": {"servers": {"custom_servers": {"map": {"https://a.example.com/": {}}}}}}`, want: 1},
+		{json: `{"v2": {"server_list": {"3,https://a.example.com/": {}}}}`, want: 1},
+		{json: `{"v3": {"server_list": {"3,https://a.example.com/": {"preferences": {"nickname": "a"}}}}}`, want: 1},
+		// the newest version wins
+		{json: `{"v2": {"server_list": {}}, "v3": {"server_list": {"3,https://a.example.com/": {}}}}`, want: 1},
+		{json: `{"vx": {}}`, wantErr: "invalid state file version: 'vx'"},
+		{json: `{"v4": {}}`, wantErr: "the state file was written by a newer version, version: 4, supported version: 3"},
+	}
+
+	for _, c := range cases {
+		got, err := parse([]byte(c.json))
+		test.AssertError(t, err, c.wantErr)
+		if err != nil {
+			continue
+		}
+		n := 0
+		if got != nil {
+			n = len(got.List)
+		}
+		if n != c.want {
+			t.Fatalf("number of servers not equal for: %s, got: %d, want: %d", c.json, n, c.want)
+		}
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	newer := []byte(`{"v4": {"server_list": {}}}`)
+	if err := os.WriteFile(path.Join(dir, stateFile), newer, 0o600); err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+	cfg := NewFromDirectory(dir)
+	if !errors.Is(cfg.Recovered, ErrNewerVersion) {
+		t.Fatalf("recovered error not equal, got: %v, want: %v", cfg.Recovered, ErrNewerVersion)
+	}
+	if err := cfg.Save(); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("expected a newer version error when saving, got: %v", err)
+	}
+	b, err := os.ReadFile(path.Join(dir, stateFile))
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	if string(b) != string(newer) {
+		t.Fatalf("newer state file was overwritten: %s", b)
+	}
+}
@@ -58,7 +58,7 @@ func FromV1(ver1 *v1.V1) *V2 {
 	// if the home organization ID is filled we have secure internet present
 	if sec.HomeOrganizationID == "" {
 		return &V2{
-			Discovery:  ver1.Discovery,
+			Discovery:  ver1.Discovery.Copy(),
 			List:       res,
 			LastChosen: lc,
 		}
@@ -82,7 +82,7 @@ func FromV1(ver1 *v1.V1) *V2 {
 		}
 	}
 	return &V2{
-		Discovery:  ver1.Discovery,
+		Discovery:  ver1.Discovery.Copy(),
 		List:       res,
 		LastChosen: lc,
 	}
@@ -0,0 +1,47 @@
+package v3
+
+import (
+	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+)
+
+// FromV2 converts a version 2 state struct into a v3 one
+// The preferences are empty and the history is not known for the existing servers
+func FromV2(ver2 *v2.V2) *V3 {
+	var list map[ServerKey]*Server
+	if ver2.List != nil {
+		list = make(map[ServerKey]*Server, len(ver2.List))
+	}
+	for k, v := range ver2.List {
+		if v == nil {
+			continue
+		}
+		list[k] = &Server{Base: *v}
+	}
+	return &V3{
+		List:       list,
+		LastChosen: ver2.LastChosen,
+		Discovery:  ver2.Discovery.Copy(),
+	}
+}
+
+// ToV2 converts a version 3 state struct into a v2 one
+// This is written next to version 3 such that older versions of the library that only know version 2 keep the servers
+// The preferences and the history are lost
+func ToV2(ver3 *V3) *v2.V2 {
+	var list map[ServerKey]*v2.Server
+	if ver3.List != nil {
+		list = make(map[ServerKey]*v2.Server, len(ver3.List))
+	}
+	for k, v := range ver3.List {
+		if v == nil {
+			continue
+		}
+		b := v.Base
+		list[k] = &b
+	}
+	return &v2.V2{
+		List:       list,
+		LastChosen: ver3.LastChosen,
+		Discovery:  ver3.Discovery.Copy(),
+	}
+}
@@ -0,0 +1,23 @@
+package v3
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddHistory(t *testing.T) {
+	srv := Server{}
+	for i := 0; i < maxHistory+5; i++ {
+		srv.AddHistory(Connection{Time: time.Unix(int64(i), 0)})
+	}
+	if len(srv.History) != maxHistory {
+		t.Fatalf("history length not equal, got: %d, want: %d", len(srv.History), maxHistory)
+	}
+	// the oldest connections are removed
+	if got := srv.History[0].Time.Unix(); got != 5 {
+		t.Fatalf("oldest connection not equal, got: %d, want: 5", got)
+	}
+	if got := srv.History[maxHistory-1].Time.Unix(); got != maxHistory+4 {
+		t.Fatalf("newest connection not equal, got: %d, want: %d", got, maxHistory+4)
+	}
+}
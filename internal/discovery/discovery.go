@@ -4,10 +4,14 @@ package discovery
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
-	"github.com/eduvpn/eduvpn-common/internal/http"
+	httpw "github.com/eduvpn/eduvpn-common/internal/http"
+	"github.com/eduvpn/eduvpn-common/internal/log"
 	"github.com/eduvpn/eduvpn-common/internal/verify"
 	discotypes "github.com/eduvpn/eduvpn-common/types/discovery"
 )
@@ -17,60 +21,142 @@ var HasCache bool
 
 // Discovery is the main structure used for this package.
 type Discovery struct {
+	// mu guards the fields below, the lists are refreshed while other goroutines search them
+	mu sync.RWMutex
+
+	// gen is incremented when the config is set, such that a list fetched from the previous source is not stored
+	gen uint64
+
 	// The httpClient for sending HTTP requests
-	httpClient *http.Client
+	httpClient *httpw.Client
 
 	// OrganizationList represents the organizations that are returned by the discovery server
 	OrganizationList discotypes.Organizations `json:"organizations"`
 
 	// ServerList represents the servers that are returned by the discovery server
 	ServerList discotypes.Servers `json:"servers"`
+
+	// Config is the configuration of the discovery source, the defaults are used if it is empty
+	Config discotypes.Config `json:"config"`
+
+	// index is the search index, it is built on the first search
+	index *searchIndex
 }
 
-// DiscoURL is the URL used for fetching the discovery files and signatures
+// DiscoURL is the default URL used for fetching the discovery files and signatures
 var DiscoURL = "https://disco.eduvpn.org/v2/"
 
-// file is a helper function that gets a disco JSON and fills the structure with it
-// If it was unsuccessful it returns an error.
-func (discovery *Discovery) file(ctx context.Context, jsonFile string, previousVersion uint64, structure interface{}) error {
+// source is what is needed to fetch a discovery file
+// It is taken under the lock such that the file can be fetched without holding it
+type source struct {
+	httpClient *httpw.Client
+	cfg        discotypes.Config
+	gen        uint64
+}
+
+// source returns the current source, the HTTP client is created if it does not exist yet
+// The caller must hold the write lock
+func (discovery *Discovery) source() source {
 	// No HTTP client present, create one
 	if discovery.httpClient == nil {
-		discovery.httpClient = http.NewClient(nil)
+		discovery.httpClient = httpw.NewClient(nil)
+	}
+	return source{
+		httpClient: discovery.httpClient,
+		cfg:        discovery.Config,
+		gen:        discovery.gen,
+	}
+}
+
+// url returns the configured URL for fetching the discovery files and signatures
+func (src source) url() string {
+	if src.cfg.URL != "" {
+		return src.cfg.URL
+	}
+	return DiscoURL
+}
+
+// isDefault returns whether or not the discovery source is the default one
+// Only then the embedded cache can be used
+func (discovery *Discovery) isDefault() bool {
+	return discovery.Config.URL == "" && len(discovery.Config.Keys) == 0
+}
+
+// SetConfig sets the configuration of the discovery source
+// The cached organizations and servers are removed as they are from the previous source
+func (discovery *Discovery) SetConfig(cfg discotypes.Config) {
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
+	discovery.gen++
+	discovery.Config = cfg
+	discovery.OrganizationList = discotypes.Organizations{}
+	discovery.ServerList = discotypes.Servers{}
+}
+
+// errNotModified is returned when the discovery file has not changed since it was last downloaded
+var errNotModified = errors.New("discovery file not modified")
+
+// conditionalHeaders returns the headers for a conditional request using the validators `v`
+// It returns nil if there are no validators
+func conditionalHeaders(v discotypes.Validators) http.Header {
+	h := http.Header{}
+	if v.ETag != "" {
+		h.Set("If-None-Match", v.ETag)
 	}
+	if v.LastModified != "" {
+		h.Set("If-Modified-Since", v.LastModified)
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
 
+// file is a helper function that gets a disco JSON and fills the structure with it
+// If the validators `v` are non-empty a conditional request is sent, if the file has not changed errNotModified is returned
+// On success the validators are updated with the ones from the response.
+// If it was unsuccessful it returns an error.
+func (src source) file(ctx context.Context, jsonFile string, previousVersion uint64, v *discotypes.Validators, structure interface{}) error {
 	// Get json data
-	jsonURL, err := http.JoinURLPath(DiscoURL, jsonFile)
+	jsonURL, err := httpw.JoinURLPath(src.url(), jsonFile)
 	if err != nil {
 		return err
 	}
-	_, body, err := discovery.httpClient.Get(ctx, jsonURL)
+	opts := &httpw.OptionalParams{Headers: conditionalHeaders(*v)}
+	log.Logger.Debugf("[Discovery] getting: '%s', previous version: %d, ETag: '%s', Last-Modified: '%s'", jsonURL, previousVersion, v.ETag, v.LastModified)
+	hdrs, body, err := src.httpClient.Do(ctx, http.MethodGet, jsonURL, opts)
 	if err != nil {
+		var se *httpw.StatusError
+		if errors.As(err, &se) && se.Status == http.StatusNotModified {
+			log.Logger.Debugf("[Discovery] '%s' is not modified", jsonFile)
+			return errNotModified
+		}
 		return err
 	}
 
 	// Get signature
 	sigFile := jsonFile + ".minisig"
-	sigURL, err := http.JoinURLPath(DiscoURL, sigFile)
+	sigURL, err := httpw.JoinURLPath(src.url(), sigFile)
 	if err != nil {
 		return err
 	}
-	_, sigBody, err := discovery.httpClient.Get(ctx, sigURL)
+	_, sigBody, err := src.httpClient.Get(ctx, sigURL)
 	if err != nil {
 		return err
 	}
 
-	// Verify signature
-	// Set this to true when we want to force prehash
-	const forcePrehash = false
+	// Verify signature with the configured keys
 	ok, err := verify.Verify(
 		string(sigBody),
 		body,
 		jsonFile,
 		previousVersion,
-		forcePrehash,
+		src.cfg.Keys,
+		src.cfg.ForcePrehash,
 	)
 
 	if !ok || err != nil {
+		log.Logger.Debugf("[Discovery] signature verification of: '%s' failed with error: %v", jsonFile, err)
 		return err
 	}
 
@@ -78,12 +164,19 @@ func (discovery *Discovery) file(ctx context.Context, jsonFile string, previousV
 	if err = json.Unmarshal(body, structure); err != nil {
 		return fmt.Errorf("failed parsing discovery file: '%s' from the server with error: %w", jsonFile, err)
 	}
+	*v = discotypes.Validators{
+		ETag:         hdrs.Get("ETag"),
+		LastModified: hdrs.Get("Last-Modified"),
+	}
+	log.Logger.Debugf("[Discovery] updated: '%s', ETag: '%s', Last-Modified: '%s'", jsonFile, v.ETag, v.LastModified)
 
 	return nil
 }
 
 // MarkOrganizationsExpired marks the organizations as expired
 func (discovery *Discovery) MarkOrganizationsExpired() {
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
 	// Re-initialize the timestamp to zero
 	discovery.OrganizationList.Timestamp = time.Time{}
 }
@@ -96,11 +189,20 @@ func (discovery *Discovery) MarkOrganizationsExpired() {
 // - [IMPLEMENTED in client/server.go] when the authorization for the server associated with an already chosen organization is triggered, e.g. after expiry or revocation.
 // - [IMPLEMENTED using a custom error message, and in client/server.go] NOTE: when the org_id that the user chose previously is no longer available in organization_list.json the application should ask the user to choose their organization (again). This can occur for example when the organization replaced their identity provider, uses a different domain after rebranding or simply ceased to exist.
 func (discovery *Discovery) DetermineOrganizationsUpdate() bool {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
+	return discovery.determineOrganizationsUpdate()
+}
+
+// determineOrganizationsUpdate is DetermineOrganizationsUpdate without taking the lock
+func (discovery *Discovery) determineOrganizationsUpdate() bool {
 	return discovery.OrganizationList.Timestamp.IsZero()
 }
 
 // SecureLocationList returns a slice of all the available locations.
 func (discovery *Discovery) SecureLocationList() []string {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
 	var loc []string
 	for _, srv := range discovery.ServerList.List {
 		if srv.Type == "secure_internet" {
@@ -116,6 +218,13 @@ func (discovery *Discovery) ServerByURL(
 	baseURL string,
 	srvType string,
 ) (*discotypes.Server, error) {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
+	return discovery.serverByURL(baseURL, srvType)
+}
+
+// serverByURL is ServerByURL without taking the lock
+func (discovery *Discovery) serverByURL(baseURL string, srvType string) (*discotypes.Server, error) {
 	for _, currentServer := range discovery.ServerList.List {
 		if currentServer.BaseURL == baseURL && currentServer.Type == srvType {
 			return &currentServer, nil
@@ -136,6 +245,8 @@ func (cnf *ErrCountryNotFound) Error() string {
 // ServerByCountryCode returns the discovery server by the country code
 // An error is returned if and only if nil is returned for the server.
 func (discovery *Discovery) ServerByCountryCode(countryCode string) (*discotypes.Server, error) {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
 	for _, srv := range discovery.ServerList.List {
 		if srv.CountryCode == countryCode && srv.Type == "secure_internet" {
 			return &srv, nil
@@ -160,14 +271,17 @@ func (discovery *Discovery) orgByID(orgID string) (*discotypes.Organization, err
 // - The secure internet server itself
 // An error is returned if and only if nil is returned for the organization.
 func (discovery *Discovery) SecureHomeArgs(orgID string) (*discotypes.Organization, *discotypes.Server, error) {
+	discovery.mu.RLock()
 	org, err := discovery.orgByID(orgID)
 	if err != nil {
+		discovery.mu.RUnlock()
 		discovery.MarkOrganizationsExpired()
 		return nil, nil, err
 	}
+	defer discovery.mu.RUnlock()
 
 	// Get a server with the base url
-	srv, err := discovery.ServerByURL(org.SecureInternetHome, "secure_internet")
+	srv, err := discovery.serverByURL(org.SecureInternetHome, "secure_internet")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -179,6 +293,13 @@ func (discovery *Discovery) SecureHomeArgs(orgID string) (*discotypes.Organizati
 // - [Implemented] The application MUST always fetch the server_list.json at application start.
 // - The application MAY refresh the server_list.json periodically, e.g. once every hour.
 func (discovery *Discovery) DetermineServersUpdate() bool {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
+	return discovery.determineServersUpdate()
+}
+
+// determineServersUpdate is DetermineServersUpdate without taking the lock
+func (discovery *Discovery) determineServersUpdate() bool {
 	// No servers, we should update
 	if discovery.ServerList.Timestamp.IsZero() {
 		return true
@@ -188,71 +309,163 @@ func (discovery *Discovery) DetermineServersUpdate() bool {
 	return !time.Now().Before(upd)
 }
 
-func (discovery *Discovery) previousOrganizations() (*discotypes.Organizations, error) {
+// previousOrganizations fills the organizations with the embedded cache if there is no cached list yet
+// The caller must hold the write lock
+func (discovery *Discovery) previousOrganizations() error {
 	// If the version field is not zero then we have a cached struct
-	// We also immediately return this copy if we have no embedded JSON
-	if discovery.OrganizationList.Version != 0 || !HasCache {
-		return &discovery.OrganizationList, nil
+	// We also immediately return if we have no embedded JSON or if the embedded JSON is from another source
+	if discovery.OrganizationList.Version != 0 || !HasCache || !discovery.isDefault() {
+		return nil
 	}
 
 	// We do not have a cached struct, this we need to get it using the embedded JSON
 	var eo discotypes.Organizations
 	if err := json.Unmarshal(eOrganizations, &eo); err != nil {
-		return nil, fmt.Errorf("failed parsing discovery organizations from the embedded cache with error: %w", err)
+		return fmt.Errorf("failed parsing discovery organizations from the embedded cache with error: %w", err)
 	}
 	discovery.OrganizationList = eo
-	return &eo, nil
+	return nil
 }
 
-func (discovery *Discovery) previousServers() (*discotypes.Servers, error) {
+// previousServers fills the servers with the embedded cache if there is no cached list yet
+// The caller must hold the write lock
+func (discovery *Discovery) previousServers() error {
 	// If the version field is not zero then we have a cached struct
-	// We also immediately return this copy if we have no embedded JSON
-	if discovery.ServerList.Version != 0 || !HasCache {
-		return &discovery.ServerList, nil
+	// We also immediately return if we have no embedded JSON or if the embedded JSON is from another source
+	if discovery.ServerList.Version != 0 || !HasCache || !discovery.isDefault() {
+		return nil
 	}
 
 	// We do not have a cached struct, this we need to get it using the embedded JSON
 	var es discotypes.Servers
 	if err := json.Unmarshal(eServers, &es); err != nil {
-		return nil, fmt.Errorf("failed parsing discovery servers from the embedded cache with error: %w", err)
+		return fmt.Errorf("failed parsing discovery servers from the embedded cache with error: %w", err)
 	}
 	discovery.ServerList = es
-	return &es, nil
+	return nil
 }
 
-// Organizations returns the discovery organizations
+// Organizations returns a copy of the discovery organizations
+// The file is fetched without holding the lock, the new list replaces the cached one afterwards
 // If there was an error, a cached copy is returned if available.
 func (discovery *Discovery) Organizations(ctx context.Context) (*discotypes.Organizations, error) {
-	if !discovery.DetermineOrganizationsUpdate() {
-		return &discovery.OrganizationList, nil
+	discovery.mu.Lock()
+	if !discovery.determineOrganizationsUpdate() {
+		orgs := discovery.OrganizationList
+		discovery.mu.Unlock()
+		return &orgs, nil
 	}
-	file := "organization_list.json"
-	err := discovery.file(ctx, file, discovery.OrganizationList.Version, &discovery.OrganizationList)
-	if err != nil {
+	src := discovery.source()
+	prev := discovery.OrganizationList
+	discovery.mu.Unlock()
+
+	// the list is parsed into a new struct as the cached one can be read concurrently
+	next := discotypes.Organizations{Validators: prev.Validators}
+	err := src.file(ctx, "organization_list.json", prev.Version, &next.Validators, &next)
+
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
+	switch {
+	case src.gen != discovery.gen:
+		// The config was set while fetching, the list is from the previous source
+		log.Logger.Debugf("[Discovery] the source changed while getting the organizations, not storing them")
+		if errors.Is(err, errNotModified) {
+			err = nil
+		}
+	case errors.Is(err, errNotModified):
+		// Nothing changed, the cached copy is still up to date
+		discovery.OrganizationList.Timestamp = time.Now()
+		err = nil
+	case err != nil:
 		// Return previous with an error
-		// TODO: Log here if we fail to get previous
-		orgs, _ := discovery.previousOrganizations()
-		return orgs, err
+		if perr := discovery.previousOrganizations(); perr != nil {
+			log.Logger.Warningf("[Discovery] failed to get the previous organizations: %v", perr)
+			return nil, err
+		}
+	default:
+		next.Timestamp = time.Now()
+		discovery.OrganizationList = next
 	}
-	discovery.OrganizationList.Timestamp = time.Now()
-	return &discovery.OrganizationList, nil
+	orgs := discovery.OrganizationList
+	return &orgs, err
 }
 
-// Servers returns the discovery servers
+// Servers returns a copy of the discovery servers
+// The file is fetched without holding the lock, the new list replaces the cached one afterwards
 // If there was an error, a cached copy is returned if available.
 func (discovery *Discovery) Servers(ctx context.Context) (*discotypes.Servers, error) {
-	if !discovery.DetermineServersUpdate() {
-		return &discovery.ServerList, nil
+	discovery.mu.Lock()
+	if !discovery.determineServersUpdate() {
+		srvs := discovery.ServerList
+		discovery.mu.Unlock()
+		return &srvs, nil
 	}
-	file := "server_list.json"
-	err := discovery.file(ctx, file, discovery.ServerList.Version, &discovery.ServerList)
-	if err != nil {
+	src := discovery.source()
+	prev := discovery.ServerList
+	discovery.mu.Unlock()
+
+	// the list is parsed into a new struct as the cached one can be read concurrently
+	next := discotypes.Servers{Validators: prev.Validators}
+	err := src.file(ctx, "server_list.json", prev.Version, &next.Validators, &next)
+
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
+	switch {
+	case src.gen != discovery.gen:
+		// The config was set while fetching, the list is from the previous source
+		log.Logger.Debugf("[Discovery] the source changed while getting the servers, not storing them")
+		if errors.Is(err, errNotModified) {
+			err = nil
+		}
+	case errors.Is(err, errNotModified):
+		// Nothing changed, the cached copy is still up to date
+		discovery.ServerList.Timestamp = time.Now()
+		err = nil
+	case err != nil:
 		// Return previous with an error
-		// TODO: Log here if we fail to get previous
-		srvs, _ := discovery.previousServers()
-		return srvs, err
+		if perr := discovery.previousServers(); perr != nil {
+			log.Logger.Warningf("[Discovery] failed to get the previous servers: %v", perr)
+			return nil, err
+		}
+	default:
+		// Update servers timestamp
+		next.Timestamp = time.Now()
+		discovery.ServerList = next
 	}
-	// Update servers timestamp
-	discovery.ServerList.Timestamp = time.Now()
-	return &discovery.ServerList, nil
+	srvs := discovery.ServerList
+	return &srvs, err
+}
+
+// Lists returns a copy of the cached organizations and servers without contacting the discovery server
+func (discovery *Discovery) Lists() (discotypes.Organizations, discotypes.Servers) {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
+	return discovery.OrganizationList, discovery.ServerList
+}
+
+// Copy returns a new discovery struct with a copy of the cached lists and the config
+// This is used instead of copying the struct itself as it contains a lock
+func (discovery *Discovery) Copy() Discovery {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
+	return Discovery{
+		OrganizationList: discovery.OrganizationList,
+		ServerList:       discovery.ServerList,
+		Config:           discovery.Config,
+	}
+}
+
+// MarshalJSON marshals the cached lists and the config under the lock as they can be refreshed concurrently
+func (discovery *Discovery) MarshalJSON() ([]byte, error) {
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
+	return json.Marshal(struct {
+		OrganizationList discotypes.Organizations `json:"organizations"`
+		ServerList       discotypes.Servers       `json:"servers"`
+		Config           discotypes.Config        `json:"config"`
+	}{
+		OrganizationList: discovery.OrganizationList,
+		ServerList:       discovery.ServerList,
+		Config:           discovery.Config,
+	})
 }
@@ -4,11 +4,13 @@ import (
 	"context"
 	"net/http"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/eduvpn/eduvpn-common/internal/test"
 	discotypes "github.com/eduvpn/eduvpn-common/types/discovery"
+	"github.com/eduvpn/eduvpn-common/types/server"
 )
 
 // TestServers tests whether or not we can obtain discovery servers
@@ -36,7 +38,8 @@ func TestServers(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Got a servers error after shutting down server: %v", err)
 	}
-	if s1 != s2 {
+	// a copy is returned as the cached list can be replaced concurrently
+	if !reflect.DeepEqual(s1, s2) {
 		t.Fatalf("Servers copies not equal after shutting down file server")
 	}
 
@@ -48,7 +51,7 @@ func TestServers(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Got a servers nil error after shutting down file server and expired")
 	}
-	if s1 != s3 {
+	if s1.Version != s3.Version || !reflect.DeepEqual(s1.List, s3.List) {
 		t.Fatalf("Servers copies not equal after shutting down file server and expired")
 	}
 }
@@ -78,7 +81,7 @@ func TestOrganizations(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Got an organizations error after shutting down file server: %v", err)
 	}
-	if s1 != s2 {
+	if !reflect.DeepEqual(s1, s2) {
 		t.Fatalf("Organizations copies not equal after shutting down file server")
 	}
 }
@@ -251,3 +254,181 @@ func TestSecureHomeArgs(t *testing.T) {
 		t.Fatal("Got no error, when getting non-existing secure home arguments with ID: 'id3'")
 	}
 }
+
+// TestConfig tests whether or not a discovery source with its own keys can be configured
+// It setups up a file server using the signed files from the verify package
+func TestConfig(t *testing.T) {
+	pure := false
+	files := http.FileServer(http.Dir("../verify/test_data"))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// serve the signature that is not prehashed
+		if pure && r.URL.Path == "/server_list.json.minisig" {
+			r.URL.Path = "/server_list.json.pure.minisig"
+		}
+		files.ServeHTTP(w, r)
+	})
+	s := test.NewServer(handler)
+	defer s.Close()
+	c, err := s.Client()
+	if err != nil {
+		t.Fatalf("Failed to get HTTP test client: %v", err)
+	}
+	key := "RWRMm6vfaPgH39iT++NBiUKZim2nDWnalgkNROovPbZdSwVFgUdKU4ac"
+
+	cases := []struct {
+		cfg     discotypes.Config
+		pure    bool
+		wantErr bool
+	}{
+		// the default keys do not trust the test key
+		{cfg: discotypes.Config{URL: s.URL}, wantErr: true},
+		{cfg: discotypes.Config{URL: s.URL, Keys: []string{key}}},
+		{cfg: discotypes.Config{URL: s.URL, Keys: []string{key}, ForcePrehash: true}},
+		{cfg: discotypes.Config{URL: s.URL, Keys: []string{key}}, pure: true},
+		{cfg: discotypes.Config{URL: s.URL, Keys: []string{key}, ForcePrehash: true}, pure: true, wantErr: true},
+	}
+	for i, v := range cases {
+		pure = v.pure
+		d := &Discovery{httpClient: c}
+		d.SetConfig(v.cfg)
+		_, err = d.Servers(context.Background())
+		if (err != nil) != v.wantErr {
+			t.Fatalf("Error not expected for case: %d, got: %v, want error: %v", i, err, v.wantErr)
+		}
+	}
+
+	// setting a new config removes the lists from the previous source
+	d := &Discovery{httpClient: c}
+	d.SetConfig(discotypes.Config{URL: s.URL, Keys: []string{key}})
+	if _, err = d.Organizations(context.Background()); err != nil {
+		t.Fatalf("Failed getting organizations: %v", err)
+	}
+	d.SetConfig(discotypes.Config{})
+	if d.OrganizationList.Version != 0 || len(d.OrganizationList.List) != 0 || !d.DetermineOrganizationsUpdate() {
+		t.Fatalf("Organizations not removed after setting a new config: %v", d.OrganizationList)
+	}
+}
+
+// TestConditional tests whether or not unchanged discovery files are not downloaded again
+func TestConditional(t *testing.T) {
+	etag := `"1"`
+	var files []string
+	fs := http.FileServer(http.Dir("test_files"))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files = append(files, r.URL.Path)
+		if r.URL.Path == "/server_list.json" {
+			w.Header().Set("ETag", etag)
+		}
+		fs.ServeHTTP(w, r)
+	})
+	s := test.NewServer(handler)
+	defer s.Close()
+	DiscoURL = s.URL
+	c, err := s.Client()
+	if err != nil {
+		t.Fatalf("Failed to get HTTP test client: %v", err)
+	}
+	d := &Discovery{httpClient: c}
+	if _, err = d.Servers(context.Background()); err != nil {
+		t.Fatalf("Failed getting servers: %v", err)
+	}
+	if d.ServerList.ETag != etag || d.ServerList.LastModified == "" {
+		t.Fatalf("Validators not stored, got: %v", d.ServerList.Validators)
+	}
+	version := d.ServerList.Version
+
+	cases := []struct {
+		etag  string
+		files []string
+	}{
+		// not modified, only the list is requested
+		{etag: etag, files: []string{"/server_list.json"}},
+		// modified, the signature is requested as well
+		{etag: `"2"`, files: []string{"/server_list.json", "/server_list.json.minisig"}},
+	}
+	for _, v := range cases {
+		etag = v.etag
+		files = nil
+		// Force expired, 1 hour in the past
+		d.ServerList.Timestamp = time.Now().Add(-1 * time.Hour)
+		srvs, err := d.Servers(context.Background())
+		if err != nil {
+			t.Fatalf("Failed getting servers with ETag: %s, error: %v", v.etag, err)
+		}
+		if !reflect.DeepEqual(files, v.files) {
+			t.Fatalf("Requested files not equal with ETag: %s, got: %v, want: %v", v.etag, files, v.files)
+		}
+		if srvs.Version != version || len(srvs.List) == 0 {
+			t.Fatalf("Servers not cached with ETag: %s, got: %v", v.etag, srvs)
+		}
+		if d.DetermineServersUpdate() {
+			t.Fatalf("Servers timestamp not refreshed with ETag: %s", v.etag)
+		}
+	}
+}
+
+// TestRefreshWhileSearching tests whether or not the lists can be refreshed while searching
+// and that a list from a previous source is not stored
+func TestRefreshWhileSearching(t *testing.T) {
+	started := make(chan struct{}, 1)
+	block := make(chan struct{})
+	fs := http.FileServer(http.Dir("test_files"))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/organization_list.json" {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-block
+		}
+		fs.ServeHTTP(w, r)
+	})
+	s := test.NewServer(handler)
+	defer s.Close()
+	DiscoURL = s.URL
+	c, err := s.Client()
+	if err != nil {
+		t.Fatalf("Failed to get HTTP test client: %v", err)
+	}
+	d := &Discovery{httpClient: c}
+
+	// the fetch is blocked, searching must not wait for it
+	done := make(chan error)
+	go func() {
+		_, err := d.Organizations(context.Background())
+		done <- err
+	}()
+	<-started
+	for i := 0; i < 10; i++ {
+		d.Search("surf", server.TypeUnknown)
+	}
+
+	// the source is changed while fetching
+	d.SetConfig(discotypes.Config{URL: s.URL})
+	close(block)
+	if err = <-done; err != nil {
+		t.Fatalf("Failed getting organizations: %v", err)
+	}
+	if !d.DetermineOrganizationsUpdate() {
+		t.Fatalf("Organizations from the previous source were stored")
+	}
+
+	// concurrent refreshes and searches, the fetches are no longer blocked
+	d = &Discovery{httpClient: c}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			d.MarkOrganizationsExpired()
+			if _, err := d.Organizations(context.Background()); err != nil {
+				t.Errorf("Failed getting organizations: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			d.Search("surf", server.TypeUnknown)
+		}()
+	}
+	wg.Wait()
+}
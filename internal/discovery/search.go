@@ -0,0 +1,247 @@
+package discovery
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	discotypes "github.com/eduvpn/eduvpn-common/types/discovery"
+	"github.com/eduvpn/eduvpn-common/types/server"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The scores for a single query word
+// A match in the display name is worth more than a match in the keywords
+const (
+	scoreNameExact     = 100
+	scoreNamePrefix    = 70
+	scoreNameSubstring = 30
+	scoreKeyExact      = 60
+	scoreKeyPrefix     = 40
+	scoreKeySubstring  = 15
+	// scoreFullPrefix is the bonus when a display name starts with the whole query
+	scoreFullPrefix = 50
+	// scoreFullExact is the bonus when a display name is equal to the whole query
+	scoreFullExact = 100
+)
+
+// normalize lowercases `s`, removes accents and replaces everything that is not a letter or a number with a space
+func normalize(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	r, _, err := transform.String(t, s)
+	if err != nil {
+		r = s
+	}
+	return strings.Join(strings.FieldsFunc(strings.ToLower(r), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	}), " ")
+}
+
+// searchEntry is a normalized organization or server
+type searchEntry struct {
+	// names are the normalized display names in all languages
+	names []string
+	// nameWords are the words of all display names
+	nameWords []string
+	// keyWords are the words of all keywords
+	keyWords []string
+	// sortName is the name that is used to sort equal scores
+	sortName string
+}
+
+func newSearchEntry(displayName discotypes.MapOrString, keywords discotypes.MapOrString) searchEntry {
+	e := searchEntry{}
+	seen := make(map[string]bool)
+	for _, n := range displayName {
+		nn := normalize(n)
+		if nn == "" || seen[nn] {
+			continue
+		}
+		seen[nn] = true
+		e.names = append(e.names, nn)
+		e.nameWords = append(e.nameWords, strings.Fields(nn)...)
+	}
+	sort.Strings(e.names)
+	if len(e.names) > 0 {
+		e.sortName = e.names[0]
+	}
+	for _, k := range keywords {
+		e.keyWords = append(e.keyWords, strings.Fields(normalize(k))...)
+	}
+	return e
+}
+
+// wordScore returns the best score of query word `q` in words `words`
+func wordScore(q string, words []string, exact int, prefix int, substring int) int {
+	best := 0
+	for _, w := range words {
+		switch {
+		case w == q:
+			return exact
+		case strings.HasPrefix(w, q):
+			if prefix > best {
+				best = prefix
+			}
+		case substring > best && strings.Contains(w, q):
+			best = substring
+		}
+	}
+	return best
+}
+
+// score returns the score of the entry for the normalized query `query` with words `words`
+// A score of zero means that the entry does not match
+// Every word of the query must match
+func (e *searchEntry) score(query string, words []string) int {
+	total := 0
+	for _, q := range words {
+		s := wordScore(q, e.nameWords, scoreNameExact, scoreNamePrefix, scoreNameSubstring)
+		if ks := wordScore(q, e.keyWords, scoreKeyExact, scoreKeyPrefix, scoreKeySubstring); ks > s {
+			s = ks
+		}
+		if s == 0 {
+			return 0
+		}
+		total += s
+	}
+	bonus := 0
+	for _, n := range e.names {
+		switch {
+		case n == query:
+			bonus = scoreFullExact
+		case bonus < scoreFullPrefix && strings.HasPrefix(n, query):
+			bonus = scoreFullPrefix
+		}
+	}
+	return total + bonus
+}
+
+// searchIndex is the normalized discovery lists
+// It is rebuilt when the lists change
+type searchIndex struct {
+	mu sync.Mutex
+
+	orgVersion uint64
+	orgTime    time.Time
+	orgs       []searchEntry
+
+	srvVersion uint64
+	srvTime    time.Time
+	srvs       []searchEntry
+}
+
+// indexMu guards the lazy creation of the search index of a discovery struct
+var indexMu sync.Mutex
+
+// getIndex returns the search index, it is created if it does not exist yet
+func (discovery *Discovery) getIndex() *searchIndex {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if discovery.index == nil {
+		discovery.index = &searchIndex{}
+	}
+	return discovery.index
+}
+
+// update rebuilds the index if the discovery lists have changed
+func (si *searchIndex) update(orgs *discotypes.Organizations, srvs *discotypes.Servers) {
+	if si.orgs == nil || si.orgVersion != orgs.Version || !si.orgTime.Equal(orgs.Timestamp) || len(si.orgs) != len(orgs.List) {
+		si.orgs = make([]searchEntry, len(orgs.List))
+		for i, o := range orgs.List {
+			si.orgs[i] = newSearchEntry(o.DisplayName, o.KeywordList)
+		}
+		si.orgVersion = orgs.Version
+		si.orgTime = orgs.Timestamp
+	}
+	if si.srvs == nil || si.srvVersion != srvs.Version || !si.srvTime.Equal(srvs.Timestamp) || len(si.srvs) != len(srvs.List) {
+		si.srvs = make([]searchEntry, len(srvs.List))
+		for i, s := range srvs.List {
+			si.srvs[i] = newSearchEntry(s.DisplayName, s.KeywordList)
+		}
+		si.srvVersion = srvs.Version
+		si.srvTime = srvs.Timestamp
+	}
+}
+
+// Search searches the organizations and institute access servers for query `query`
+// The display names and keywords in all languages are matched, ignoring case and accents
+// `t` filters the results: secure internet only gives organizations, institute access only gives servers and unknown gives both
+// The results are sorted by score from high to low
+// Only the read lock is taken, such that searches do not wait for each other
+func (discovery *Discovery) Search(query string, t server.Type) *discotypes.SearchResults {
+	res := &discotypes.SearchResults{}
+	nq := normalize(query)
+	words := strings.Fields(nq)
+	if len(words) == 0 {
+		return res
+	}
+
+	discovery.mu.RLock()
+	defer discovery.mu.RUnlock()
+	si := discovery.getIndex()
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.update(&discovery.OrganizationList, &discovery.ServerList)
+
+	if t == server.TypeUnknown || t == server.TypeSecureInternet {
+		var names []string
+		for i, e := range si.orgs {
+			org := discovery.OrganizationList.List[i]
+			if t == server.TypeSecureInternet && org.SecureInternetHome == "" {
+				continue
+			}
+			if s := e.score(nq, words); s > 0 {
+				res.Organizations = append(res.Organizations, discotypes.OrganizationResult{Organization: org, Score: s})
+				names = append(names, e.sortName)
+			}
+		}
+		sort.Sort(byScore{n: len(names), score: func(i int) int { return res.Organizations[i].Score }, names: names, swap: func(i, j int) {
+			res.Organizations[i], res.Organizations[j] = res.Organizations[j], res.Organizations[i]
+		}})
+	}
+	if t == server.TypeUnknown || t == server.TypeInstituteAccess {
+		var names []string
+		for i, e := range si.srvs {
+			srv := discovery.ServerList.List[i]
+			// secure internet servers are found using their organization
+			if srv.Type != "institute_access" {
+				continue
+			}
+			if s := e.score(nq, words); s > 0 {
+				res.Servers = append(res.Servers, discotypes.ServerResult{Server: srv, Score: s})
+				names = append(names, e.sortName)
+			}
+		}
+		sort.Sort(byScore{n: len(names), score: func(i int) int { return res.Servers[i].Score }, names: names, swap: func(i, j int) {
+			res.Servers[i], res.Servers[j] = res.Servers[j], res.Servers[i]
+		}})
+	}
+	return res
+}
+
+// byScore sorts results by score from high to low and then by name
+type byScore struct {
+	n     int
+	score func(int) int
+	names []string
+	swap  func(int, int)
+}
+
+func (b byScore) Len() int { return b.n }
+
+func (b byScore) Less(i, j int) bool {
+	si, sj := b.score(i), b.score(j)
+	if si != sj {
+		return si > sj
+	}
+	return b.names[i] < b.names[j]
+}
+
+func (b byScore) Swap(i, j int) {
+	b.swap(i, j)
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+}
@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	discotypes "github.com/eduvpn/eduvpn-common/types/discovery"
+	"github.com/eduvpn/eduvpn-common/types/server"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"Universität Zürich":  "universitat zurich",
+		"  SURF (Utrecht) ":   "surf utrecht",
+		"Ålborg-Universitet":  "alborg universitet",
+		"École_Polytechnique": "ecole polytechnique",
+	}
+	for in, want := range cases {
+		if got := normalize(in); got != want {
+			t.Fatalf("normalized not equal for: %s, got: %s, want: %s", in, got, want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	d := &Discovery{
+		OrganizationList: discotypes.Organizations{
+			Version: 1,
+			List: []discotypes.Organization{
+				{
+					DisplayName:        map[string]string{"en": "University of Zurich", "de": "Universität Zürich"},
+					OrgID:              "uzh",
+					SecureInternetHome: "https://a.example.com/",
+				},
+				{
+					DisplayName: map[string]string{"en": "Zurich Library"},
+					OrgID:       "zl",
+				},
+				{
+					DisplayName:        map[string]string{"en": "SURF"},
+					OrgID:              "surf",
+					SecureInternetHome: "https://b.example.com/",
+					KeywordList:        map[string]string{"en": "utrecht netherlands"},
+				},
+			},
+		},
+		ServerList: discotypes.Servers{
+			Version: 1,
+			List: []discotypes.Server{
+				{BaseURL: "https://demo.example.com/", DisplayName: map[string]string{"en": "Demo Zürich"}, Type: "institute_access"},
+				{BaseURL: "https://a.example.com/", DisplayName: map[string]string{"en": "Zurich"}, Type: "secure_internet"},
+			},
+		},
+	}
+
+	ids := func(res *discotypes.SearchResults) ([]string, []string) {
+		var orgs, srvs []string
+		for _, o := range res.Organizations {
+			orgs = append(orgs, o.OrgID)
+		}
+		for _, s := range res.Servers {
+			srvs = append(srvs, s.BaseURL)
+		}
+		return orgs, srvs
+	}
+
+	cases := []struct {
+		query    string
+		t        server.Type
+		wantOrgs []string
+		wantSrvs []string
+	}{
+		{query: "", t: server.TypeUnknown},
+		{query: "zuri", t: server.TypeUnknown, wantOrgs: []string{"zl", "uzh"}, wantSrvs: []string{"https://demo.example.com/"}},
+		{query: "ZÜRICH univ", t: server.TypeUnknown, wantOrgs: []string{"uzh"}},
+		{query: "zurich", t: server.TypeSecureInternet, wantOrgs: []string{"uzh"}},
+		{query: "zurich", t: server.TypeInstituteAccess, wantSrvs: []string{"https://demo.example.com/"}},
+		// keywords
+		{query: "utrecht", t: server.TypeUnknown, wantOrgs: []string{"surf"}},
+		// substring
+		{query: "rar", t: server.TypeUnknown, wantOrgs: []string{"zl"}},
+		{query: "nothing", t: server.TypeUnknown},
+	}
+	for _, c := range cases {
+		orgs, srvs := ids(d.Search(c.query, c.t))
+		if !reflect.DeepEqual(orgs, c.wantOrgs) {
+			t.Fatalf("organizations not equal for query: '%s', got: %v, want: %v", c.query, orgs, c.wantOrgs)
+		}
+		if !reflect.DeepEqual(srvs, c.wantSrvs) {
+			t.Fatalf("servers not equal for query: '%s', got: %v, want: %v", c.query, srvs, c.wantSrvs)
+		}
+	}
+
+	// the index is rebuilt when the list changes
+	d.OrganizationList.Version = 2
+	d.OrganizationList.List = d.OrganizationList.List[2:]
+	orgs, _ := ids(d.Search("zurich", server.TypeSecureInternet))
+	if len(orgs) != 0 {
+		t.Fatalf("got results from an outdated index: %v", orgs)
+	}
+
+	// concurrent searches on a new discovery struct share one index
+	d = &Discovery{OrganizationList: d.OrganizationList}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Search("surf", server.TypeUnknown)
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkSearch(b *testing.B) {
+	f, err := os.ReadFile("test_files/organization_list.json")
+	if err != nil {
+		b.Fatalf("failed to read organization list: %v", err)
+	}
+	d := &Discovery{}
+	if err = json.Unmarshal(f, &d.OrganizationList); err != nil {
+		b.Fatalf("failed to parse organization list: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Search("univ amst", server.TypeUnknown)
+	}
+}
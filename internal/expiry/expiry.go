@@ -0,0 +1,222 @@
+// Package expiry implements a scheduler that fires events when a VPN session nears its expiry
+// The times of these events are the same as the times that are returned by ExpiryTimes:
+// - the renew button is shown
+// - the countdown is started
+// - notifications are shown when a few hours are left
+// - the VPN has expired
+// Optionally the configuration is renewed ahead of expiry, see RenewalEvents
+package expiry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/internal/server"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+)
+
+// Clock is the clock that the scheduler uses
+// It can be replaced in tests
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// After returns a channel that receives the time after duration `d`
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the clock that uses the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the default clock that uses the system time
+var SystemClock Clock = systemClock{}
+
+// EventType is the type of an expiry event
+type EventType int8
+
+const (
+	// EventRenewButton means that the renew button should be shown
+	EventRenewButton EventType = iota
+	// EventCountdown means that the detailed countdown should be started
+	EventCountdown
+	// EventNotify means that a notification should be shown that the VPN expires soon
+	EventNotify
+	// EventExpired means that the VPN has expired
+	EventExpired
+	// EventRenew means that the configuration should be renewed without user interaction
+	EventRenew
+	// EventRenewed means that a new configuration was obtained ahead of expiry
+	EventRenewed
+)
+
+// Event is an event that is fired by the scheduler
+type Event struct {
+	// Type is the type of the event
+	Type EventType `json:"type"`
+	// Time is the Unix time at which the event was scheduled
+	Time int64 `json:"time"`
+	// Remaining is the number of seconds that are left until the VPN expires at the time of the event
+	Remaining int64 `json:"remaining"`
+	// Config is the new configuration, this is only set for EventRenewed
+	Config *srvtypes.Configuration `json:"config,omitempty"`
+}
+
+// Events returns the events for a VPN session that started at `st` and ends at `et`
+// The events are sorted by time, events with the same time are sorted by type
+func Events(st time.Time, et time.Time) []Event {
+	ev := func(t EventType, u int64) Event {
+		return Event{Type: t, Time: u, Remaining: et.Unix() - u}
+	}
+	events := []Event{
+		ev(EventRenewButton, server.RenewButtonTime(st, et)),
+		ev(EventCountdown, server.CountdownTime(st, et)),
+	}
+	for _, n := range server.NotificationTimes(st, et) {
+		// the notification on expiry is the expired event
+		if n >= et.Unix() {
+			continue
+		}
+		events = append(events, ev(EventNotify, n))
+	}
+	events = append(events, ev(EventExpired, et.Unix()))
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Time != events[j].Time {
+			return events[i].Time < events[j].Time
+		}
+		return events[i].Type < events[j].Type
+	})
+	return events
+}
+
+// RenewalEvents returns the events for a VPN session that started at `st` and ends at `et` when the configuration is renewed `lead` before expiry
+// The events that would be fired before the renewal are left out, they are only needed if the renewal fails
+// The events are sorted by time, events with the same time are sorted by type
+func RenewalEvents(st time.Time, et time.Time, lead time.Duration) []Event {
+	rt := et.Add(-lead).Unix()
+	events := []Event{{Type: EventRenew, Time: rt, Remaining: et.Unix() - rt}}
+	for _, e := range Events(st, et) {
+		if e.Time > rt {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// due returns the events that should be fired now and the events that should be scheduled at time `now`
+// Of the notifications that are in the past only the last one is fired
+func due(events []Event, now int64) ([]Event, []Event) {
+	n := sort.Search(len(events), func(i int) bool {
+		return events[i].Time > now
+	})
+	var fire []Event
+	lastNotify := -1
+	for i := 0; i < n; i++ {
+		if events[i].Type == EventNotify {
+			lastNotify = i
+		}
+	}
+	for i := 0; i < n; i++ {
+		if events[i].Type == EventNotify && i != lastNotify {
+			continue
+		}
+		fire = append(fire, events[i])
+	}
+	return fire, events[n:]
+}
+
+// Scheduler fires the expiry events of a VPN session
+type Scheduler struct {
+	mu      sync.Mutex
+	clock   Clock
+	onEvent func(context.Context, Event)
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler with clock `clock` that calls `onEvent` for each event
+// The context that is passed to `onEvent` is cancelled when the schedule is stopped
+func NewScheduler(clock Clock, onEvent func(context.Context, Event)) *Scheduler {
+	return &Scheduler{clock: clock, onEvent: onEvent}
+}
+
+// Start schedules the events for a VPN session that started at `st` and ends at `et`
+// Events that are already in the past are fired immediately
+// A previous schedule is stopped, such that this can be used to reschedule after renewing
+func (s *Scheduler) Start(st time.Time, et time.Time) {
+	s.start(Events(st, et))
+}
+
+// StartRenewal is Start but the configuration is renewed `lead` before expiry, see RenewalEvents
+func (s *Scheduler) StartRenewal(st time.Time, et time.Time, lead time.Duration) {
+	s.start(RenewalEvents(st, et, lead))
+}
+
+// Now returns the current time of the clock of the scheduler
+func (s *Scheduler) Now() time.Time {
+	return s.clock.Now()
+}
+
+// start schedules the events `events` that are sorted by time
+func (s *Scheduler) start(events []Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	fire, later := due(events, s.clock.Now().Unix())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for _, e := range fire {
+			if ctx.Err() != nil {
+				return
+			}
+			s.onEvent(ctx, e)
+		}
+		for _, e := range later {
+			d := time.Unix(e.Time, 0).Sub(s.clock.Now())
+			if d > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-s.clock.After(d):
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			s.onEvent(ctx, e)
+		}
+	}()
+}
+
+// Stop stops the current schedule and cancels the context that is passed to the event handler
+// An event that is fired at the same time can still be passed to the handler after this returns, the handler must check the context
+// It does not wait for an event handler that is running, such that it can be called from the handler, use Wait for this
+// It is a no-op if nothing is scheduled
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// Wait waits until the schedules that were stopped are done
+// This must not be called from the event handler
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,201 @@
+package expiry
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only advances when the test asks it to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+	// waiting receives the time at which a timer fires when it is created
+	waiting chan time.Time
+	timers  []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiting: make(chan time.Time, 10)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := fakeTimer{at: f.now.Add(d), c: make(chan time.Time, 1)}
+	f.timers = append(f.timers, t)
+	f.waiting <- t.at
+	return t.c
+}
+
+// Set sets the time to `now` and fires the timers that have expired
+func (f *fakeClock) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+	kept := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(now) {
+			kept = append(kept, t)
+			continue
+		}
+		t.c <- now
+	}
+	f.timers = kept
+}
+
+func TestEvents(t *testing.T) {
+	st := time.Unix(1000000, 0)
+	cases := []struct {
+		et   time.Time
+		want []Event
+	}{
+		{
+			et: st.Add(48 * time.Hour),
+			want: []Event{
+				{Type: EventRenewButton, Time: 1086400, Remaining: 86400},
+				{Type: EventCountdown, Time: 1086400, Remaining: 86400},
+				{Type: EventNotify, Time: 1158400, Remaining: 14400},
+				{Type: EventNotify, Time: 1165600, Remaining: 7200},
+				{Type: EventNotify, Time: 1169200, Remaining: 3600},
+				{Type: EventExpired, Time: 1172800, Remaining: 0},
+			},
+		},
+		{
+			et: st.Add(90 * time.Minute),
+			want: []Event{
+				{Type: EventCountdown, Time: 1000000, Remaining: 5400},
+				{Type: EventRenewButton, Time: 1001800, Remaining: 3600},
+				{Type: EventNotify, Time: 1001800, Remaining: 3600},
+				{Type: EventExpired, Time: 1005400, Remaining: 0},
+			},
+		},
+	}
+	for _, c := range cases {
+		if got := Events(st, c.et); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("events not equal for end time: %v, got: %v, want: %v", c.et, got, c.want)
+		}
+	}
+}
+
+func TestRenewalEvents(t *testing.T) {
+	st := time.Unix(1000000, 0)
+	et := st.Add(48 * time.Hour)
+	cases := []struct {
+		lead time.Duration
+		want []EventType
+	}{
+		// the renewal is before all other events
+		{lead: 36 * time.Hour, want: []EventType{EventRenew, EventRenewButton, EventCountdown, EventNotify, EventNotify, EventNotify, EventExpired}},
+		// the renew button and countdown are only needed when the renewal fails
+		{lead: 6 * time.Hour, want: []EventType{EventRenew, EventNotify, EventNotify, EventNotify, EventExpired}},
+		{lead: 2 * time.Hour, want: []EventType{EventRenew, EventNotify, EventExpired}},
+	}
+	for _, c := range cases {
+		events := RenewalEvents(st, et, c.lead)
+		var got []EventType
+		for _, e := range events {
+			got = append(got, e.Type)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("renewal events not equal for lead: %v, got: %v, want: %v", c.lead, got, c.want)
+		}
+		if r := events[0]; r.Time != et.Add(-c.lead).Unix() || r.Remaining != int64(c.lead.Seconds()) {
+			t.Fatalf("renew event not equal for lead: %v, got: %v", c.lead, r)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	events := Events(time.Unix(1000000, 0), time.Unix(1000000, 0).Add(48*time.Hour))
+	cases := []struct {
+		now       int64
+		wantFire  []EventType
+		wantLater int
+	}{
+		{now: 1000000, wantLater: 6},
+		{now: 1086400, wantFire: []EventType{EventRenewButton, EventCountdown}, wantLater: 4},
+		// only the last notification in the past is fired
+		{now: 1169200, wantFire: []EventType{EventRenewButton, EventCountdown, EventNotify}, wantLater: 1},
+		{now: 1172800, wantFire: []EventType{EventRenewButton, EventCountdown, EventNotify, EventExpired}},
+	}
+	for _, c := range cases {
+		fire, later := due(events, c.now)
+		var got []EventType
+		for _, e := range fire {
+			got = append(got, e.Type)
+		}
+		if !reflect.DeepEqual(got, c.wantFire) || len(later) != c.wantLater {
+			t.Fatalf("due events not equal at: %d, got: %v and %d later, want: %v and %d later", c.now, got, len(later), c.wantFire, c.wantLater)
+		}
+	}
+	if fire, _ := due(events, 1169200); fire[2].Remaining != 3600 {
+		t.Fatalf("the fired notification is not the last one: %v", fire[2])
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	st := time.Unix(1000000, 0)
+	et := st.Add(48 * time.Hour)
+	clock := newFakeClock(st.Add(time.Hour))
+	got := make(chan Event, 10)
+	s := NewScheduler(clock, func(_ context.Context, e Event) {
+		got <- e
+	})
+
+	recv := func() Event {
+		select {
+		case e := <-got:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for an event")
+		}
+		return Event{}
+	}
+
+	s.Start(st, et)
+	want := Events(st, et)
+	for i := 0; i < len(want); {
+		at := <-clock.waiting
+		clock.Set(at)
+		// events with the same time are fired after each other
+		for i < len(want) && want[i].Time == at.Unix() {
+			if e := recv(); e != want[i] {
+				t.Fatalf("event not equal, got: %v, want: %v", e, want[i])
+			}
+			i++
+		}
+	}
+
+	// rescheduling in the middle of a session fires the past events immediately
+	clock.Set(et.Add(-3 * time.Hour))
+	s.Start(st, et)
+	for _, w := range []EventType{EventRenewButton, EventCountdown, EventNotify} {
+		if e := recv(); e.Type != w {
+			t.Fatalf("event type not equal, got: %v, want: %v", e.Type, w)
+		}
+	}
+
+	// no events are fired after stopping
+	at := <-clock.waiting
+	s.Stop()
+	clock.Set(at)
+	select {
+	case e := <-got:
+		t.Fatalf("got an event after stopping: %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,100 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/internal/log"
+)
+
+// Health is the health of the connection that is determined by the liveness monitor
+type Health int8
+
+const (
+	// HealthHealthy means that the gateway replied or rx bytes increased in the last interval
+	HealthHealthy Health = iota
+	// HealthDegraded means that the gateway did not reply and rx bytes did not increase for one or more intervals
+	HealthDegraded
+	// HealthDropped means that the gateway did not reply and rx bytes did not increase for pDropped intervals
+	HealthDropped
+)
+
+// String returns the health as a string
+func (h Health) String() string {
+	switch h {
+	case HealthHealthy:
+		return "healthy"
+	case HealthDegraded:
+		return "degraded"
+	case HealthDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// Monitor keeps checking the connection until `ctx` is cancelled
+// Every ping interval a ping is sent to the gateway using probe `p` and the rx bytes are read
+// `onEvent` is called with the health of the connection each time it changes, starting with the first check
+// After the connection is dropped the monitor keeps running, such that it is reported when the connection becomes healthy again
+// It returns nil when `ctx` is cancelled and an error if there was an invalid input or the rx bytes could not be read
+func (m *DroppedConMon) Monitor(ctx context.Context, p Probe, onEvent func(Health)) error {
+	if onEvent == nil {
+		return errors.New("no event handler given")
+	}
+	// Read the start Rx bytes
+	prev, err := m.readRxBytes()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(m.pInterval)
+	defer ticker.Stop()
+
+	// the health that was last reported, -1 means nothing has been reported yet
+	last := Health(-1)
+	// missed is the amount of consecutive intervals without a reply and without an increase in rx bytes
+	missed := 0
+	for s := 1; ctx.Err() == nil; s++ {
+		alive := false
+		// a failed send is not fatal here, e.g. the tunnel interface can be temporarily down
+		if err = p.Send(s); err != nil {
+			log.Logger.Debugf("[Failover] Monitor failed to send ping: %d, with error: %v", s, err)
+		} else if err = p.Read(time.Now().Add(m.pInterval)); err == nil {
+			alive = true
+		}
+
+		b, err := m.readRxBytes()
+		if err != nil {
+			return err
+		}
+		if b > prev {
+			alive = true
+		}
+		prev = b
+
+		h := HealthHealthy
+		if alive {
+			missed = 0
+		} else {
+			missed++
+			h = HealthDegraded
+			if missed >= m.pDropped {
+				h = HealthDropped
+			}
+		}
+		log.Logger.Debugf("[Failover] Monitor check: %d, rx bytes: %d, missed: %d, health: %v", s, b, missed, h)
+		if h != last {
+			onEvent(h)
+			last = h
+		}
+
+		// Wait for the next tick to continue
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakePinger replies to a ping if the reply for its check is true
+type fakePinger struct {
+	replies []bool
+	seq     int
+}
+
+func (f *fakePinger) Send(seq int) error {
+	f.seq = seq
+	return nil
+}
+
+func (f *fakePinger) Close() error {
+	return nil
+}
+
+func (f *fakePinger) Read(_ time.Time) error {
+	if f.seq <= len(f.replies) && f.replies[f.seq-1] {
+		return nil
+	}
+	return errors.New("timeout")
+}
+
+func TestMonitor(t *testing.T) {
+	cases := []struct {
+		replies []bool
+		rx      []int64
+		want    []Health
+	}{
+		{
+			replies: []bool{true, true, true},
+			rx:      []int64{0, 0, 0, 0},
+			want:    []Health{HealthHealthy},
+		},
+		{
+			// no replies but the rx bytes increase
+			replies: []bool{false, false, false},
+			rx:      []int64{0, 1, 2, 3},
+			want:    []Health{HealthHealthy},
+		},
+		{
+			replies: []bool{true, false, false, false, false, true},
+			rx:      []int64{0, 0, 0, 0, 0, 0, 0},
+			want:    []Health{HealthHealthy, HealthDegraded, HealthDropped, HealthHealthy},
+		},
+		{
+			replies: []bool{false, false, false, true},
+			rx:      []int64{5, 5, 5, 5, 5},
+			want:    []Health{HealthDegraded, HealthDropped, HealthHealthy},
+		},
+	}
+
+	for _, c := range cases {
+		ctx, cancel := context.WithCancel(context.Background())
+		i := 0
+		m := NewDroppedMonitor(time.Millisecond, 3, func() (int64, error) {
+			b := c.rx[i]
+			i++
+			// stop after the last check
+			if i == len(c.rx) {
+				cancel()
+			}
+			return b, nil
+		})
+		var got []Health
+		err := m.Monitor(ctx, &fakePinger{replies: c.replies}, func(h Health) {
+			got = append(got, h)
+		})
+		cancel()
+		if err != nil {
+			t.Fatalf("failed to monitor: %v", err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("events not equal for replies: %v, got: %v, want: %v", c.replies, got, c.want)
+		}
+	}
+}
+
+func TestMonitorRxError(t *testing.T) {
+	m := NewDroppedMonitor(time.Millisecond, 3, func() (int64, error) {
+		return 0, errors.New("no interface")
+	})
+	err := m.Monitor(context.Background(), &fakePinger{}, func(Health) {})
+	if err == nil || err.Error() != "no interface" {
+		t.Fatalf("expected the rx bytes error, got: %v", err)
+	}
+}
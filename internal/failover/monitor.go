@@ -2,7 +2,6 @@ package failover
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
@@ -41,18 +40,9 @@ func (m *DroppedConMon) dropped(startBytes int64) (bool, error) {
 
 // Start starts ticking every ping interval and check if the connection is dropped or alive
 // This does not check Rx bytes every tick, but rather when pAlive or pDropped is reached
+// The probe `p` is used to send the pings, e.g. ICMP echo requests or TCP connects
 // It returns an error if there was an invalid input or a ping was failed to be sent
-func (m *DroppedConMon) Start(ctx context.Context, gateway string, mtuSize int) (bool, error) {
-	if mtuSize <= 0 {
-		return false, errors.New("invalid mtu size given")
-	}
-
-	// Create a ping struct with our mtu size
-	p, err := NewPinger(gateway, mtuSize)
-	if err != nil {
-		return false, err
-	}
-
+func (m *DroppedConMon) Start(ctx context.Context, p Probe) (bool, error) {
 	// Read the start Rx bytes
 	b, err := m.readRxBytes()
 	if err != nil {
@@ -85,7 +75,7 @@ func (m *DroppedConMon) Start(ctx context.Context, gateway string, mtuSize int)
 	// We begin with 2 as this is used as the sequence number for ping
 	// and we have already sent a ping
 	for s := 2; s <= m.pDropped; s++ {
-		log.Logger.Debugf("[Failover] Sending ping: %d, with size: %d", s, mtuSize)
+		log.Logger.Debugf("[Failover] Sending ping: %d", s)
 		// Send a ping and return if an error occurs
 		if err := p.Send(s); err != nil {
 			log.Logger.Debugf("[Failover] A ping failed, exiting...")
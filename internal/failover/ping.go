@@ -1,6 +1,7 @@
 package failover
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -8,16 +9,54 @@ import (
 
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
-// mtuOverhead defines the total MTU overhead for an ICMP ECHO message: 20 bytes IP header + 8 bytes ICMP header
-var mtuOverhead = 28
+// family is the ICMP family that is used to ping a gateway
+type family struct {
+	// proto is the IANA protocol number of ICMP for this family
+	proto int
+	// echo is the type of an echo request
+	echo icmp.Type
+	// reply is the type of an echo reply
+	reply icmp.Type
+	// overhead is the total MTU overhead for an ICMP ECHO message: the IP header + 8 bytes ICMP header
+	overhead int
+}
+
+var (
+	// familyV4 is ICMP over IPv4, with a 20 bytes IP header
+	familyV4 = family{proto: 1, echo: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply, overhead: 28}
+	// familyV6 is ICMPv6 over IPv6, with a 40 bytes IP header
+	familyV6 = family{proto: 58, echo: ipv6.ICMPTypeEchoRequest, reply: ipv6.ICMPTypeEchoReply, overhead: 48}
+)
+
+// gatewayFamily parses the gateway IP and returns it together with the ICMP family that is used to ping it
+func gatewayFamily(gateway string) (net.IP, family, error) {
+	ip := net.ParseIP(gateway)
+	if ip == nil {
+		return nil, family{}, fmt.Errorf("invalid gateway IP: '%s'", gateway)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, familyV4, nil
+	}
+	return ip, familyV6, nil
+}
+
+// payload returns the payload of a ping such that the whole ping has size `size`
+func (f family) payload(size int) ([]byte, error) {
+	if size < f.overhead {
+		return nil, errors.New("mtu size is too small for a ping")
+	}
+	return make([]byte, size-f.overhead), nil
+}
 
 // Pinger sends pings
 type Pinger struct {
 	listener net.PacketConn
 	buffer   []byte
 	gateway  net.Addr
+	family   family
 }
 
 // Read reads from the ping listener with deadline `deadline`
@@ -33,12 +72,12 @@ func (p Pinger) Read(deadline time.Time) error {
 	if err != nil {
 		return err
 	}
-	got, err := icmp.ParseMessage(ipv4.ICMPTypeEchoReply.Protocol(), r[:n])
+	got, err := icmp.ParseMessage(p.family.proto, r[:n])
 	if err != nil {
 		return err
 	}
 	switch got.Type {
-	case ipv4.ICMPTypeEchoReply:
+	case p.family.reply:
 		return nil
 	default:
 		return fmt.Errorf("not a ping echo reply, got: %+v", got)
@@ -49,8 +88,9 @@ func (p Pinger) Read(deadline time.Time) error {
 func (p Pinger) Send(seq int) error {
 	errorMessage := fmt.Sprintf("failed sending ping, seq %d", seq)
 	// Make a new ICMP message
+	// For ICMPv6 the checksum is calculated by the kernel
 	m := icmp.Message{
-		Type: ipv4.ICMPTypeEcho, Code: 0,
+		Type: p.family.echo, Code: 0,
 		Body: &icmp.Echo{
 			ID: os.Getpid() & 0xffff, Seq: seq,
 			Data: p.buffer,
@@ -69,3 +109,8 @@ func (p Pinger) Send(seq int) error {
 
 	return nil
 }
+
+// Close closes the ping listener
+func (p Pinger) Close() error {
+	return p.listener.Close()
+}
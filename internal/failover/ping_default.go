@@ -3,21 +3,43 @@
 package failover
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"syscall"
 
 	"golang.org/x/net/icmp"
 )
 
 // NewPinger creates a new pinger with gateway `gateway` and size `size`
+// The IP family, IPv4 or IPv6, is chosen from the gateway address
 func NewPinger(gateway string, size int) (*Pinger, error) {
-	l, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	ip, fam, err := gatewayFamily(gateway)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := fam.payload(size)
+	if err != nil {
+		return nil, err
+	}
+	network, address := "udp4", "0.0.0.0"
+	if fam == familyV6 {
+		network, address = "udp6", "::"
+	}
+	l, err := icmp.ListenPacket(network, address)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating ping with error: %w", err)
 	}
 	return &Pinger{
 		listener: l,
-		buffer:   make([]byte, size-mtuOverhead),
-		gateway:  &net.UDPAddr{IP: net.ParseIP(gateway)},
+		buffer:   buf,
+		gateway:  &net.UDPAddr{IP: ip},
+		family:   fam,
 	}, nil
 }
+
+// refused returns whether or not error `err` means that the gateway refused the connection
+// This is a TCP reset or an ICMP port unreachable for a connected UDP socket, both are replies of the gateway
+func refused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
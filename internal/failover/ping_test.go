@@ -0,0 +1,64 @@
+package failover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGatewayFamily(t *testing.T) {
+	cases := []struct {
+		gateway string
+		want    family
+		wantErr bool
+	}{
+		{gateway: "10.10.10.1", want: familyV4},
+		{gateway: "::ffff:10.10.10.1", want: familyV4},
+		{gateway: "fd00::1", want: familyV6},
+		{gateway: "", wantErr: true},
+		{gateway: "gateway.example.com", wantErr: true},
+	}
+	for _, c := range cases {
+		_, got, err := gatewayFamily(c.gateway)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("error not expected for gateway: '%s', got: %v", c.gateway, err)
+		}
+		if got != c.want {
+			t.Fatalf("family not equal for gateway: '%s', got: %v, want: %v", c.gateway, got, c.want)
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	for _, f := range []family{familyV4, familyV6} {
+		b, err := f.payload(1400)
+		if err != nil {
+			t.Fatalf("failed to get payload: %v", err)
+		}
+		if len(b)+f.overhead != 1400 {
+			t.Fatalf("ping size not equal to the MTU, got: %d", len(b)+f.overhead)
+		}
+		if _, err = f.payload(f.overhead - 1); err == nil {
+			t.Fatalf("no error for an MTU smaller than the overhead: %d", f.overhead)
+		}
+	}
+}
+
+// TestPingLoopback tests a ping to the loopback address for both families
+// It is skipped if ping sockets are not allowed, e.g. due to the net.ipv4.ping_group_range sysctl
+func TestPingLoopback(t *testing.T) {
+	for _, gw := range []string{"127.0.0.1", "::1"} {
+		gw := gw
+		t.Run(gw, func(t *testing.T) {
+			p, err := NewPinger(gw, 1280)
+			if err != nil {
+				t.Skipf("failed to create a pinger for: '%s', error: %v", gw, err)
+			}
+			if err = p.Send(1); err != nil {
+				t.Fatalf("failed to send ping to: '%s', error: %v", gw, err)
+			}
+			if err = p.Read(time.Now().Add(2 * time.Second)); err != nil {
+				t.Fatalf("failed to read pong from: '%s', error: %v", gw, err)
+			}
+		})
+	}
+}
@@ -1,20 +1,42 @@
 package failover
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
 	"golang.org/x/net/icmp"
+	"golang.org/x/sys/windows"
 )
 
 func NewPinger(gateway string, size int) (*Pinger, error) {
-	l, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	ip, fam, err := gatewayFamily(gateway)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := fam.payload(size)
+	if err != nil {
+		return nil, err
+	}
+	network, address := "ip4:icmp", "0.0.0.0"
+	if fam == familyV6 {
+		network, address = "ip6:ipv6-icmp", "::"
+	}
+	l, err := icmp.ListenPacket(network, address)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating ping with error: %w", err)
 	}
 	return &Pinger{
 		listener: l,
-		buffer:   make([]byte, size-mtuOverhead),
-		gateway:  &net.IPAddr{IP: net.ParseIP(gateway)},
+		buffer:   buf,
+		gateway:  &net.IPAddr{IP: ip},
+		family:   fam,
 	}, nil
 }
+
+// refused returns whether or not error `err` means that the gateway refused the connection
+// This is a TCP reset or an ICMP port unreachable for a connected UDP socket, both are replies of the gateway
+// Windows reports the latter as a connection reset
+func refused(err error) bool {
+	return errors.Is(err, windows.WSAECONNREFUSED) || errors.Is(err, windows.WSAECONNRESET)
+}
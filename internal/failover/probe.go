@@ -0,0 +1,260 @@
+package failover
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	httpw "github.com/eduvpn/eduvpn-common/internal/http"
+	failovertypes "github.com/eduvpn/eduvpn-common/types/failover"
+)
+
+// Probe checks whether or not the gateway can be reached
+type Probe interface {
+	// Send sends probe number `seq`, it does not wait for the reply
+	Send(seq int) error
+	// Read waits until `deadline` for the reply to the last probe
+	// It returns nil if the reply was received
+	Read(deadline time.Time) error
+	// Close closes the probe
+	Close() error
+}
+
+// NewProbe creates the probe with configuration `cfg` for gateway `gateway`
+// `size` is the MTU size, this is used for the size of the ICMP and UDP probes
+func NewProbe(cfg failovertypes.Probe, gateway string, size int) (Probe, error) {
+	if size <= 0 {
+		return nil, errors.New("invalid mtu size given")
+	}
+	switch cfg.Type {
+	case failovertypes.ProbeICMP:
+		p, err := NewPinger(gateway, size)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case failovertypes.ProbeTCP:
+		addr, err := probeAddress(gateway, cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+		return newTCPProbe(addr), nil
+	case failovertypes.ProbeUDP:
+		addr, err := probeAddress(gateway, cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+		p, err := newUDPProbe(addr, size)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case failovertypes.ProbeHTTPS:
+		u := cfg.URL
+		if u == "" {
+			ip, _, err := gatewayFamily(gateway)
+			if err != nil {
+				return nil, err
+			}
+			u = "https://" + net.JoinHostPort(ip.String(), "443") + "/"
+		}
+		return newHTTPSProbe(u, nil), nil
+	default:
+		return nil, fmt.Errorf("invalid probe type: %d", cfg.Type)
+	}
+}
+
+// probeAddress returns the address of the gateway with port `port`
+func probeAddress(gateway string, port int) (string, error) {
+	ip, _, err := gatewayFamily(gateway)
+	if err != nil {
+		return "", err
+	}
+	if port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid probe port: %d", port)
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
+}
+
+// asyncProbe is a probe where each attempt runs in the background
+// A new attempt cancels the previous one
+type asyncProbe struct {
+	// attempt does a single attempt, it returns nil if the gateway replied
+	attempt func(ctx context.Context) error
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	results chan error
+}
+
+// Send starts a new attempt
+func (a *asyncProbe) Send(_ int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	res := make(chan error, 1)
+	a.cancel = cancel
+	a.results = res
+	go func() {
+		res <- a.attempt(ctx)
+	}()
+	return nil
+}
+
+// Read waits for the result of the last attempt
+func (a *asyncProbe) Read(deadline time.Time) error {
+	a.mu.Lock()
+	res := a.results
+	a.mu.Unlock()
+	if res == nil {
+		return errors.New("no probe was sent")
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case err := <-res:
+		return err
+	case <-t.C:
+		return errors.New("timeout waiting for the probe reply")
+	}
+}
+
+// Close cancels the last attempt
+func (a *asyncProbe) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	return nil
+}
+
+// newTCPProbe creates a probe that connects to TCP address `addr`
+// The connection is closed immediately when it is established
+// A refused connection also counts as a reply
+func newTCPProbe(addr string) *asyncProbe {
+	return &asyncProbe{attempt: func(ctx context.Context) error {
+		var d net.Dialer
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if refused(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to connect to: '%s' with error: %w", addr, err)
+		}
+		return c.Close()
+	}}
+}
+
+// newHTTPSProbe creates a probe that sends a HEAD request to `u` using client `c`
+// If the client is nil a new one is created
+func newHTTPSProbe(u string, c *httpw.Client) *asyncProbe {
+	if c == nil {
+		c = httpw.NewClient(&http.Client{
+			// a redirect is also a reply
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		})
+	}
+	return &asyncProbe{attempt: func(ctx context.Context) error {
+		_, _, err := c.Do(ctx, http.MethodHead, u, nil)
+		if tlsReplied(err) {
+			return nil
+		}
+		return err
+	}}
+}
+
+// tlsReplied returns whether or not HTTPS request error `err` means that the server replied
+// A status error, a TLS alert and a certificate that cannot be verified are all replies
+// The certificate of the gateway cannot be verified when the default URL is used as this contains the IP
+func tlsReplied(err error) bool {
+	if err == nil {
+		return true
+	}
+	var se *httpw.StatusError
+	if errors.As(err, &se) {
+		return true
+	}
+	// the TLS alerts that are sent by the server are wrapped in this op error
+	var oe *net.OpError
+	if errors.As(err, &oe) && oe.Op == "remote error" {
+		return true
+	}
+	var uae x509.UnknownAuthorityError
+	var he x509.HostnameError
+	var cie x509.CertificateInvalidError
+	return errors.As(err, &uae) || errors.As(err, &he) || errors.As(err, &cie)
+}
+
+// udpProbe sends datagrams to a UDP address and waits for a reply
+// An ICMP port unreachable also counts as a reply
+type udpProbe struct {
+	conn   net.Conn
+	buffer []byte
+	// refused is whether or not sending reported an ICMP port unreachable of an earlier datagram
+	refused bool
+}
+
+// newUDPProbe creates a probe for UDP address `addr` where the datagrams are of size `size` including the headers
+func newUDPProbe(addr string, size int) (*udpProbe, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	_, fam, err := gatewayFamily(host)
+	if err != nil {
+		return nil, err
+	}
+	// the UDP header has the same size as the ICMP header
+	buf, err := fam.payload(size)
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating udp probe with error: %w", err)
+	}
+	return &udpProbe{conn: c, buffer: buf}, nil
+}
+
+// Send sends a single datagram
+func (p *udpProbe) Send(seq int) error {
+	_, err := p.conn.Write(p.buffer)
+	p.refused = refused(err)
+	if err != nil && !p.refused {
+		return fmt.Errorf("failed sending udp probe, seq %d with error: %w", seq, err)
+	}
+	return nil
+}
+
+// Read reads a reply with deadline `deadline`
+func (p *udpProbe) Read(deadline time.Time) error {
+	if p.refused {
+		return nil
+	}
+	if err := p.conn.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	r := make([]byte, 1500)
+	_, err := p.conn.Read(r)
+	if refused(err) {
+		return nil
+	}
+	return err
+}
+
+// Close closes the UDP connection
+func (p *udpProbe) Close() error {
+	return p.conn.Close()
+}
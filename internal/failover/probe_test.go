@@ -0,0 +1,195 @@
+package failover
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/internal/test"
+	failovertypes "github.com/eduvpn/eduvpn-common/types/failover"
+)
+
+// probeOnce sends a single probe and returns whether or not it got a reply
+func probeOnce(t *testing.T, p Probe) bool {
+	t.Helper()
+	defer p.Close() //nolint:errcheck
+	if err := p.Send(1); err != nil {
+		t.Fatalf("failed to send probe: %v", err)
+	}
+	return p.Read(time.Now().Add(2*time.Second)) == nil
+}
+
+// closedPort returns a local port that nothing listens on
+func closedPort(t *testing.T, network string) int {
+	t.Helper()
+	var addr net.Addr
+	if network == "udp" {
+		c, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		addr = c.LocalAddr()
+		c.Close() //nolint:errcheck
+	} else {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		addr = l.Addr()
+		l.Close() //nolint:errcheck
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatalf("failed to get port: %v", err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("failed to parse port: %v", err)
+	}
+	return p
+}
+
+func TestTCPProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close() //nolint:errcheck
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close() //nolint:errcheck
+		}
+	}()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	p, err := NewProbe(failovertypes.Probe{Type: failovertypes.ProbeTCP, Port: port}, "127.0.0.1", 1400)
+	if err != nil {
+		t.Fatalf("failed to create tcp probe: %v", err)
+	}
+	if !probeOnce(t, p) {
+		t.Fatalf("no reply from tcp listener")
+	}
+
+	p, err = NewProbe(failovertypes.Probe{Type: failovertypes.ProbeTCP, Port: closedPort(t, "tcp")}, "127.0.0.1", 1400)
+	if err != nil {
+		t.Fatalf("failed to create tcp probe: %v", err)
+	}
+	// the reset is a reply of the gateway
+	if !probeOnce(t, p) {
+		t.Fatalf("no reply from a closed tcp port")
+	}
+}
+
+func TestUDPProbe(t *testing.T) {
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer c.Close() //nolint:errcheck
+	sizes := make(chan int, 1)
+	go func() {
+		b := make([]byte, 2000)
+		for {
+			n, addr, err := c.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			sizes <- n
+			c.WriteTo(b[:1], addr) //nolint:errcheck
+		}
+	}()
+	port := c.LocalAddr().(*net.UDPAddr).Port
+
+	p, err := NewProbe(failovertypes.Probe{Type: failovertypes.ProbeUDP, Port: port}, "127.0.0.1", 1400)
+	if err != nil {
+		t.Fatalf("failed to create udp probe: %v", err)
+	}
+	if !probeOnce(t, p) {
+		t.Fatalf("no reply from udp listener")
+	}
+	// 20 bytes IPv4 header and 8 bytes UDP header
+	if n := <-sizes; n != 1400-28 {
+		t.Fatalf("udp payload size not equal, got: %d, want: %d", n, 1400-28)
+	}
+
+	p, err = NewProbe(failovertypes.Probe{Type: failovertypes.ProbeUDP, Port: closedPort(t, "udp")}, "127.0.0.1", 1400)
+	if err != nil {
+		t.Fatalf("failed to create udp probe: %v", err)
+	}
+	// the ICMP port unreachable is a reply of the gateway
+	if !probeOnce(t, p) {
+		t.Fatalf("no reply from a closed udp port")
+	}
+
+	// a listener that does not reply
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer silent.Close() //nolint:errcheck
+	p, err = NewProbe(failovertypes.Probe{Type: failovertypes.ProbeUDP, Port: silent.LocalAddr().(*net.UDPAddr).Port}, "127.0.0.1", 1400)
+	if err != nil {
+		t.Fatalf("failed to create udp probe: %v", err)
+	}
+	if probeOnce(t, p) {
+		t.Fatalf("got a reply from a udp listener that does not reply")
+	}
+}
+
+func TestHTTPSProbe(t *testing.T) {
+	var method string
+	s := test.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		// any response is a reply
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	c, err := s.Client()
+	if err != nil {
+		t.Fatalf("failed to get HTTP test client: %v", err)
+	}
+	if !probeOnce(t, newHTTPSProbe(s.URL, c)) {
+		t.Fatalf("no reply from https server")
+	}
+	if method != http.MethodHead {
+		t.Fatalf("method not equal, got: %s, want: %s", method, http.MethodHead)
+	}
+
+	// a client that does not trust the certificate, e.g. because the URL is the IP of the gateway
+	if !probeOnce(t, newHTTPSProbe(s.URL, nil)) {
+		t.Fatalf("no reply from https server with an untrusted certificate")
+	}
+
+	s.Close()
+	if probeOnce(t, newHTTPSProbe(s.URL, c)) {
+		t.Fatalf("got a reply from a closed https server")
+	}
+}
+
+func TestNewProbe(t *testing.T) {
+	cases := []struct {
+		probe   failovertypes.Probe
+		gateway string
+		mtu     int
+		wantErr string
+	}{
+		{probe: failovertypes.Probe{Type: failovertypes.ProbeTCP, Port: 443}, gateway: "10.10.10.1", mtu: 0, wantErr: "invalid mtu size given"},
+		{probe: failovertypes.Probe{Type: failovertypes.ProbeTCP}, gateway: "10.10.10.1", mtu: 1400, wantErr: "invalid probe port: 0"},
+		{probe: failovertypes.Probe{Type: failovertypes.ProbeUDP, Port: 70000}, gateway: "10.10.10.1", mtu: 1400, wantErr: "invalid probe port: 70000"},
+		{probe: failovertypes.Probe{Type: failovertypes.ProbeHTTPS}, gateway: "gateway", mtu: 1400, wantErr: "invalid gateway IP: 'gateway'"},
+		{probe: failovertypes.Probe{Type: 10}, gateway: "10.10.10.1", mtu: 1400, wantErr: "invalid probe type: 10"},
+		{probe: failovertypes.Probe{Type: failovertypes.ProbeHTTPS}, gateway: "fd00::1", mtu: 1400},
+	}
+	for _, c := range cases {
+		p, err := NewProbe(c.probe, c.gateway, c.mtu)
+		test.AssertError(t, err, c.wantErr)
+		if p != nil {
+			p.Close() //nolint:errcheck
+		}
+	}
+}
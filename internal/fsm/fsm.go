@@ -1,12 +1,11 @@
-// Package fsm defines a finite state machine and has the ability to save this state machine to a graph file
-// This graph file can be visualized using mermaid.js
+// Package fsm defines a finite state machine and has the ability to generate a graph of this state machine
+// This graph can be visualized using mermaid.js or Graphviz
 package fsm
 
 import (
 	"fmt"
-	"os"
-	"path"
-	"sort"
+
+	"github.com/eduvpn/eduvpn-common/internal/log"
 )
 
 type (
@@ -63,17 +62,14 @@ type FSM struct {
 	// It takes the old state, the new state and the data and returns if this is handled by the client
 	StateCallback func(StateID, StateID, interface{}) bool
 
-	// Directory represents the path where the state graph is stored
-	Directory string
-
-	// Generate represents whether we want to generate the graph
-	Generate bool
-
 	// GetStateName gets the name of a state as a string
 	GetStateName func(StateID) string
 
 	// initial is the initial state that we can always go back to
 	initial StateID
+
+	// history is the history of transitions, it is disabled by default
+	history *history
 }
 
 // Init initializes the state machine and sets it to the given current state.
@@ -81,17 +77,14 @@ func (fsm *FSM) Init(
 	current StateID,
 	states States,
 	callback func(StateID, StateID, interface{}) bool,
-	directory string,
 	nameGen func(StateID) string,
-	generate bool,
 ) {
 	fsm.States = states
 	fsm.Current = current
 	fsm.StateCallback = callback
-	fsm.Directory = directory
 	fsm.GetStateName = nameGen
-	fsm.Generate = generate
 	fsm.initial = current
+	fsm.history = &history{}
 }
 
 // InState returns whether or not the state machine is in the given 'check' state.
@@ -115,29 +108,6 @@ func (fsm *FSM) CheckTransition(desired StateID) error {
 	return fmt.Errorf("fsm invalid transition attempt from '%s' to '%s'", fsm.GetStateName(fsm.Current), fsm.GetStateName(desired))
 }
 
-// graphFilename gets the full path to the graph filename including the .graph extension.
-func (fsm *FSM) graphFilename(extension string) string {
-	pth := path.Join(fsm.Directory, "graph")
-	return fmt.Sprintf("%s%s", pth, extension)
-}
-
-// writeGraph writes the state machine to a .graph file.
-func (fsm *FSM) writeGraph() {
-	gph := fsm.GenerateGraph()
-	gf := fsm.graphFilename(".graph")
-	f, err := os.Create(gf)
-	if err != nil {
-		return
-	}
-	defer func() {
-		_ = f.Close()
-	}()
-
-	// Writing the graph is best effort
-	// TODO: Return string instead, we do not want to write files in this library
-	_, _ = f.WriteString(gph)
-}
-
 // GoTransitionRequired transitions the state machine to a new state with associated state data 'data'
 // If this transition is not handled by the client, it returns an error.
 func (fsm *FSM) GoTransitionRequired(newState StateID, data interface{}) error {
@@ -150,6 +120,9 @@ func (fsm *FSM) GoTransitionRequired(newState StateID, data interface{}) error {
 	}
 	// transition is not handled
 	if !handled {
+		if h := fsm.HistoryString(); h != "" {
+			log.Logger.Debugf("[FSM] required transition to: '%s' is not handled, transition history:\n%s", fsm.GetStateName(newState), h)
+		}
 		return fmt.Errorf("fsm failed transition from '%s' to '%s', is this required transition handled?", fsm.GetStateName(oldState), fsm.GetStateName(newState))
 	}
 	return nil
@@ -164,10 +137,11 @@ func (fsm *FSM) GoTransitionWithData(newState StateID, data interface{}) (bool,
 
 	prev := fsm.Current
 	fsm.Current = newState
-	if fsm.Generate {
-		fsm.writeGraph()
+	handled := fsm.StateCallback(prev, newState, data)
+	if fsm.history != nil && fsm.history.add(prev, newState, handled, data) {
+		log.Logger.Debugf("[FSM] transition from: '%s' to: '%s', handled: %v, data: %T", fsm.GetStateName(prev), fsm.GetStateName(newState), handled, data)
 	}
-	return fsm.StateCallback(prev, newState, data), nil
+	return handled, nil
 }
 
 // GoTransition is an alias to call GoTransitionWithData but have an empty string as data.
@@ -175,42 +149,3 @@ func (fsm *FSM) GoTransition(newState StateID) (bool, error) {
 	// No data means the callback is never required
 	return fsm.GoTransitionWithData(newState, "")
 }
-
-// generateMermaidGraph generates a graph suitable to be converted by the mermaid.js tool
-// it returns the graph as a string.
-func (fsm *FSM) generateMermaidGraph() string {
-	gph := "graph TD\n"
-	sf := make(StateIDSlice, 0, len(fsm.States))
-	for stateID := range fsm.States {
-		sf = append(sf, stateID)
-	}
-	sort.Sort(sf)
-	for _, state := range sf {
-		transitions := fsm.States[state].Transitions
-		for _, transition := range transitions {
-			if state == fsm.Current {
-				gph += "\nstyle " + fsm.GetStateName(state) + " fill:cyan\n"
-			} else {
-				gph += "\nstyle " + fsm.GetStateName(state) + " fill:white\n"
-			}
-			gph += fsm.GetStateName(
-				state,
-			) + "(" + fsm.GetStateName(
-				state,
-			) + ") " + "-->|" + transition.Description + "| " + fsm.GetStateName(
-				transition.To,
-			) + "\n"
-		}
-	}
-	return gph
-}
-
-// GenerateGraph generates a mermaid graph if the state machine is initialized
-// If the graph cannot be generated, it returns the empty string.
-func (fsm *FSM) GenerateGraph() string {
-	if fsm.GetStateName != nil {
-		return fsm.generateMermaidGraph()
-	}
-
-	return ""
-}
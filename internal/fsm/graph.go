@@ -0,0 +1,128 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GraphFormat is the format of a graph of the state machine
+type GraphFormat int8
+
+const (
+	// GraphMermaid is a graph that can be converted by the mermaid.js tool
+	GraphMermaid GraphFormat = iota
+	// GraphDOT is a graph in the Graphviz DOT language
+	GraphDOT
+)
+
+// graphEdge is a single transition in the graph
+type graphEdge struct {
+	from StateID
+	to   StateID
+	desc string
+	// taken is true if the transition is in the history
+	taken bool
+}
+
+// edges returns the transitions of the state machine sorted by state
+// Transitions that are in the history are marked as taken
+func (fsm *FSM) edges() []graphEdge {
+	taken := make(map[[2]StateID]bool)
+	for _, e := range fsm.History() {
+		taken[[2]StateID{e.From, e.To}] = true
+	}
+	sf := make(StateIDSlice, 0, len(fsm.States))
+	for stateID := range fsm.States {
+		sf = append(sf, stateID)
+	}
+	sort.Sort(sf)
+	var edges []graphEdge
+	for _, state := range sf {
+		for _, t := range fsm.States[state].Transitions {
+			edges = append(edges, graphEdge{
+				from:  state,
+				to:    t.To,
+				desc:  t.Description,
+				taken: taken[[2]StateID{state, t.To}],
+			})
+		}
+	}
+	return edges
+}
+
+// generateMermaidGraph generates a graph suitable to be converted by the mermaid.js tool
+// The current state is cyan and the transitions in the history are orange
+// it returns the graph as a string.
+func (fsm *FSM) generateMermaidGraph() string {
+	var gph strings.Builder
+	gph.WriteString("graph TD\n")
+	edges := fsm.edges()
+	for _, e := range edges {
+		name := fsm.GetStateName(e.from)
+		if e.from == fsm.Current {
+			gph.WriteString("\nstyle " + name + " fill:cyan\n")
+		} else {
+			gph.WriteString("\nstyle " + name + " fill:white\n")
+		}
+		gph.WriteString(name + "(" + name + ") " + "-->|" + e.desc + "| " + fsm.GetStateName(e.to) + "\n")
+	}
+	var taken []string
+	for i, e := range edges {
+		if e.taken {
+			taken = append(taken, fmt.Sprint(i))
+		}
+	}
+	if len(taken) > 0 {
+		gph.WriteString("\nlinkStyle " + strings.Join(taken, ",") + " stroke:orange,stroke-width:3px\n")
+	}
+	return gph.String()
+}
+
+// generateDOTGraph generates a graph in the Graphviz DOT language
+// The current state is cyan and the transitions in the history are orange
+// it returns the graph as a string.
+func (fsm *FSM) generateDOTGraph() string {
+	var gph strings.Builder
+	gph.WriteString("digraph {\n")
+	gph.WriteString("\tnode [shape=box, style=\"rounded,filled\", fillcolor=white];\n")
+	sf := make(StateIDSlice, 0, len(fsm.States))
+	for stateID := range fsm.States {
+		sf = append(sf, stateID)
+	}
+	sort.Sort(sf)
+	for _, state := range sf {
+		name := fsm.GetStateName(state)
+		if state == fsm.Current {
+			gph.WriteString(fmt.Sprintf("\t%q [fillcolor=cyan];\n", name))
+		} else {
+			gph.WriteString(fmt.Sprintf("\t%q;\n", name))
+		}
+	}
+	for _, e := range fsm.edges() {
+		attrs := fmt.Sprintf("label=%q", e.desc)
+		if e.taken {
+			attrs += ", color=orange, penwidth=3"
+		}
+		gph.WriteString(fmt.Sprintf("\t%q -> %q [%s];\n", fsm.GetStateName(e.from), fsm.GetStateName(e.to), attrs))
+	}
+	gph.WriteString("}\n")
+	return gph.String()
+}
+
+// GenerateGraph generates a graph in format `format` with the current state and the transitions in the history highlighted
+// It returns an error if the state machine is not initialized or the format is unknown
+func (fsm *FSM) GenerateGraph(format GraphFormat) (string, error) {
+	if fsm.GetStateName == nil {
+		return "", errors.New("the state machine is not initialized")
+	}
+	switch format {
+	case GraphMermaid:
+		return fsm.generateMermaidGraph(), nil
+	case GraphDOT:
+		return fsm.generateDOTGraph(), nil
+	default:
+		return "", fmt.Errorf("unknown graph format: %d", format)
+	}
+}
@@ -0,0 +1,62 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/internal/test"
+)
+
+func TestGenerateGraph(t *testing.T) {
+	f := newTestFSM()
+	f.States[1] = State{Transitions: []Transition{{To: 2, Description: "Go to two"}}}
+	f.States[2] = State{Transitions: []Transition{{To: 1, Description: "Go to one"}}}
+	f.SetHistorySize(10)
+	if _, err := f.GoTransition(2); err != nil {
+		t.Fatalf("failed to transition: %v", err)
+	}
+
+	cases := []struct {
+		format  GraphFormat
+		want    string
+		wantErr string
+	}{
+		{
+			format: GraphMermaid,
+			want: `graph TD
+
+style One fill:white
+One(One) -->|Go to two| Two
+
+style Two fill:cyan
+Two(Two) -->|Go to one| One
+
+linkStyle 0 stroke:orange,stroke-width:3px
+`,
+		},
+		{
+			format: GraphDOT,
+			want: `digraph {
+	node [shape=box, style="rounded,filled", fillcolor=white];
+	"One";
+	"Two" [fillcolor=cyan];
+	"One" -> "Two" [label="Go to two", color=orange, penwidth=3];
+	"Two" -> "One" [label="Go to one"];
+}
+`,
+		},
+		{
+			format:  2,
+			wantErr: "unknown graph format: 2",
+		},
+	}
+	for _, c := range cases {
+		got, err := f.GenerateGraph(c.format)
+		test.AssertError(t, err, c.wantErr)
+		if got != c.want {
+			t.Fatalf("graph not equal for format: %d, got: %s, want: %s", c.format, got, c.want)
+		}
+	}
+
+	_, err := (&FSM{}).GenerateGraph(GraphMermaid)
+	test.AssertError(t, err, "the state machine is not initialized")
+}
@@ -0,0 +1,110 @@
+package fsm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HistoryEntry is a single transition in the history of the state machine
+type HistoryEntry struct {
+	// From is the state before the transition
+	From StateID `json:"from"`
+	// To is the state after the transition
+	To StateID `json:"to"`
+	// Time is the time at which the transition happened
+	Time time.Time `json:"time"`
+	// Handled is whether or not the client handled the transition
+	Handled bool `json:"handled"`
+	// DataType is the Go type of the data of the transition, e.g. "string" or "*server.RequiredAskTransition"
+	DataType string `json:"data_type"`
+}
+
+// history is a bounded ring buffer of transitions
+// It is disabled if there are no entries
+type history struct {
+	mu sync.Mutex
+	// entries are the transitions, once full the oldest is overwritten
+	entries []HistoryEntry
+	// next is the index where the next transition is written
+	next int
+	// full is true if the buffer has wrapped around
+	full bool
+}
+
+func (h *history) reset(size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = nil
+	if size > 0 {
+		h.entries = make([]HistoryEntry, size)
+	}
+	h.next = 0
+	h.full = false
+}
+
+// add records a transition and returns whether or not it was recorded
+func (h *history) add(from StateID, to StateID, handled bool, data interface{}) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) == 0 {
+		return false
+	}
+	h.entries[h.next] = HistoryEntry{
+		From:     from,
+		To:       to,
+		Time:     time.Now(),
+		Handled:  handled,
+		DataType: fmt.Sprintf("%T", data),
+	}
+	h.next++
+	if h.next == len(h.entries) {
+		h.next = 0
+		h.full = true
+	}
+	return true
+}
+
+func (h *history) list() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) == 0 {
+		return nil
+	}
+	if !h.full {
+		return append([]HistoryEntry(nil), h.entries[:h.next]...)
+	}
+	ret := make([]HistoryEntry, 0, len(h.entries))
+	ret = append(ret, h.entries[h.next:]...)
+	return append(ret, h.entries[:h.next]...)
+}
+
+// SetHistorySize sets the maximum number of transitions that are recorded in the history to `size`
+// A size of zero or lower disables the history
+// The transitions that were recorded before are removed
+func (fsm *FSM) SetHistorySize(size int) {
+	if fsm.history == nil {
+		return
+	}
+	fsm.history.reset(size)
+}
+
+// History returns the recorded transitions with the oldest first
+// It returns nil if the history is disabled
+// This is safe to call while a transition is in progress
+func (fsm *FSM) History() []HistoryEntry {
+	if fsm.history == nil {
+		return nil
+	}
+	return fsm.history.list()
+}
+
+// HistoryString returns the recorded transitions as a string with one transition per line
+// This is used for logging
+func (fsm *FSM) HistoryString() string {
+	s := ""
+	for _, e := range fsm.History() {
+		s += fmt.Sprintf("%s %s -> %s, handled: %v, data: %s\n", e.Time.Format(time.RFC3339Nano), fsm.GetStateName(e.From), fsm.GetStateName(e.To), e.Handled, e.DataType)
+	}
+	return s
+}
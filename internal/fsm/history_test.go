@@ -0,0 +1,87 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestFSM() *FSM {
+	states := States{
+		1: State{Transitions: []Transition{{To: 2}}},
+		2: State{Transitions: []Transition{{To: 1}}},
+	}
+	f := &FSM{}
+	f.Init(1, states, func(_ StateID, newState StateID, _ interface{}) bool {
+		return newState == 2
+	}, func(id StateID) string {
+		return map[StateID]string{1: "One", 2: "Two"}[id]
+	})
+	return f
+}
+
+// transitions returns the from and to states of the history
+func transitions(h []HistoryEntry) [][2]StateID {
+	var ret [][2]StateID
+	for _, e := range h {
+		ret = append(ret, [2]StateID{e.From, e.To})
+	}
+	return ret
+}
+
+func TestHistory(t *testing.T) {
+	f := newTestFSM()
+
+	// disabled by default
+	if _, err := f.GoTransition(2); err != nil {
+		t.Fatalf("failed to transition: %v", err)
+	}
+	if h := f.History(); h != nil {
+		t.Fatalf("got a history while it is disabled: %v", h)
+	}
+
+	f.SetHistorySize(3)
+	if _, err := f.GoTransitionWithData(1, 5); err != nil {
+		t.Fatalf("failed to transition: %v", err)
+	}
+	if _, err := f.GoTransition(2); err != nil {
+		t.Fatalf("failed to transition: %v", err)
+	}
+	h := f.History()
+	want := []HistoryEntry{
+		{From: 2, To: 1, Handled: false, DataType: "int"},
+		{From: 1, To: 2, Handled: true, DataType: "string"},
+	}
+	for i := range h {
+		if h[i].Time.IsZero() {
+			t.Fatalf("history entry: %d has no time", i)
+		}
+		h[i].Time = want[i].Time
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Fatalf("history not equal, got: %v, want: %v", h, want)
+	}
+
+	// the oldest transitions are overwritten
+	for i := 0; i < 2; i++ {
+		if _, err := f.GoTransition(1); err != nil {
+			t.Fatalf("failed to transition: %v", err)
+		}
+		if _, err := f.GoTransition(2); err != nil {
+			t.Fatalf("failed to transition: %v", err)
+		}
+	}
+	gotT := transitions(f.History())
+	wantT := [][2]StateID{{1, 2}, {2, 1}, {1, 2}}
+	if !reflect.DeepEqual(gotT, wantT) {
+		t.Fatalf("history transitions not equal, got: %v, want: %v", gotT, wantT)
+	}
+
+	// disabling removes the history
+	f.SetHistorySize(0)
+	if _, err := f.GoTransition(1); err != nil {
+		t.Fatalf("failed to transition: %v", err)
+	}
+	if h := f.History(); h != nil {
+		t.Fatalf("got a history after disabling it: %v", h)
+	}
+}
@@ -1,24 +1,113 @@
 // Package log implements a basic level based logger
+// Secrets are redacted before anything is written, see Redact
 package log
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/eduvpn/eduvpn-common/internal/util"
 )
 
 // FileLogger defines the type of logger that this package implements
 // As the name suggests, it saves the log to a file.
+// The log is also written to stdout
 type FileLogger struct {
-	// Level indicates which maximum level this logger actually forwards to the file
-	Level Level
+	// mu protects the fields below and serializes the writes
+	mu sync.Mutex
+
+	// level indicates which maximum level this logger actually forwards to the file
+	level Level
+
+	// levels are the levels of the components that override level
+	levels map[string]Level
+
+	// format is the format of the log entries
+	format Format
 
 	// file represents a pointer to the open log file
-	file *os.File
+	file *rotatingFile
+
+	// maxSize is the size in bytes after which the log file is rotated, zero disables rotation
+	maxSize int64
+
+	// maxFiles is the number of rotated log files that are kept
+	maxFiles int
+
+	// recent are the most recent entries that were written
+	recent recent
+}
+
+// Format is the format in which log entries are written
+type Format int8
+
+const (
+	// FormatText writes each entry as a line of text
+	FormatText Format = iota
+	// FormatJSON writes each entry as a JSON object on a single line, see Entry
+	FormatJSON
+)
+
+// The components of the library
+// Messages are tagged with a component by prefixing them with the component between brackets, e.g. "[Failover] ..."
+const (
+	// ComponentGeneral is the component of messages that are not tagged with a component
+	ComponentGeneral = "general"
+	// ComponentAPI is the eduVPN server API
+	ComponentAPI = "api"
+	// ComponentOAuth is the OAuth authorization
+	ComponentOAuth = "oauth"
+	// ComponentDiscovery is the discovery of the organizations and servers
+	ComponentDiscovery = "discovery"
+	// ComponentFailover is the failover and liveness monitor
+	ComponentFailover = "failover"
+	// ComponentProxyguard is the WireGuard over TCP proxy
+	ComponentProxyguard = "proxyguard"
+	// ComponentFSM is the state machine
+	ComponentFSM = "fsm"
+)
+
+// Components are the components of which the level can be set
+var Components = []string{
+	ComponentGeneral,
+	ComponentAPI,
+	ComponentOAuth,
+	ComponentDiscovery,
+	ComponentFailover,
+	ComponentProxyguard,
+	ComponentFSM,
+}
+
+// Entry is a log entry as it is written in the JSON format
+type Entry struct {
+	// Time is the time at which the entry was logged
+	Time time.Time `json:"time"`
+	// Level is the level of the entry, e.g. DEBUG
+	Level string `json:"level"`
+	// Component is the part of the library that logged the entry, e.g. failover
+	Component string `json:"component"`
+	// Message is the redacted message
+	Message string `json:"message"`
+}
+
+// component returns the component and the message without the component tag for message `msg`
+// Messages are tagged with a component by prefixing them with the component between brackets, e.g. "[Failover] ..."
+func component(msg string) (string, string) {
+	if !strings.HasPrefix(msg, "[") {
+		return ComponentGeneral, msg
+	}
+	c, rest, ok := strings.Cut(msg[1:], "] ")
+	if !ok || c == "" || strings.ContainsAny(c, " []") {
+		return ComponentGeneral, msg
+	}
+	return strings.ToLower(c), rest
 }
 
 // Logger is the global logger instance
@@ -69,23 +158,116 @@ func (e Level) String() string {
 
 // Init initializes the logger by forwarding a max level 'level' and a directory 'directory' where the log should be stored
 // If the logger cannot be initialized, for example an error in opening the log file, an error is returned.
+// The log file is rotated according to SetRotation, by default when it is larger than DefaultMaxSize
+// The output of the standard library logger is also redacted and written to the log
 func (logger *FileLogger) Init(lvl Level, dir string) error {
 	err := util.EnsureDirectory(dir)
 	if err != nil {
 		return err
 	}
-	f, err := os.OpenFile(
-		logger.filename(dir),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND,
-		0o666,
-	)
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	f, err := openRotating(logger.filename(dir), logger.maxSize, logger.maxFiles)
 	if err != nil {
-		return fmt.Errorf("failed creating log: %w", err)
+		return err
 	}
-	multi := io.MultiWriter(os.Stdout, f)
-	log.SetOutput(multi)
 	logger.file = f
-	logger.Level = lvl
+	logger.level = lvl
+	logger.levels = nil
+	log.SetOutput(stdWriter{logger})
+	return nil
+}
+
+// SetLevel sets the level `lvl` of the components that have no level of their own
+func (logger *FileLogger) SetLevel(lvl Level) error {
+	if lvl <= LevelNotSet || lvl > LevelFatal {
+		return fmt.Errorf("invalid log level: %d", lvl)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.level = lvl
+	return nil
+}
+
+// SetComponentLevel sets the level `lvl` of component `c`, this overrides the level that is set with SetLevel
+// LevelNotSet removes the level of the component
+func (logger *FileLogger) SetComponentLevel(c string, lvl Level) error {
+	known := false
+	for _, k := range Components {
+		if k == c {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown log component: '%s'", c)
+	}
+	if lvl < LevelNotSet || lvl > LevelFatal {
+		return fmt.Errorf("invalid log level: %d", lvl)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if lvl == LevelNotSet {
+		delete(logger.levels, c)
+		return nil
+	}
+	if logger.levels == nil {
+		logger.levels = make(map[string]Level)
+	}
+	logger.levels[c] = lvl
+	return nil
+}
+
+// Levels returns the level of the components that have no level of their own and the levels of the components that do
+func (logger *FileLogger) Levels() (Level, map[string]Level) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	levels := make(map[string]Level, len(logger.levels))
+	for c, l := range logger.levels {
+		levels[c] = l
+	}
+	return logger.level, levels
+}
+
+// enabled returns whether or not messages with level `lvl` of component `c` are logged
+// The logger mutex must be held
+func (logger *FileLogger) enabled(lvl Level, c string) bool {
+	cur := logger.level
+	if cl, ok := logger.levels[c]; ok {
+		cur = cl
+	}
+	return cur != LevelNotSet && lvl >= cur
+}
+
+// SetFormat sets the format of the log entries that are written after this call
+func (logger *FileLogger) SetFormat(f Format) error {
+	if f != FormatText && f != FormatJSON {
+		return fmt.Errorf("unknown log format: %d", f)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.format = f
+	return nil
+}
+
+// SetRotation sets that the log file is rotated when it would become larger than `maxSize` bytes
+// The last `maxFiles` rotated files are kept as log.1 to log.`maxFiles` where log.1 is the most recent
+// A `maxSize` of zero disables rotation
+func (logger *FileLogger) SetRotation(maxSize int64, maxFiles int) error {
+	if maxSize < 0 {
+		return fmt.Errorf("invalid maximum log size: %d", maxSize)
+	}
+	if maxFiles < 0 {
+		return fmt.Errorf("invalid number of rotated log files: %d", maxFiles)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.maxSize = maxSize
+	logger.maxFiles = maxFiles
+	if logger.file != nil {
+		logger.file.maxSize = maxSize
+		logger.file.maxFiles = maxFiles
+	}
 	return nil
 }
 
@@ -126,7 +308,14 @@ func (logger *FileLogger) Fatalf(msg string, params ...interface{}) {
 
 // Close closes the logger by closing the internal file.
 func (logger *FileLogger) Close() error {
-	return logger.file.Close()
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if logger.file == nil {
+		return errors.New("the logger is not initialized")
+	}
+	err := logger.file.Close()
+	logger.file = nil
+	return err
 }
 
 // filename returns the filename of the logger by returning the full path as a string.
@@ -134,16 +323,70 @@ func (logger *FileLogger) filename(directory string) string {
 	return path.Join(directory, "log")
 }
 
+// write writes the redacted line `line` to stdout and the log file
+// The logger mutex must be held
+func (logger *FileLogger) write(line string) {
+	b := []byte(Redact(line))
+	_, _ = os.Stdout.Write(b)
+	if logger.file != nil {
+		_, _ = logger.file.Write(b)
+	}
+}
+
+// entry writes an entry with time `t`, level `lvl` and message `msg` in the format of the logger
+// The entry is also kept in the recent entries
+// The logger mutex must be held
+func (logger *FileLogger) entry(t time.Time, lvl Level, msg string) {
+	c, m := component(msg)
+	// the message is redacted before marshalling, such that the patterns match the message and not its escaped form
+	e := Entry{Time: t, Level: lvl.String(), Component: c, Message: Redact(m)}
+	logger.recent.add(e)
+	if logger.format == FormatText {
+		logger.write(fmt.Sprintf("%s - Go - %s - %s\n", t.Format("2006/01/02 15:04:05"), lvl.String(), msg))
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	logger.write(string(b) + "\n")
+}
+
 // log logs as level 'level' a message 'msg' with parameters 'params'.
+// The level of the component that `msg` is tagged with is used
 func (logger *FileLogger) log(lvl Level, msg string, params ...interface{}) {
-	if lvl >= logger.Level && logger.Level != LevelNotSet {
-		fMsg := fmt.Sprintf(msg, params...)
-		f := fmt.Sprintf("- Go - %s - %s", lvl.String(), fMsg)
-		// To log file
-		log.Println(f)
+	c, _ := component(msg)
+	logger.mu.Lock()
+	ok := logger.enabled(lvl, c)
+	logger.mu.Unlock()
+	if !ok {
+		return
+	}
+	// format without holding the lock as the parameters can log themselves
+	fMsg := fmt.Sprintf(msg, params...)
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.entry(time.Now(), lvl, fMsg)
+}
+
+// stdWriter writes the output of the standard library logger to the logger
+type stdWriter struct {
+	logger *FileLogger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.logger.mu.Lock()
+	defer w.logger.mu.Unlock()
+	if w.logger.format == FormatText {
+		w.logger.recent.add(Entry{Time: time.Now(), Level: LevelInfo.String(), Component: ComponentGeneral, Message: Redact(strings.TrimSuffix(string(p), "\n"))})
+		w.logger.write(string(p))
+		return len(p), nil
 	}
+	w.logger.entry(time.Now(), LevelInfo, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
 }
 
 func init() {
-	Logger = &FileLogger{}
+	Logger = &FileLogger{maxSize: DefaultMaxSize, maxFiles: DefaultMaxFiles}
+	Logger.recent.reset(DefaultRecentSize)
 }
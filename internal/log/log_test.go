@@ -0,0 +1,218 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   `{"access_token":"abc","refresh_token": "def","token_type":"bearer"}`,
+			want: `{"access_token":"REDACTED","refresh_token": "REDACTED","token_type":"bearer"}`,
+		},
+		{
+			in:   "got redirect: http://127.0.0.1:8000/callback?code=abc.def&state=xyz&iss=https://example.com",
+			want: "got redirect: http://127.0.0.1:8000/callback?code=REDACTED&state=REDACTED&iss=https://example.com",
+		},
+		{
+			in:   "body: grant_type=refresh_token&refresh_token=abc",
+			want: "body: grant_type=refresh_token&refresh_token=REDACTED",
+		},
+		{
+			in:   "Authorization: Bearer abc.def-ghi",
+			want: "Authorization: Bearer REDACTED",
+		},
+		{
+			in:   "[Interface]\nPrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=\nAddress = 10.0.0.2/24",
+			want: "[Interface]\nPrivateKey = REDACTED\nAddress = 10.0.0.2/24",
+		},
+		// no secrets
+		{
+			in:   "failed transition from state: 1 with error code: 5",
+			want: "failed transition from state: 1 with error code: 5",
+		},
+	}
+	for _, c := range cases {
+		if got := Redact(c.in); got != c.want {
+			t.Fatalf("redacted not equal, got: %s, want: %s", got, c.want)
+		}
+	}
+}
+
+func TestComponent(t *testing.T) {
+	cases := []struct {
+		msg      string
+		wantComp string
+		wantMsg  string
+	}{
+		{msg: "[Failover] Monitor check: 1", wantComp: "failover", wantMsg: "Monitor check: 1"},
+		{msg: "no component", wantComp: ComponentGeneral, wantMsg: "no component"},
+		{msg: "[Interface] in a config", wantComp: "interface", wantMsg: "in a config"},
+		{msg: "[not a component] test", wantComp: ComponentGeneral, wantMsg: "[not a component] test"},
+		{msg: "[]", wantComp: ComponentGeneral, wantMsg: "[]"},
+	}
+	for _, c := range cases {
+		comp, msg := component(c.msg)
+		if comp != c.wantComp || msg != c.wantMsg {
+			t.Fatalf("component not equal for: %s, got: %s and %s, want: %s and %s", c.msg, comp, msg, c.wantComp, c.wantMsg)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "log")
+	rf, err := openRotating(p, 10, 2)
+	if err != nil {
+		t.Fatalf("failed to open the log file: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err = fmt.Fprintf(rf, "line %d\n", i); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	if err = rf.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	// each line is 7 bytes, so every line is in its own file and only the last 2 rotated files are kept
+	want := map[string]string{
+		"log":   "line 4\n",
+		"log.1": "line 3\n",
+		"log.2": "line 2\n",
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read the log directory: %v", err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("number of log files not equal, got: %d, want: %d", len(entries), len(want))
+	}
+	for f, w := range want {
+		b, err := os.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			t.Fatalf("failed to read log file: %s, err: %v", f, err)
+		}
+		if string(b) != w {
+			t.Fatalf("log file: %s not equal, got: %q, want: %q", f, string(b), w)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	dir := t.TempDir()
+	l := &FileLogger{}
+	if err := l.Init(LevelInfo, dir); err != nil {
+		t.Fatalf("failed to initialize the logger: %v", err)
+	}
+	if err := l.SetFormat(Format(5)); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+	if err := l.SetFormat(FormatJSON); err != nil {
+		t.Fatalf("failed to set the format: %v", err)
+	}
+	l.Debugf("not logged")
+	l.Warningf("[Failover] got tokens: %s", `{"access_token":"abc"}`)
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close the logger: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatalf("failed to read the log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one log line, got: %v", lines)
+	}
+	var e Entry
+	if err = json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatalf("failed to parse the log entry: %v", err)
+	}
+	if e.Level != "WARNING" || e.Component != "failover" || e.Message != `got tokens: {"access_token":"REDACTED"}` {
+		t.Fatalf("log entry not equal, got: %+v", e)
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	dir := t.TempDir()
+	l := &FileLogger{}
+	if err := l.Init(LevelWarning, dir); err != nil {
+		t.Fatalf("failed to initialize the logger: %v", err)
+	}
+	if err := l.SetComponentLevel("unknown", LevelDebug); err == nil {
+		t.Fatalf("expected an error for an unknown component")
+	}
+	if err := l.SetLevel(LevelNotSet); err == nil {
+		t.Fatalf("expected an error for setting the default level to not set")
+	}
+	if err := l.SetComponentLevel(ComponentDiscovery, LevelDebug); err != nil {
+		t.Fatalf("failed to set the discovery level: %v", err)
+	}
+	if err := l.SetComponentLevel(ComponentFSM, LevelError); err != nil {
+		t.Fatalf("failed to set the FSM level: %v", err)
+	}
+	l.Debugf("[Discovery] logged")
+	l.Debugf("[Failover] not logged")
+	l.Warningf("[Failover] logged")
+	l.Warningf("[FSM] not logged")
+	l.Warningf("logged")
+
+	// removing the level of a component uses the default level again
+	if err := l.SetComponentLevel(ComponentDiscovery, LevelNotSet); err != nil {
+		t.Fatalf("failed to remove the discovery level: %v", err)
+	}
+	l.Debugf("[Discovery] not logged")
+	def, levels := l.Levels()
+	if def != LevelWarning || len(levels) != 1 || levels[ComponentFSM] != LevelError {
+		t.Fatalf("levels not equal, got: %v and %v", def, levels)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close the logger: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatalf("failed to read the log: %v", err)
+	}
+	if got := strings.Count(string(b), "not logged"); got != 0 {
+		t.Fatalf("got %d messages that should not be logged: %s", got, string(b))
+	}
+	if got := strings.Count(string(b), "logged"); got != 3 {
+		t.Fatalf("logged messages not equal, got: %d, want: 3, log: %s", got, string(b))
+	}
+}
+
+func TestRecent(t *testing.T) {
+	l := &FileLogger{}
+	if err := l.Init(LevelInfo, t.TempDir()); err != nil {
+		t.Fatalf("failed to initialize the logger: %v", err)
+	}
+	defer l.Close() //nolint:errcheck
+	if got := l.Recent(); got != nil {
+		t.Fatalf("expected no recent entries when disabled, got: %v", got)
+	}
+	l.SetRecentSize(2)
+	l.Debugf("not logged")
+	l.Infof("[API] first")
+	l.Infof("second code=abc")
+	l.Errorf("[FSM] third")
+
+	got := l.Recent()
+	if len(got) != 2 {
+		t.Fatalf("number of recent entries not equal, got: %d, want: 2", len(got))
+	}
+	if got[0].Message != "second code=REDACTED" || got[0].Component != ComponentGeneral || got[0].Level != "INFO" {
+		t.Fatalf("first recent entry not equal, got: %+v", got[0])
+	}
+	if got[1].Message != "third" || got[1].Component != ComponentFSM || got[1].Level != "ERROR" {
+		t.Fatalf("second recent entry not equal, got: %+v", got[1])
+	}
+}
@@ -0,0 +1,64 @@
+package log
+
+// DefaultRecentSize is the default number of recent log entries that are kept in memory
+const DefaultRecentSize = 500
+
+// recent is a bounded ring buffer of the most recent log entries
+// It is disabled if there are no entries
+type recent struct {
+	// entries are the log entries, once full the oldest is overwritten
+	entries []Entry
+	// next is the index where the next entry is written
+	next int
+	// full is true if the buffer has wrapped around
+	full bool
+}
+
+func (r *recent) reset(size int) {
+	r.entries = nil
+	if size > 0 {
+		r.entries = make([]Entry, size)
+	}
+	r.next = 0
+	r.full = false
+}
+
+func (r *recent) add(e Entry) {
+	if len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *recent) list() []Entry {
+	if len(r.entries) == 0 {
+		return nil
+	}
+	if !r.full {
+		return append([]Entry(nil), r.entries[:r.next]...)
+	}
+	ret := make([]Entry, 0, len(r.entries))
+	ret = append(ret, r.entries[r.next:]...)
+	return append(ret, r.entries[:r.next]...)
+}
+
+// SetRecentSize sets the number of recent log entries that are kept in memory to `size`, zero disables this
+// The entries that were kept before are removed
+func (logger *FileLogger) SetRecentSize(size int) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.recent.reset(size)
+}
+
+// Recent returns the most recent log entries that were written with the oldest first
+// The messages are redacted, the entries of the standard library logger have level INFO and the general component
+func (logger *FileLogger) Recent() []Entry {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	return logger.recent.list()
+}
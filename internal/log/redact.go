@@ -0,0 +1,27 @@
+package log
+
+import "regexp"
+
+// redacted is what a secret is replaced with
+const redacted = "REDACTED"
+
+// redactions are the patterns of secrets that are masked before anything is logged
+// The first group of each pattern is kept
+var redactions = []*regexp.Regexp{
+	// JSON values, e.g. marshalled OAuth tokens
+	regexp.MustCompile(`("(?:access_token|refresh_token|code|state|private_key)"\s*:\s*")[^"]*`),
+	// URL query and form parameters, e.g. the authorization code in the redirect URI
+	regexp.MustCompile(`((?:^|[?&#\s"'(])(?:access_token|refresh_token|code|state)=)[^&#\s"')]+`),
+	// HTTP authorization headers
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),
+	// WireGuard private keys in a configuration
+	regexp.MustCompile(`(?i)(PrivateKey\s*=\s*)[A-Za-z0-9+/]{42,43}=?`),
+}
+
+// Redact masks the OAuth tokens, the authorization code and state parameters and WireGuard private keys in `s`
+func Redact(s string) string {
+	for _, r := range redactions {
+		s = r.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// DefaultMaxSize is the default size in bytes after which the log file is rotated
+	DefaultMaxSize int64 = 5 * 1024 * 1024
+	// DefaultMaxFiles is the default number of rotated log files that are kept
+	DefaultMaxFiles = 3
+)
+
+// rotatingFile is a log file that is rotated when it becomes too large
+// The rotated files are named by appending a number, where 1 is the most recent
+type rotatingFile struct {
+	path string
+	file *os.File
+	size int64
+	// maxSize is the size in bytes after which the file is rotated, zero or less disables rotation
+	maxSize int64
+	// maxFiles is the number of rotated files that are kept
+	maxFiles int
+}
+
+// openRotating opens the log file at `path` for appending
+func openRotating(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return fmt.Errorf("failed creating log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed getting the log file size: %w", err)
+	}
+	rf.file = f
+	rf.size = st.Size()
+	return nil
+}
+
+// backup returns the path of rotated file `n`
+func (rf *rotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", rf.path, n)
+}
+
+// rotate closes the current file, shifts the rotated files and opens a new empty file
+// The oldest rotated file is removed
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	err := rf.shift()
+	// always open the file again such that logging continues, if shifting failed the file is appended to
+	if oerr := rf.open(); oerr != nil {
+		return oerr
+	}
+	return err
+}
+
+// shift removes the oldest rotated file and renames the others, the current file becomes rotated file 1
+func (rf *rotatingFile) shift() error {
+	if rf.maxFiles <= 0 {
+		return os.Remove(rf.path)
+	}
+	if err := os.Remove(rf.backup(rf.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := rf.maxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(rf.backup(n), rf.backup(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(rf.path, rf.backup(1))
+}
+
+// Write writes `p` to the file and rotates the file first if it would become larger than the maximum size
+// A single write is never split over files
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, fmt.Errorf("failed rotating the log file: %w", err)
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close closes the file
+func (rf *rotatingFile) Close() error {
+	return rf.file.Close()
+}
@@ -0,0 +1,35 @@
+package openvpn
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CertificateExpiry returns the time when the inline client certificate, <cert>...</cert>, expires
+// It returns false if the config has no inline client certificate
+func (c *Config) CertificateExpiry() (time.Time, bool, error) {
+	cert, ok := c.Inline("cert")
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	rest := []byte(cert)
+	for {
+		var b *pem.Block
+		b, rest = pem.Decode(rest)
+		if b == nil {
+			return time.Time{}, false, errors.New("no PEM encoded certificate found in the inline certificate")
+		}
+		// skip other blocks, the first certificate is the client certificate
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+		x, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("failed parsing the inline certificate with error: %w", err)
+		}
+		return x.NotAfter, true, nil
+	}
+}
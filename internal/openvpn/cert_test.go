@@ -0,0 +1,79 @@
+package openvpn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/internal/test"
+)
+
+func testCertificate(t *testing.T, notAfter time.Time) string {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	cert := testCertificate(t, notAfter)
+
+	cases := []struct {
+		cfg     string
+		want    time.Time
+		wantOk  bool
+		wantErr string
+	}{
+		{
+			cfg: "client\nremote a.example.org",
+		},
+		{
+			cfg:    "client\n<cert>\n" + cert + "</cert>",
+			want:   notAfter,
+			wantOk: true,
+		},
+		{
+			// other blocks before the certificate are skipped
+			cfg:    "client\n<cert>\n-----BEGIN OTHER-----\nAAAA\n-----END OTHER-----\n" + cert + "</cert>",
+			want:   notAfter,
+			wantOk: true,
+		},
+		{
+			cfg:     "client\n<cert>\nnot a certificate\n</cert>",
+			wantErr: "no PEM encoded certificate found in the inline certificate",
+		},
+		{
+			cfg:     "client\n<cert>\n-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n</cert>",
+			wantErr: "failed parsing the inline certificate with error: x509: malformed certificate",
+		},
+	}
+	for _, c := range cases {
+		cfg, err := Parse(c.cfg)
+		if err != nil {
+			t.Fatalf("failed to parse config: %v", err)
+		}
+		got, ok, err := cfg.CertificateExpiry()
+		test.AssertError(t, err, c.wantErr)
+		if ok != c.wantOk || !got.Equal(c.want) {
+			t.Fatalf("certificate expiry not equal for: %s, got: %v, %v, want: %v, %v", c.cfg, got, ok, c.want, c.wantOk)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Package openvpn implements a parser for OpenVPN configs and a filter that removes dangerous directives
+// - a directive is a name with whitespace separated arguments, which can be quoted
+// - inline blocks, e.g. <ca>...</ca>, are kept as is
+// - comments are indicated with a # or ;
+package openvpn
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+)
+
+// Directive is a single OpenVPN directive
+type Directive struct {
+	// Name is the name of the directive, e.g. "remote"
+	Name string
+	// Args are the arguments of the directive, e.g. ["vpn.example.org", "1194", "udp"]
+	Args []string
+	// Comment is the comment after the arguments, e.g. "# primary", it is empty if there is none
+	Comment string
+}
+
+// Inline is an inline block, e.g. <ca>...</ca>
+type Inline struct {
+	// Name is the name of the block, e.g. "ca"
+	Name string
+	// Content is everything between the opening and closing tags
+	Content string
+}
+
+// item is a single item in the config, exactly one of the fields is set
+type item struct {
+	directive *Directive
+	inline    *Inline
+	comment   string
+}
+
+// Config is a parsed OpenVPN config
+type Config struct {
+	items []item
+}
+
+// isComment returns whether or not a line is a comment
+func isComment(f string) bool {
+	return strings.HasPrefix(f, "#") || strings.HasPrefix(f, ";")
+}
+
+// inlineStart returns the name of the inline block if the line opens one, e.g. <ca>
+func inlineStart(f string) (string, bool) {
+	if !strings.HasPrefix(f, "<") || !strings.HasSuffix(f, ">") || strings.HasPrefix(f, "</") {
+		return "", false
+	}
+	name := strings.TrimSpace(f[1 : len(f)-1])
+	return name, name != ""
+}
+
+// splitArgs splits a directive line into its fields
+// Fields are separated by whitespace, double and single quotes group fields and a backslash escapes the next character within double quotes or outside quotes
+// An unquoted field that starts with a # or ; starts a comment, like OpenVPN the rest of the line is then not parsed but returned as the comment
+func splitArgs(f string) ([]string, string, error) {
+	var fields []string
+	var cur strings.Builder
+	inField := false
+	var quote rune
+	escaped := false
+	comment := ""
+loop:
+	for i, c := range f {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inField = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inField = true
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		case !inField && (c == '#' || c == ';'):
+			comment = f[i:]
+			break loop
+		default:
+			cur.WriteRune(c)
+			inField = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, "", errors.New("unterminated quote or escape")
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, comment, nil
+}
+
+// quoteArg quotes an argument if it is needed to parse it back as a single field
+func quoteArg(a string) string {
+	if a != "" && !strings.ContainsAny(a, " \t\"'\\#;") {
+		return a
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(a) + `"`
+}
+
+// Parse parses the OpenVPN config `cfg`
+// It returns an error if an inline block is not closed or a directive cannot be parsed
+func Parse(cfg string) (*Config, error) {
+	lines := strings.Split(cfg, "\n")
+
+	c := &Config{}
+	for i := 0; i < len(lines); i++ {
+		// clean the line
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if isComment(line) {
+			c.items = append(c.items, item{comment: line})
+			continue
+		}
+
+		if name, ok := inlineStart(line); ok {
+			end := "</" + name + ">"
+			var content []string
+			closed := false
+			for i++; i < len(lines); i++ {
+				if strings.TrimSpace(lines[i]) == end {
+					closed = true
+					break
+				}
+				content = append(content, strings.TrimRight(lines[i], "\r"))
+			}
+			if !closed {
+				return nil, fmt.Errorf("inline block: '%s' is not closed", name)
+			}
+			c.items = append(c.items, item{inline: &Inline{Name: name, Content: strings.Join(content, "\n")}})
+			continue
+		}
+
+		fields, comment, err := splitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing line: %d with error: %w", i+1, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		// A config file can also use the command line form
+		name := strings.TrimPrefix(fields[0], "--")
+		c.items = append(c.items, item{directive: &Directive{Name: name, Args: fields[1:], Comment: comment}})
+	}
+	return c, nil
+}
+
+// Directives returns all directives with name `name` in order
+func (c *Config) Directives(name string) []Directive {
+	var ds []Directive
+	for _, it := range c.items {
+		if it.directive != nil && it.directive.Name == name {
+			ds = append(ds, *it.directive)
+		}
+	}
+	return ds
+}
+
+// Inline returns the content of the first inline block with name `name`
+// It returns false if there is no such block
+func (c *Config) Inline(name string) (string, bool) {
+	for _, it := range c.items {
+		if it.inline != nil && it.inline.Name == name {
+			return it.inline.Content, true
+		}
+	}
+	return "", false
+}
+
+// Remove removes all directives with name `name` and returns how many were removed
+func (c *Config) Remove(name string) int {
+	kept := c.items[:0]
+	n := 0
+	for _, it := range c.items {
+		if it.directive != nil && it.directive.Name == name {
+			n++
+			continue
+		}
+		kept = append(kept, it)
+	}
+	c.items = kept
+	return n
+}
+
+// Add adds a directive with name `name` and arguments `args` at the end
+func (c *Config) Add(name string, args ...string) {
+	c.items = append(c.items, item{directive: &Directive{Name: name, Args: args}})
+}
+
+// String returns the representation of the config as a string
+func (c *Config) String() string {
+	lines := make([]string, 0, len(c.items))
+	for _, it := range c.items {
+		switch {
+		case it.directive != nil:
+			f := []string{it.directive.Name}
+			for _, a := range it.directive.Args {
+				f = append(f, quoteArg(a))
+			}
+			if it.directive.Comment != "" {
+				f = append(f, it.directive.Comment)
+			}
+			lines = append(lines, strings.Join(f, " "))
+		case it.inline != nil:
+			lines = append(lines, fmt.Sprintf("<%s>\n%s\n</%s>", it.inline.Name, it.inline.Content, it.inline.Name))
+		default:
+			lines = append(lines, it.comment)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// defaultPort is the port that OpenVPN uses if none is given
+const defaultPort = 1194
+
+// Structured returns the structured view of the config
+func (c *Config) Structured() *srvtypes.OpenVPNConfig {
+	v := &srvtypes.OpenVPNConfig{}
+
+	// the defaults for remotes that do not specify a port or protocol
+	port := defaultPort
+	proto := "udp"
+	for _, d := range c.Directives("port") {
+		if len(d.Args) > 0 {
+			if p, err := strconv.Atoi(d.Args[0]); err == nil {
+				port = p
+			}
+		}
+	}
+	for _, d := range c.Directives("proto") {
+		if len(d.Args) > 0 {
+			proto = d.Args[0]
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, d := range c.Directives("remote") {
+		if len(d.Args) == 0 {
+			continue
+		}
+		r := srvtypes.OpenVPNRemote{Host: d.Args[0], Port: port, Protocol: proto}
+		if len(d.Args) > 1 {
+			if p, err := strconv.Atoi(d.Args[1]); err == nil {
+				r.Port = p
+			}
+		}
+		if len(d.Args) > 2 {
+			r.Protocol = d.Args[2]
+		}
+		v.Remotes = append(v.Remotes, r)
+		if !seen[r.Protocol] {
+			seen[r.Protocol] = true
+			v.Protocols = append(v.Protocols, r.Protocol)
+		}
+	}
+
+	for _, d := range c.Directives("data-ciphers") {
+		if len(d.Args) > 0 {
+			v.Ciphers = append(v.Ciphers, strings.Split(d.Args[0], ":")...)
+		}
+	}
+	// the legacy cipher is only used if there are no data ciphers
+	if len(v.Ciphers) == 0 {
+		for _, d := range c.Directives("cipher") {
+			if len(d.Args) > 0 {
+				v.Ciphers = append(v.Ciphers, d.Args[0])
+			}
+		}
+	}
+
+	for _, d := range c.Directives("route") {
+		if len(d.Args) == 0 {
+			continue
+		}
+		r := srvtypes.OpenVPNRoute{Network: d.Args[0]}
+		if len(d.Args) > 1 {
+			r.Netmask = d.Args[1]
+		}
+		if len(d.Args) > 2 {
+			r.Gateway = d.Args[2]
+		}
+		v.Routes = append(v.Routes, r)
+	}
+	for _, d := range c.Directives("route-ipv6") {
+		if len(d.Args) == 0 {
+			continue
+		}
+		r := srvtypes.OpenVPNRoute{Network: d.Args[0]}
+		if len(d.Args) > 1 {
+			r.Gateway = d.Args[1]
+		}
+		v.Routes = append(v.Routes, r)
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package openvpn
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/internal/test"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+)
+
+const testConfig = `# Portal: https://vpn.example.org/vpn-user-portal/
+dev tun
+client
+nobind
+data-ciphers AES-256-GCM:CHACHA20-POLY1305
+route 192.168.1.0 255.255.255.0
+route-ipv6 fd00::/64 fd00::1
+<ca>
+-----BEGIN CERTIFICATE-----
+MIIB
+-----END CERTIFICATE-----
+</ca>
+<tls-crypt>
+-----BEGIN OpenVPN Static key V1-----
+abcd
+-----END OpenVPN Static key V1-----
+</tls-crypt>
+remote vpn.example.org 1194 udp # primary
+remote vpn.example.org 443 tcp-client
+remote vpn2.example.org`
+
+func TestSplitArgs(t *testing.T) {
+	cases := []struct {
+		in          string
+		want        []string
+		wantComment string
+		wantErr     string
+	}{
+		{in: "remote vpn.example.org 1194  udp", want: []string{"remote", "vpn.example.org", "1194", "udp"}},
+		{in: `up "/bin/my script.sh" arg`, want: []string{"up", "/bin/my script.sh", "arg"}},
+		{in: `setenv A 'b "c"'`, want: []string{"setenv", "A", `b "c"`}},
+		{in: `setenv A b\ c`, want: []string{"setenv", "A", "b c"}},
+		{in: `setenv A ""`, want: []string{"setenv", "A", ""}},
+		{in: `up "/bin/sh`, wantErr: "unterminated quote or escape"},
+		// an unquoted field that starts with # or ; is a comment
+		{in: "remote vpn.example.org 1194 udp # primary", want: []string{"remote", "vpn.example.org", "1194", "udp"}, wantComment: "# primary"},
+		{in: "remote vpn.example.org 1194 udp;primary ; \"x", want: []string{"remote", "vpn.example.org", "1194", "udp;primary"}, wantComment: "; \"x"},
+		{in: `setenv A "#b" \;c`, want: []string{"setenv", "A", "#b", ";c"}},
+	}
+	for _, c := range cases {
+		got, comment, err := splitArgs(c.in)
+		test.AssertError(t, err, c.wantErr)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("fields not equal for: %s, got: %#v, want: %#v", c.in, got, c.want)
+		}
+		if comment != c.wantComment {
+			t.Fatalf("comment not equal for: %s, got: %s, want: %s", c.in, comment, c.wantComment)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse(testConfig)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if got := c.String(); got != testConfig {
+		t.Fatalf("round trip not equal, got: %s, want: %s", got, testConfig)
+	}
+	ca, ok := c.Inline("ca")
+	if !ok || ca != "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----" {
+		t.Fatalf("ca not equal, got: %s", ca)
+	}
+	if _, ok = c.Inline("cert"); ok {
+		t.Fatalf("got a cert that is not in the config")
+	}
+	if got := len(c.Directives("remote")); got != 3 {
+		t.Fatalf("number of remotes not equal, got: %d, want: 3", got)
+	}
+
+	_, err = Parse("client\n<ca>\nMIIB\n")
+	test.AssertError(t, err, "inline block: 'ca' is not closed")
+	_, err = Parse("client\nup \"/bin/sh\n")
+	test.AssertError(t, err, "failed parsing line: 2 with error: unterminated quote or escape")
+}
+
+func TestStructured(t *testing.T) {
+	c, err := Parse(testConfig + "\nport 1195\nproto tcp")
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	want := &srvtypes.OpenVPNConfig{
+		Remotes: []srvtypes.OpenVPNRemote{
+			{Host: "vpn.example.org", Port: 1194, Protocol: "udp"},
+			{Host: "vpn.example.org", Port: 443, Protocol: "tcp-client"},
+			{Host: "vpn2.example.org", Port: 1195, Protocol: "tcp"},
+		},
+		Protocols: []string{"udp", "tcp-client", "tcp"},
+		Ciphers:   []string{"AES-256-GCM", "CHACHA20-POLY1305"},
+		Routes: []srvtypes.OpenVPNRoute{
+			{Network: "192.168.1.0", Netmask: "255.255.255.0"},
+			{Network: "fd00::/64", Gateway: "fd00::1"},
+		},
+	}
+	if got := c.Structured(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("structured view not equal, got: %#v, want: %#v", got, want)
+	}
+
+	// the legacy cipher is used without data ciphers
+	c, err = Parse("cipher AES-256-CBC\nremote a.example.org")
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	want = &srvtypes.OpenVPNConfig{
+		Remotes:   []srvtypes.OpenVPNRemote{{Host: "a.example.org", Port: 1194, Protocol: "udp"}},
+		Protocols: []string{"udp"},
+		Ciphers:   []string{"AES-256-CBC"},
+	}
+	if got := c.Structured(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("structured view not equal, got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{
+			in:   "client\nremote a.example.org 1194 udp",
+			want: "client\nremote a.example.org 1194 udp\nscript-security 0",
+		},
+		{
+			in:   "client\nup /tmp/evil.sh\nscript-security 2\n--down \"/tmp/evil 2.sh\"\nlog /etc/passwd\nmanagement 127.0.0.1 7505\nremote a.example.org 1194 udp",
+			want: "client\nremote a.example.org 1194 udp\nscript-security 0",
+		},
+		{
+			in:      "client\nplugin /tmp/evil.so\nremote a.example.org 1194 udp",
+			wantErr: "the OpenVPN directive: 'plugin' is not allowed",
+		},
+		{
+			in:      "client\nengine /tmp/evil.so\nremote a.example.org 1194 udp",
+			wantErr: "the OpenVPN directive: 'engine' is not allowed",
+		},
+		{
+			in:      "client\nproviders legacy /tmp/evil.so\nremote a.example.org 1194 udp",
+			wantErr: "the OpenVPN directive: 'providers' is not allowed",
+		},
+		{
+			in:      "client\npkcs11-providers /tmp/evil.so\nremote a.example.org 1194 udp",
+			wantErr: "the OpenVPN directive: 'pkcs11-providers' is not allowed",
+		},
+	}
+	apply := func(in string, p Policy) (string, error) {
+		cfg, err := Parse(in)
+		if err != nil {
+			return "", err
+		}
+		if err = cfg.Apply(p); err != nil {
+			return "", err
+		}
+		return cfg.String(), nil
+	}
+	for _, c := range cases {
+		got, err := apply(c.in, DefaultPolicy)
+		test.AssertError(t, err, c.wantErr)
+		if got != c.want {
+			t.Fatalf("applied config not equal, got: %s, want: %s", got, c.want)
+		}
+	}
+
+	// a custom policy
+	got, err := apply("client\nverb 3", Policy{"verb": ActionStrip})
+	if err != nil {
+		t.Fatalf("failed to apply a custom policy: %v", err)
+	}
+	if got != "client\nscript-security 0" {
+		t.Fatalf("applied config not equal with a custom policy, got: %s", got)
+	}
+}
@@ -0,0 +1,98 @@
+package openvpn
+
+import (
+	"fmt"
+
+	"github.com/eduvpn/eduvpn-common/internal/log"
+)
+
+// Action is what happens with a directive according to a policy
+type Action int8
+
+const (
+	// ActionAllow keeps the directive, this is the default for directives that are not in a policy
+	ActionAllow Action = iota
+	// ActionStrip removes the directive from the config
+	ActionStrip
+	// ActionReject rejects the whole config
+	ActionReject
+)
+
+// Policy defines the action for each directive name
+type Policy map[string]Action
+
+// DefaultPolicy is the policy that is used for the configs from the server
+// A VPN server has no reason to run scripts, load plugins or write files on the client, so these directives are removed
+// A plugin, an OpenSSL engine or a (PKCS#11) provider is a shared library that is loaded with the privileges of the client, such a config is rejected
+var DefaultPolicy = Policy{
+	// scripts
+	"up":                    ActionStrip,
+	"down":                  ActionStrip,
+	"route-up":              ActionStrip,
+	"route-pre-down":        ActionStrip,
+	"ipchange":              ActionStrip,
+	"tls-verify":            ActionStrip,
+	"auth-user-pass-verify": ActionStrip,
+	"client-connect":        ActionStrip,
+	"client-disconnect":     ActionStrip,
+	"learn-address":         ActionStrip,
+	"script-security":       ActionStrip,
+	// shared libraries
+	"plugin":           ActionReject,
+	"engine":           ActionReject,
+	"providers":        ActionReject,
+	"pkcs11-providers": ActionReject,
+	// management interface
+	"management":                   ActionStrip,
+	"management-client-auth":       ActionStrip,
+	"management-client-user":       ActionStrip,
+	"management-client-group":      ActionStrip,
+	"management-external-key":      ActionStrip,
+	"management-external-cert":     ActionStrip,
+	"management-hold":              ActionStrip,
+	"management-query-passwords":   ActionStrip,
+	"management-query-proxy":       ActionStrip,
+	"management-query-remote":      ActionStrip,
+	"management-signal":            ActionStrip,
+	"management-up-down":           ActionStrip,
+	"management-forget-disconnect": ActionStrip,
+	// files and processes
+	"log":            ActionStrip,
+	"log-append":     ActionStrip,
+	"status":         ActionStrip,
+	"writepid":       ActionStrip,
+	"cd":             ActionStrip,
+	"chroot":         ActionStrip,
+	"config":         ActionStrip,
+	"daemon":         ActionStrip,
+	"tmp-dir":        ActionStrip,
+	"replay-persist": ActionStrip,
+	"askpass":        ActionStrip,
+	"iproute":        ActionStrip,
+}
+
+// Apply applies policy `p` to the config
+// It returns an error if the config contains a directive that is rejected
+// To make sure that no scripts are run, "script-security 0" is added at the end
+func (c *Config) Apply(p Policy) error {
+	for _, it := range c.items {
+		if it.directive == nil {
+			continue
+		}
+		if p[it.directive.Name] == ActionReject {
+			return fmt.Errorf("the OpenVPN directive: '%s' is not allowed", it.directive.Name)
+		}
+	}
+	for name, a := range p {
+		if a != ActionStrip {
+			continue
+		}
+		if n := c.Remove(name); n > 0 && name != "script-security" {
+			log.Logger.Warningf("removed the OpenVPN directive: '%s' from the config %d time(s)", name, n)
+		}
+	}
+	// ensure scripts are not ran by default
+	c.Remove("script-security")
+	c.Add("script-security", "0")
+	return nil
+}
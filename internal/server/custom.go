@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/eduvpn/eduvpn-common/internal/api"
-	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
 	"github.com/eduvpn/eduvpn-common/types/server"
 	"github.com/jwijenbergh/eduoauth-go"
 )
@@ -26,13 +26,13 @@ func (s *Servers) AddCustom(ctx context.Context, id string, na bool) (*Server, e
 	var err error
 	if !na {
 		// Authorize by creating the API object
-		a, err = api.NewAPI(ctx, s.clientID, sd, s.cb, nil)
+		a, err = s.newAPI(ctx, sd, nil)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err = s.config.AddServer(id, server.TypeCustom, v2.Server{LastAuthorizeTime: time.Now()})
+	err = s.config.AddServer(id, server.TypeCustom, v3.Server{Base: v3.Base{LastAuthorizeTime: time.Now()}})
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +62,7 @@ func (s *Servers) GetCustom(ctx context.Context, id string, tok *eduoauth.Token,
 	if err != nil {
 		return nil, err
 	}
-	a, err := api.NewAPI(ctx, s.clientID, sd, s.cb, tok)
+	a, err := s.newAPI(ctx, sd, tok)
 	if err != nil {
 		return nil, err
 	}
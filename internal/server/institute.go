@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/eduvpn/eduvpn-common/internal/api"
-	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
 	"github.com/eduvpn/eduvpn-common/internal/discovery"
 	"github.com/eduvpn/eduvpn-common/types/server"
 	"github.com/jwijenbergh/eduoauth-go"
@@ -33,13 +33,13 @@ func (s *Servers) AddInstitute(ctx context.Context, disco *discovery.Discovery,
 	var a *api.API
 	if !na {
 		// Authorize by creating the API object
-		a, err = api.NewAPI(ctx, s.clientID, sd, s.cb, nil)
+		a, err = s.newAPI(ctx, sd, nil)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err = s.config.AddServer(dsrv.BaseURL, server.TypeInstituteAccess, v2.Server{LastAuthorizeTime: time.Now()})
+	err = s.config.AddServer(dsrv.BaseURL, server.TypeInstituteAccess, v3.Server{Base: v3.Base{LastAuthorizeTime: time.Now()}})
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +74,7 @@ func (s *Servers) GetInstitute(ctx context.Context, id string, disco *discovery.
 		DisableAuthorize: disableAuth,
 	}
 	// Authorize by creating the API object
-	a, err := api.NewAPI(ctx, s.clientID, sd, s.cb, tok)
+	a, err := s.newAPI(ctx, sd, tok)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/eduvpn/eduvpn-common/internal/api"
+	"github.com/eduvpn/eduvpn-common/internal/api/profiles"
+	"github.com/eduvpn/eduvpn-common/types/protocol"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Renewal is what is needed to renew the last configuration without any user interaction, e.g. ahead of expiry
+// It is created when a configuration is obtained and never changed afterwards
+type Renewal struct {
+	srv     *Server
+	profile profiles.Profile
+	protos  []protocol.Protocol
+	pTCP    bool
+	// wgKey is the WireGuard private key of the configuration, it is reused such that the tunnel keeps working
+	wgKey *wgtypes.Key
+}
+
+// Renewed is a configuration that was obtained by renewing
+// Nothing is saved until it is applied with ApplyRenewal
+type Renewed struct {
+	// Config is the new configuration
+	Config *srvtypes.Configuration
+	r      *Renewal
+	apicfg *api.ConnectData
+}
+
+// Renewal returns what is needed to renew the last configuration
+func (s *Servers) Renewal() (*Renewal, error) {
+	if s.last == nil {
+		return nil, errors.New("no configuration was obtained that can be renewed")
+	}
+	return s.last, nil
+}
+
+// Fetch gets a new configuration for the same profile, protocols and WireGuard key
+// It only does network requests and does not change the state, authorization is never triggered
+// If the profile is no longer valid or the tokens cannot be refreshed, an error is returned
+func (r *Renewal) Fetch(ctx context.Context) (*Renewed, error) {
+	a, err := r.srv.api()
+	if err != nil {
+		return nil, err
+	}
+	apicfg, err := a.NoAuthorize().Connect(ctx, r.profile, r.protos, r.pTCP, r.wgKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Renewed{
+		Config: configuration(apicfg, &r.profile, r.pTCP),
+		r:      r,
+		apicfg: apicfg,
+	}, nil
+}
+
+// ApplyRenewal saves the expiry time and the history of renewed configuration `rn`
+// It is only applied if no other configuration was obtained in the meantime
+func (s *Servers) ApplyRenewal(rn *Renewed) error {
+	if s.last != rn.r {
+		return errors.New("another configuration was obtained while renewing")
+	}
+	if err := rn.r.srv.apply(rn.r.profile.ID, rn.apicfg); err != nil {
+		return err
+	}
+	s.last = &Renewal{
+		srv:     rn.r.srv,
+		profile: rn.r.profile,
+		protos:  rn.r.protos,
+		pTCP:    rn.r.pTCP,
+		wgKey:   rn.apicfg.WireGuardKey,
+	}
+	return nil
+}
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	"github.com/eduvpn/eduvpn-common/internal/api"
-	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
 	"github.com/eduvpn/eduvpn-common/internal/discovery"
 	"github.com/eduvpn/eduvpn-common/internal/util"
 	"github.com/eduvpn/eduvpn-common/types/server"
@@ -44,13 +44,13 @@ func (s *Servers) AddSecure(ctx context.Context, disco *discovery.Discovery, org
 	var a *api.API
 	if !na {
 		// Authorize by creating the API object
-		a, err = api.NewAPI(ctx, s.clientID, sd, s.cb, nil)
+		a, err = s.newAPI(ctx, sd, nil)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err = s.config.AddServer(orgID, server.TypeSecureInternet, v2.Server{CountryCode: dsrv.CountryCode, LastAuthorizeTime: time.Now()})
+	err = s.config.AddServer(orgID, server.TypeSecureInternet, v3.Server{Base: v3.Base{CountryCode: dsrv.CountryCode, LastAuthorizeTime: time.Now()}})
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +92,7 @@ func (s *Servers) GetSecure(ctx context.Context, orgID string, disco *discovery.
 		DisableAuthorize: disableAuth,
 	}
 
-	a, err := api.NewAPI(ctx, s.clientID, sd, s.cb, tok)
+	a, err := s.newAPI(ctx, sd, tok)
 	if err != nil {
 		return nil, err
 	}
@@ -4,12 +4,11 @@ package server
 import (
 	"context"
 	"errors"
-	"os"
 	"time"
 
 	"github.com/eduvpn/eduvpn-common/internal/api"
 	"github.com/eduvpn/eduvpn-common/internal/api/profiles"
-	v2 "github.com/eduvpn/eduvpn-common/internal/config/v2"
+	v3 "github.com/eduvpn/eduvpn-common/internal/config/v3"
 	"github.com/eduvpn/eduvpn-common/types/protocol"
 	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
 )
@@ -19,7 +18,7 @@ type Server struct {
 	identifier string
 	t          srvtypes.Type
 	apiw       *api.API
-	storage    *v2.V2
+	storage    *v3.V3
 }
 
 // ErrInvalidProfile is an error that is returned when an invalid profile has been chosen
@@ -35,19 +34,23 @@ func (s *Servers) NewServer(identifier string, t srvtypes.Type, api *api.API) Se
 	}
 }
 
-// Profiles gets the profiles for the server
-// It only does a /info network request if the profiles have not been cached
-// force indicates whether or not the profiles should be fetched fresh
-func (s *Server) Profiles(ctx context.Context) (*profiles.Info, error) {
+// Profiles gets the profiles for the server that can be used with capabilities `caps`
+// It always does a /info network request
+// The filtered profiles are saved such that the profiles that are returned to clients are the same
+func (s *Server) Profiles(ctx context.Context, caps profiles.Capabilities) (*profiles.Info, error) {
 	a, err := s.api()
 	if err != nil {
 		return nil, err
 	}
-	// Otherwise get fresh profiles and set the cache
 	prfs, err := a.Info(ctx)
 	if err != nil {
 		return nil, err
 	}
+	// No profiles available
+	if prfs.Len() == 0 {
+		return nil, errors.New("the server has no available profiles for your account")
+	}
+	prfs = prfs.Filter(caps)
 	err = s.SetProfileList(prfs.Public())
 	if err != nil {
 		return nil, err
@@ -62,29 +65,84 @@ func (s *Server) api() (*api.API, error) {
 	return s.apiw, nil
 }
 
-func (s *Server) findProfile(ctx context.Context, wgSupport bool) (*profiles.Profile, error) {
-	// Get the profiles by ignoring the cache
-	prfs, err := s.Profiles(ctx)
-	if err != nil {
-		return nil, err
+// Capabilities returns the capabilities that decide which profiles can be used
+// `wgSupport` is whether or not the client supports WireGuard, `pref` is the protocol preference and `caps` are the capabilities that the client has declared
+// It returns an error if only WireGuard is preferred but the client does not support it, as no profile can then be used
+func Capabilities(wgSupport bool, pref protocol.Preference, caps srvtypes.Capabilities) (profiles.Capabilities, error) {
+	if pref == protocol.PreferenceOnlyWireGuard && !wgSupport {
+		return profiles.Capabilities{}, errors.New("only WireGuard is preferred but the client does not support WireGuard")
+	}
+	protos := []protocol.Protocol{protocol.OpenVPN}
+	if wgSupport {
+		protos = append(protos, protocol.WireGuard)
+	}
+	// Only one protocol is wanted, profiles that do not have it cannot be used
+	if pref.Only() {
+		protos = []protocol.Protocol{pref.Protocol()}
 	}
+	return profiles.Capabilities{
+		Protocols:          protos,
+		TCPOnly:            caps.TCPOnly,
+		DefaultGatewayOnly: caps.DefaultGatewayOnly,
+	}, nil
+}
 
-	// No profiles available
-	if prfs.Len() == 0 {
-		return nil, errors.New("the server has no available profiles for your account")
+// protocols returns the protocols to connect to profile `p` with WireGuard support `wgSupport` and protocol preference `pref`
+// If `tcpOnly` is true, only the protocols that the profile supports over TCP are returned
+// The most preferred protocol is first
+func protocols(p *profiles.Profile, wgSupport bool, pref protocol.Preference, tcpOnly bool) []protocol.Protocol {
+	var protos []protocol.Protocol
+	for _, proto := range []protocol.Protocol{protocol.OpenVPN, protocol.WireGuard} {
+		if proto == protocol.WireGuard && !wgSupport {
+			continue
+		}
+		// The server could otherwise give a configuration over UDP
+		if tcpOnly && !p.HasTCP(proto) {
+			continue
+		}
+		protos = append(protos, proto)
+	}
+	want := pref.Protocol()
+	usable := false
+	for _, proto := range protos {
+		if proto == want {
+			usable = true
+		}
+	}
+	if !usable {
+		return protos
+	}
+	// If the profile supports both protocols we only send the preferred one, such that the server cannot choose the other
+	if pref.Only() || (p.HasWireGuard() && p.HasOpenVPN()) {
+		return []protocol.Protocol{want}
 	}
+	if protos[0] != want {
+		protos[0], protos[len(protos)-1] = protos[len(protos)-1], protos[0]
+	}
+	return protos
+}
 
-	// No WireGuard support, we have to filter the profiles that only have WireGuard
-	if !wgSupport {
-		prfs = prfs.FilterWireGuard()
+func (s *Server) findProfile(ctx context.Context, caps profiles.Capabilities, pref protocol.Preference) (*profiles.Profile, error) {
+	// Get the profiles by ignoring the cache
+	prfs, err := s.Profiles(ctx, caps)
+	if err != nil {
+		return nil, err
 	}
 
 	var chosenP profiles.Profile
 
 	n := prfs.Len()
 	switch n {
-	// If we now get no profiles then that means a profile with only WireGuard was removed
+	// If we now get no profiles then that means the profiles were removed by filtering
 	case 0:
+		switch {
+		case caps.TCPOnly || caps.DefaultGatewayOnly:
+			return nil, errors.New("the server has no profiles that can be used with the capabilities of the client")
+		case pref == protocol.PreferenceOnlyOpenVPN:
+			return nil, errors.New("the server has no OpenVPN profiles but only OpenVPN is preferred")
+		case pref == protocol.PreferenceOnlyWireGuard:
+			return nil, errors.New("the server has no WireGuard profiles but only WireGuard is preferred")
+		}
 		return nil, errors.New("the server has only WireGuard profiles but the client does not support WireGuard")
 	case 1:
 		// Only one profile, make sure it is set
@@ -104,43 +162,68 @@ func (s *Server) findProfile(ctx context.Context, wgSupport bool) (*profiles.Pro
 	return &chosenP, nil
 }
 
-func (s *Server) connect(ctx context.Context, wgSupport bool, pTCP bool) (*srvtypes.Configuration, error) {
+// connect gets a VPN configuration for the server
+// `pref` is the client wide protocol preference, it is overridden by the preference of the server if that is not auto
+// `caps` are the capabilities that the client has declared
+// It returns the configuration and what is needed to renew it
+func (s *Server) connect(ctx context.Context, wgSupport bool, pref protocol.Preference, caps srvtypes.Capabilities, pTCP bool) (*srvtypes.Configuration, *Renewal, error) {
 	a, err := s.api()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// find a suitable profile to connect
-	chosenP, err := s.findProfile(ctx, wgSupport)
+	pref, err = s.Preference(pref)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	err = s.SetProfileID(chosenP.ID)
+	pcaps, err := Capabilities(wgSupport, pref, caps)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	protos := []protocol.Protocol{protocol.OpenVPN}
-	if wgSupport {
-		protos = append(protos, protocol.WireGuard)
+	// find a suitable profile to connect
+	chosenP, err := s.findProfile(ctx, pcaps, pref)
+	if err != nil {
+		return nil, nil, err
 	}
-	// If the client supports WireGuard and the profile supports both protocols we remove openvpn from client support if EDUVPN_PREFER_WG is set to "1"
-	// This also only happens if prefer TCP is set to false
-	// TODO: remove the prefer TCP check when we have implemented proxyguard
-	if wgSupport && os.Getenv("EDUVPN_PREFER_WG") == "1" {
-		if chosenP.HasWireGuard() && chosenP.HasOpenVPN() {
-			protos = []protocol.Protocol{protocol.WireGuard}
-		}
+	err = s.SetProfileID(chosenP.ID)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	protos := protocols(chosenP, wgSupport, pref, caps.TCPOnly)
+	// A client that can only connect over TCP always prefers it
+	pTCP = pTCP || caps.TCPOnly
 	// SAFETY: chosenP is guaranteed to be non-nil
-	apicfg, err := a.Connect(ctx, *chosenP, protos, pTCP)
+	apicfg, err := a.Connect(ctx, *chosenP, protos, pTCP, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	err = s.SetExpireTime(apicfg.Expires)
+	err = s.apply(chosenP.ID, apicfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	r := &Renewal{
+		srv:     s,
+		profile: *chosenP,
+		protos:  protos,
+		pTCP:    pTCP,
+		wgKey:   apicfg.WireGuardKey,
+	}
+	return configuration(apicfg, chosenP, pTCP), r, nil
+}
+
+// apply saves the expiry time and the history of configuration `apicfg` for profile `id` in the state file
+func (s *Server) apply(id string, apicfg *api.ConnectData) error {
+	err := s.SetExpireTime(apicfg.Expires)
+	if err != nil {
+		return err
 	}
+	return s.addHistory(id, apicfg.Protocol)
+}
+
+// configuration converts configuration `apicfg` for profile `p` into the type that is returned to the client
+func configuration(apicfg *api.ConnectData, p *profiles.Profile, pTCP bool) *srvtypes.Configuration {
 	var proxy *srvtypes.Proxy
 	if apicfg.Proxy != nil {
 		proxy = &srvtypes.Proxy{
@@ -149,14 +232,22 @@ func (s *Server) connect(ctx context.Context, wgSupport bool, pTCP bool) (*srvty
 			Peer:       apicfg.Proxy.Peer,
 		}
 	}
-	return &srvtypes.Configuration{
+	cfg := &srvtypes.Configuration{
 		VPNConfig:        apicfg.Configuration,
 		Protocol:         apicfg.Protocol,
-		DefaultGateway:   chosenP.DefaultGateway,
-		DNSSearchDomains: chosenP.DNSSearchDomains,
-		ShouldFailover:   chosenP.ShouldFailover() && !pTCP,
+		DefaultGateway:   p.DefaultGateway,
+		DNSSearchDomains: p.DNSSearchDomains,
+		ShouldFailover:   p.ShouldFailover() && !pTCP,
 		Proxy:            proxy,
-	}, nil
+		WireGuard:        apicfg.WireGuard,
+		OpenVPN:          apicfg.OpenVPN,
+		Expires:          apicfg.Expires.Unix(),
+		ExpiryMismatch:   apicfg.ExpiryMismatch,
+	}
+	if !apicfg.CertificateExpires.IsZero() {
+		cfg.CertificateExpires = apicfg.CertificateExpires.Unix()
+	}
+	return cfg
 }
 
 // Disconnect sends an API /disconnect to the server
@@ -168,7 +259,7 @@ func (s *Server) Disconnect(ctx context.Context) error {
 	return a.Disconnect(ctx)
 }
 
-func (s *Server) cfgServer() (*v2.Server, error) {
+func (s *Server) cfgServer() (*v3.Server, error) {
 	if s.storage == nil {
 		return nil, errors.New("cannot get server, no configuration passed")
 	}
@@ -205,6 +296,33 @@ func (s *Server) SetExpireTime(et time.Time) error {
 	return nil
 }
 
+// addHistory adds a connection with profile `id` and protocol `proto` to the history of the server
+func (s *Server) addHistory(id string, proto protocol.Protocol) error {
+	cs, err := s.cfgServer()
+	if err != nil {
+		return err
+	}
+	cs.AddHistory(v3.Connection{
+		Time:      time.Now(),
+		ProfileID: id,
+		Protocol:  proto,
+	})
+	return nil
+}
+
+// Preference gets the protocol preference for the server
+// If the server has no preference, `def` is returned
+func (s *Server) Preference(def protocol.Preference) (protocol.Preference, error) {
+	cs, err := s.cfgServer()
+	if err != nil {
+		return def, err
+	}
+	if cs.Preferences.Protocol == protocol.PreferenceAuto {
+		return def, nil
+	}
+	return cs.Preferences.Protocol, nil
+}
+
 // ProfileID gets the profile ID for the server
 func (s *Server) ProfileID() (string, error) {
 	cs, err := s.cfgServer()
@@ -232,7 +350,7 @@ func (s *Server) SetCurrent() error {
 	if s.storage == nil {
 		return errors.New("no storage available")
 	}
-	s.storage.LastChosen = &v2.ServerKey{
+	s.storage.LastChosen = &v3.ServerKey{
 		ID: s.identifier,
 		T:  s.t,
 	}
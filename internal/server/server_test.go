@@ -0,0 +1,137 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eduvpn/eduvpn-common/internal/api"
+	"github.com/eduvpn/eduvpn-common/internal/api/profiles"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
+	"github.com/eduvpn/eduvpn-common/internal/test"
+	"github.com/eduvpn/eduvpn-common/types/protocol"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestProtocols(t *testing.T) {
+	both := &profiles.Profile{VPNProtoList: []string{"openvpn", "wireguard"}}
+	ovpn := &profiles.Profile{VPNProtoList: []string{"openvpn"}}
+	wg := &profiles.Profile{VPNProtoList: []string{"wireguard"}}
+
+	ow := []protocol.Protocol{protocol.OpenVPN, protocol.WireGuard}
+	wo := []protocol.Protocol{protocol.WireGuard, protocol.OpenVPN}
+	o := []protocol.Protocol{protocol.OpenVPN}
+	w := []protocol.Protocol{protocol.WireGuard}
+	// WireGuard is only supported over UDP
+	wgUDP := &profiles.Profile{VPNProtoList: []string{"openvpn", "wireguard"}, VPNProtoTransportList: []string{"openvpn+udp", "openvpn+tcp", "wireguard+udp"}}
+	wgTCP := &profiles.Profile{VPNProtoList: []string{"openvpn", "wireguard"}, VPNProtoTransportList: []string{"openvpn+tcp", "wireguard+tcp"}}
+
+	cases := []struct {
+		p         *profiles.Profile
+		wgSupport bool
+		pref      protocol.Preference
+		tcpOnly   bool
+		want      []protocol.Protocol
+	}{
+		{p: both, wgSupport: true, pref: protocol.PreferenceAuto, want: ow},
+		{p: both, wgSupport: false, pref: protocol.PreferenceAuto, want: o},
+		{p: both, wgSupport: true, pref: protocol.PreferenceWireGuard, want: w},
+		{p: both, wgSupport: true, pref: protocol.PreferenceOpenVPN, want: o},
+		// no WireGuard support, the preference cannot be honoured
+		{p: both, wgSupport: false, pref: protocol.PreferenceWireGuard, want: o},
+		// the profile only supports one protocol, the preferred protocol is first
+		{p: ovpn, wgSupport: true, pref: protocol.PreferenceWireGuard, want: wo},
+		{p: wg, wgSupport: true, pref: protocol.PreferenceOpenVPN, want: ow},
+		{p: ovpn, wgSupport: true, pref: protocol.PreferenceOnlyOpenVPN, want: o},
+		{p: wg, wgSupport: true, pref: protocol.PreferenceOnlyWireGuard, want: w},
+		// a client that can only connect over TCP cannot get WireGuard over UDP
+		{p: wgUDP, wgSupport: true, pref: protocol.PreferenceAuto, tcpOnly: true, want: o},
+		{p: wgUDP, wgSupport: true, pref: protocol.PreferenceWireGuard, tcpOnly: true, want: o},
+		{p: wgUDP, wgSupport: true, pref: protocol.PreferenceAuto, want: ow},
+		{p: wgTCP, wgSupport: true, pref: protocol.PreferenceWireGuard, tcpOnly: true, want: w},
+		// old servers without a transport list only support TCP for OpenVPN
+		{p: both, wgSupport: true, pref: protocol.PreferenceAuto, tcpOnly: true, want: o},
+	}
+	for _, c := range cases {
+		if got := protocols(c.p, c.wgSupport, c.pref, c.tcpOnly); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("protocols not equal for profile: %v %v, WireGuard support: %v, preference: %v, TCP only: %v, got: %v, want: %v", c.p.VPNProtoList, c.p.VPNProtoTransportList, c.wgSupport, c.pref, c.tcpOnly, got, c.want)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	ow := []protocol.Protocol{protocol.OpenVPN, protocol.WireGuard}
+	o := []protocol.Protocol{protocol.OpenVPN}
+	w := []protocol.Protocol{protocol.WireGuard}
+
+	cases := []struct {
+		wgSupport bool
+		pref      protocol.Preference
+		caps      srvtypes.Capabilities
+		want      profiles.Capabilities
+		wantErr   string
+	}{
+		{wgSupport: true, pref: protocol.PreferenceAuto, want: profiles.Capabilities{Protocols: ow}},
+		{wgSupport: false, pref: protocol.PreferenceAuto, want: profiles.Capabilities{Protocols: o}},
+		// a preference does not filter
+		{wgSupport: true, pref: protocol.PreferenceWireGuard, want: profiles.Capabilities{Protocols: ow}},
+		{wgSupport: true, pref: protocol.PreferenceOnlyOpenVPN, want: profiles.Capabilities{Protocols: o}},
+		{wgSupport: true, pref: protocol.PreferenceOnlyWireGuard, want: profiles.Capabilities{Protocols: w}},
+		// no profile can be used
+		{wgSupport: false, pref: protocol.PreferenceOnlyWireGuard, wantErr: "only WireGuard is preferred but the client does not support WireGuard"},
+		{
+			wgSupport: true,
+			pref:      protocol.PreferenceAuto,
+			caps:      srvtypes.Capabilities{TCPOnly: true, DefaultGatewayOnly: true},
+			want:      profiles.Capabilities{Protocols: ow, TCPOnly: true, DefaultGatewayOnly: true},
+		},
+	}
+	for _, c := range cases {
+		got, err := Capabilities(c.wgSupport, c.pref, c.caps)
+		test.AssertError(t, err, c.wantErr)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("capabilities not equal for WireGuard support: %v, preference: %v, capabilities: %v, got: %v, want: %v", c.wgSupport, c.pref, c.caps, got, c.want)
+		}
+	}
+}
+
+func TestApplyRenewal(t *testing.T) {
+	cfg := &v3.V3{}
+	if err := cfg.AddServer("https://example.com/", srvtypes.TypeCustom, v3.Server{}); err != nil {
+		t.Fatalf("failed to add server: %v", err)
+	}
+	srvs := NewServers("client", nil, true, cfg)
+	srv := srvs.NewServer("https://example.com/", srvtypes.TypeCustom, nil)
+	r := &Renewal{srv: &srv, profile: profiles.Profile{ID: "a"}}
+	srvs.last = r
+
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	et := time.Unix(2000000, 0)
+	rn := &Renewed{r: r, apicfg: &api.ConnectData{Expires: et, Protocol: protocol.WireGuard, WireGuardKey: &key}}
+
+	// a renewal of an older configuration is not applied
+	srvs.last = &Renewal{srv: &srv}
+	test.AssertError(t, srvs.ApplyRenewal(rn), "another configuration was obtained while renewing")
+	cs, err := cfg.GetServer("https://example.com/", srvtypes.TypeCustom)
+	if err != nil {
+		t.Fatalf("failed to get server: %v", err)
+	}
+	if !cs.ExpireTime.IsZero() || len(cs.History) != 0 {
+		t.Fatalf("state changed by a renewal that was not applied: %v", cs)
+	}
+
+	srvs.last = r
+	if err = srvs.ApplyRenewal(rn); err != nil {
+		t.Fatalf("failed to apply renewal: %v", err)
+	}
+	if !cs.ExpireTime.Equal(et) || len(cs.History) != 1 || cs.History[0].ProfileID != "a" {
+		t.Fatalf("state not equal after applying a renewal: %v", cs)
+	}
+	if srvs.last.wgKey != &key {
+		t.Fatalf("WireGuard key was not kept for the next renewal")
+	}
+}
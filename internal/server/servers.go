@@ -6,8 +6,10 @@ import (
 	"fmt"
 
 	"github.com/eduvpn/eduvpn-common/internal/api"
-	"github.com/eduvpn/eduvpn-common/internal/config/v2"
+	"github.com/eduvpn/eduvpn-common/internal/api/profiles"
+	"github.com/eduvpn/eduvpn-common/internal/config/v3"
 	"github.com/eduvpn/eduvpn-common/internal/discovery"
+	"github.com/eduvpn/eduvpn-common/types/protocol"
 	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
 	"github.com/jwijenbergh/eduoauth-go"
 )
@@ -28,7 +30,17 @@ type Servers struct {
 	cb       Callbacks
 	// WGSupport defines whether or not wireguard support is enabled
 	WGSupport bool
-	config    *v2.V2
+	// AuthFlow defines which OAuth flow is used for authorization
+	AuthFlow api.AuthFlow
+	// Preference is the client wide protocol preference
+	// The preference of a server takes precedence if it is not auto
+	Preference protocol.Preference
+	// Capabilities are the capabilities that the client has declared, profiles that cannot be used with them are filtered
+	Capabilities srvtypes.Capabilities
+	config       *v3.V3
+	// last is what is needed to renew the last configuration
+	// It is only kept in memory such that e.g. the WireGuard key can be reused when renewing
+	last *Renewal
 }
 
 // Remove removes a server with id `identifier` and type `t`
@@ -36,8 +48,14 @@ func (s *Servers) Remove(identifier string, t srvtypes.Type) error {
 	return s.config.RemoveServer(identifier, t)
 }
 
+// newAPI creates a new API object for server data `sd` with the OAuth flow of the servers
+func (s *Servers) newAPI(ctx context.Context, sd api.ServerData, tok *eduoauth.Token) (*api.API, error) {
+	sd.AuthFlow = s.AuthFlow
+	return api.NewAPI(ctx, s.clientID, sd, s.cb, tok)
+}
+
 // NewServers creates a new servers struct
-func NewServers(name string, cb Callbacks, wgSupport bool, cfg *v2.V2) Servers {
+func NewServers(name string, cb Callbacks, wgSupport bool, cfg *v3.V3) Servers {
 	return Servers{
 		clientID:  name,
 		cb:        cb,
@@ -49,9 +67,9 @@ func NewServers(name string, cb Callbacks, wgSupport bool, cfg *v2.V2) Servers {
 // CurrentServer contains the information for the current active server
 type CurrentServer struct {
 	// it embeds the state file server
-	*v2.Server
+	*v3.Server
 	// Key is the server key
-	Key v2.ServerKey
+	Key v3.ServerKey
 	// srvs refers to the original servers manager
 	srvs *Servers
 }
@@ -71,7 +89,7 @@ func (cs *CurrentServer) ServerWithCallbacks(ctx context.Context, disco *discove
 }
 
 // GetServer gets a server from the state file
-func (s *Servers) GetServer(id string, t srvtypes.Type) (*v2.Server, error) {
+func (s *Servers) GetServer(id string, t srvtypes.Type) (*v3.Server, error) {
 	if s.config == nil {
 		return nil, errors.New("no configuration available")
 	}
@@ -96,6 +114,15 @@ func (s *Servers) PublicCurrent(disco *discovery.Discovery) (*srvtypes.Current,
 	return s.config.PublicCurrent(disco)
 }
 
+// ProfileCapabilities returns the capabilities that decide which profiles of server `srv` can be used
+func (s *Servers) ProfileCapabilities(srv *Server) (profiles.Capabilities, error) {
+	pref, err := srv.Preference(s.Preference)
+	if err != nil {
+		return profiles.Capabilities{}, err
+	}
+	return Capabilities(s.WGSupport, pref, s.Capabilities)
+}
+
 // ConnectWithCallbacks handles the /connect flow
 // It calls callbacks as needed
 func (s *Servers) ConnectWithCallbacks(ctx context.Context, srv *Server, pTCP bool) (*srvtypes.Configuration, error) {
@@ -107,7 +134,7 @@ func (s *Servers) ConnectWithCallbacks(ctx context.Context, srv *Server, pTCP bo
 	if err != nil {
 		return nil, err
 	}
-	cfg, err := srv.connect(ctx, s.WGSupport, pTCP)
+	cfg, err := s.connect(ctx, srv, pTCP)
 	if err == nil {
 		return cfg, nil
 	}
@@ -127,5 +154,15 @@ func (s *Servers) ConnectWithCallbacks(ctx context.Context, srv *Server, pTCP bo
 	if err != nil {
 		return nil, err
 	}
-	return srv.connect(ctx, s.WGSupport, pTCP)
+	return s.connect(ctx, srv, pTCP)
+}
+
+// connect gets a VPN configuration for server `srv` and remembers what is needed to renew it
+func (s *Servers) connect(ctx context.Context, srv *Server, pTCP bool) (*srvtypes.Configuration, error) {
+	cfg, r, err := srv.connect(ctx, s.WGSupport, s.Preference, s.Capabilities, pTCP)
+	if err != nil {
+		return nil, err
+	}
+	s.last = r
+	return cfg, nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -42,3 +43,32 @@ func ReplaceWAYF(template string, authURL string, orgID string) string {
 	template = strings.Replace(template, "@ORG_ID@", url.QueryEscape(orgID), 1)
 	return template
 }
+
+// WriteFileAtomic writes `data` to the file `filename` by first writing it to a temporary file in the same directory
+// This temporary file is synced and then renamed such that a crash never leaves a partially written file
+// The file can only be read and written by the current user
+func WriteFileAtomic(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file with error: %w", err)
+	}
+	tmp := f.Name()
+	// the temporary file is not needed anymore if the rename fails
+	defer os.Remove(tmp) //nolint:errcheck
+	if err = f.Chmod(0o600); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
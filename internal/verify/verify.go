@@ -7,28 +7,48 @@ import (
 	"github.com/jedisct1/go-minisign"
 )
 
+// DefaultKeys are the trusted public keys that are used when no keys are configured
+// keys taken from https://git.sr.ht/~eduvpn/disco.eduvpn.org#public-keys
+var DefaultKeys = []string{
+	"RWRtBSX1alxyGX+Xn3LuZnWUT0w//B6EmTJvgaAxBMYzlQeI+jdrO6KF", // fkooman@tuxed.net, kolla@uninett.no
+	"RWQKqtqvd0R7rUDp0rWzbtYPA3towPWcLDCl7eY9pBMMI/ohCmrS0WiM", // RoSp
+}
+
+// ValidKey returns an error if `key` is not a valid minisign public key
+func ValidKey(key string) error {
+	pk, err := minisign.NewPublicKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid minisign public key '%s' with error: %w", key, err)
+	}
+	if pk.SignatureAlgorithm != [2]byte{'E', 'd'} {
+		return fmt.Errorf("invalid minisign public key '%s' with algorithm: '%s'", key, pk.SignatureAlgorithm[:])
+	}
+	return nil
+}
+
 // Verify verifies the signature (.minisig file format) on signedJSON.
 //
 // expectedFileName must be set to the file type to be verified, either "server_list.json" or "organization_list.json".
 // minSign must be set to the minimum UNIX timestamp (without milliseconds) for the file version.
 // This value should not be smaller than the time on the previous document verified.
+// keys are the trusted minisign public keys, if it is empty DefaultKeys are used
 // forcePrehash indicates whether or not we want to force the use of prehashed signatures
 // In the future we want to remove this parameter and only allow prehashed signatures
 //
 // The return value will either be (true, nil) for a valid signature or (false, VerifyError) otherwise.
 //
-// Verify is a wrapper around verifyWithKeys where allowedPublicKeys is set to the list from https://git.sr.ht/~eduvpn/disco.eduvpn.org#public-keys.
+// Verify is a wrapper around verifyWithKeys.
 func Verify(
 	signatureFileContent string,
 	signedJSON []byte,
 	expectedFileName string,
 	minSignTime uint64,
+	keys []string,
 	forcePrehash bool,
 ) (bool, error) {
-	// keys taken from https://git.sr.ht/~eduvpn/disco.eduvpn.org#public-keys
-	keyStrs := []string{
-		"RWRtBSX1alxyGX+Xn3LuZnWUT0w//B6EmTJvgaAxBMYzlQeI+jdrO6KF", // fkooman@tuxed.net, kolla@uninett.no
-		"RWQKqtqvd0R7rUDp0rWzbtYPA3towPWcLDCl7eY9pBMMI/ohCmrS0WiM", // RoSp
+	keyStrs := keys
+	if len(keyStrs) == 0 {
+		keyStrs = DefaultKeys
 	}
 	return verifyWithKeys(
 		signatureFileContent,
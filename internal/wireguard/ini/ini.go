@@ -1,7 +1,8 @@
 // Package ini implements an opinionated ini parser that only implements what we exactly need for WireGuard configs
 // - key/values MUST live under a section
 // - empty section names are NOT allowed
-// - comments are indicated with a #
+// - comments are indicated with a # and are kept when the ini is written again
+// - sections with the same name, e.g. multiple [Peer] sections, and repeated keys are kept in order
 package ini
 
 import (
@@ -10,9 +11,14 @@ import (
 	"strings"
 )
 
+// isComment returns whether or not a line is a comment
+func isComment(f string) bool {
+	return strings.HasPrefix(f, "#")
+}
+
 // shouldSkip returns whether or not a line should be skipped, empty line (after whitespace omitting) or a comment
 func shouldSkip(f string) bool {
-	return f == "" || strings.HasPrefix(f, "#")
+	return f == "" || isComment(f)
 }
 
 // isSection returns whether a line is a section
@@ -43,64 +49,72 @@ func keyValue(f string) (string, string, error) {
 	return k, v, nil
 }
 
-// OrderedKeys is a slice of strings that is used for an ordered map
-type OrderedKeys []string
+// line is a single line within a section
+type line struct {
+	// key is the key of the line, it is empty for a comment
+	key string
+	// value is the value of the line, or the whole comment including the # for a comment
+	value string
+}
 
-func (ok *OrderedKeys) find(name string) int {
-	if ok == nil {
-		return -1
-	}
-	for i, v := range *ok {
-		if v == name {
-			return i
-		}
-	}
-	return -1
+// Section represents a single section within an ini file
+// It consists of multiple keys and values, where a key can occur multiple times, and comments
+type Section struct {
+	name  string
+	lines []line
 }
 
-// Remove removes a `name` from the OrderedKeys slice by finding the name
-// It is a no-op if the key does not exist
-func (ok *OrderedKeys) Remove(name string) {
-	idx := ok.find(name)
-	if idx == -1 {
-		return
-	}
-	*ok = append((*ok)[:idx], (*ok)[idx+1:]...)
+// Name returns the name of the section
+func (sec *Section) Name() string {
+	return sec.name
 }
 
-// Section represents a single section within an ini file
-// It consists of multiple key and values
-type Section struct {
-	keyValues map[string]string
-	keys      OrderedKeys
+// find returns the index of the first line with key `key` or -1 if it does not exist
+func (sec *Section) find(key string) int {
+	for i, l := range sec.lines {
+		if l.key != "" && l.key == key {
+			return i
+		}
+	}
+	return -1
 }
 
-// KeyValue gets a value for key `key`
+// KeyValue gets the first value for key `key`
 // It returns an error if the key does not exist
 func (sec *Section) KeyValue(key string) (string, error) {
-	if v, ok := sec.keyValues[key]; ok {
-		return v, nil
+	if i := sec.find(key); i != -1 {
+		return sec.lines[i].value, nil
 	}
 	return "", fmt.Errorf("key: '%s' does not exist", key)
 }
 
-func (sec *Section) newKeyValue(key string, value string) {
-	if sec.keyValues == nil {
-		sec.keyValues = make(map[string]string)
+// KeyValues gets all values for key `key` in order
+// It returns nil if the key does not exist
+func (sec *Section) KeyValues(key string) []string {
+	var vals []string
+	for _, l := range sec.lines {
+		if l.key != "" && l.key == key {
+			vals = append(vals, l.value)
+		}
 	}
-	sec.keyValues[key] = value
-	sec.keys = append(sec.keys, key)
+	return vals
+}
+
+// AppendKeyValue adds a value `value` for key `key`, even if the key already exists
+func (sec *Section) AppendKeyValue(key string, value string) {
+	sec.lines = append(sec.lines, line{key: key, value: value})
 }
 
 // AddOrReplaceKeyValue adds a key `key` with value `value`
-// If the key already exists it modifies the value
+// If the key already exists the first value is modified and the other values are removed
 func (sec *Section) AddOrReplaceKeyValue(key string, value string) {
-	_, err := sec.KeyValue(key)
-	if err == nil {
-		sec.keyValues[key] = value
+	i := sec.find(key)
+	if i == -1 {
+		sec.AppendKeyValue(key, value)
 		return
 	}
-	sec.newKeyValue(key, value)
+	sec.lines[i].value = value
+	sec.removeFrom(key, i+1)
 }
 
 // AddKeyValue adds a new key `key` with value `value`
@@ -111,75 +125,104 @@ func (sec *Section) AddKeyValue(key string, value string) error {
 	if err == nil {
 		return fmt.Errorf("key: '%s' already exists", key)
 	}
-	sec.newKeyValue(key, value)
+	sec.AppendKeyValue(key, value)
 	return nil
 }
 
-// RemoveKey removes a key `key` from the section
-// It returns an error if the key cannot be found
+// removeFrom removes all lines with key `key` starting from index `start`
+func (sec *Section) removeFrom(key string, start int) {
+	kept := sec.lines[:start]
+	for _, l := range sec.lines[start:] {
+		if l.key != "" && l.key == key {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	sec.lines = kept
+}
+
+// RemoveKey removes all values of key `key` from the section
+// It returns the first value or an error if the key cannot be found
 func (sec *Section) RemoveKey(key string) (string, error) {
-	if v, ok := sec.keyValues[key]; ok {
-		sec.keys.Remove(key)
-		delete(sec.keyValues, key)
-		return v, nil
+	v, err := sec.KeyValue(key)
+	if err != nil {
+		return "", fmt.Errorf("no key to remove with name: '%s'", key)
 	}
-	return "", fmt.Errorf("no key to remove with name: '%s'", key)
+	sec.removeFrom(key, 0)
+	return v, nil
 }
 
 // INI is the struct for a ini file
 type INI struct {
-	sections map[string]*Section
-	keys     OrderedKeys
+	// comments are the comments before the first section
+	comments []string
+	sections []*Section
 }
 
 // Empty returns true if there are no sections defined in the INI
 func (i *INI) Empty() bool {
-	return len(i.keys) == 0
+	return len(i.sections) == 0
 }
 
-// Section gets a section from the ini file
+// Section gets the first section with name `name` from the ini file
 func (i *INI) Section(name string) (*Section, error) {
-	if _, ok := i.sections[name]; ok {
-		return i.sections[name], nil
+	for _, s := range i.sections {
+		if s.name == name {
+			return s, nil
+		}
 	}
 	return nil, fmt.Errorf("section: '%s' does not exist", name)
 }
 
+// Sections gets all sections with name `name` in order
+// It returns nil if there are no sections with this name
+func (i *INI) Sections(name string) []*Section {
+	var secs []*Section
+	for _, s := range i.sections {
+		if s.name == name {
+			secs = append(secs, s)
+		}
+	}
+	return secs
+}
+
+// AppendSection adds a section with name `name`, even if a section with this name already exists
+func (i *INI) AppendSection(name string) *Section {
+	s := &Section{name: name}
+	i.sections = append(i.sections, s)
+	return s
+}
+
 // AddSection adds a section with name `name` and returns an error if the section already exists
 func (i *INI) AddSection(name string) error {
 	// get an existing section
 	_, err := i.Section(name)
 	if err == nil {
-		return errors.New("section: '%s' already exists")
-	}
-	if i.sections == nil {
-		i.sections = make(map[string]*Section)
+		return fmt.Errorf("section: '%s' already exists", name)
 	}
-	i.sections[name] = &Section{}
-	i.keys = append(i.keys, name)
+	i.AppendSection(name)
 	return nil
 }
 
 // String returns the representation of the ini as a string
 func (i *INI) String() string {
 	var out strings.Builder
-	for _, s := range i.keys {
-		sec, err := i.Section(s)
-		if err != nil {
-			continue
-		}
-		out.WriteString(fmt.Sprintf("[%s]\n", s))
+	for _, c := range i.comments {
+		out.WriteString(c + "\n")
+	}
+	for _, sec := range i.sections {
+		out.WriteString(fmt.Sprintf("[%s]\n", sec.name))
 
-		for _, k := range sec.keys {
-			v, err := sec.KeyValue(k)
-			if err != nil {
+		for _, l := range sec.lines {
+			if l.key == "" {
+				out.WriteString(l.value + "\n")
 				continue
 			}
 			delim := ""
-			if v != "" {
+			if l.value != "" {
 				delim = " "
 			}
-			out.WriteString(fmt.Sprintf("%s =%s%s\n", k, delim, v))
+			out.WriteString(fmt.Sprintf("%s =%s%s\n", l.key, delim, l.value))
 		}
 	}
 	return out.String()
@@ -191,42 +234,50 @@ func Parse(f string) INI {
 	lines := strings.Split(f, "\n")
 
 	var secs INI
-	sec := ""
-	for _, line := range lines {
+	var sec *Section
+	for _, l := range lines {
 		// clean the line
-		line = strings.TrimSpace(line)
+		l = strings.TrimSpace(l)
+
+		if isComment(l) {
+			// comments before the first section belong to the ini itself
+			if sec == nil {
+				secs.comments = append(secs.comments, l)
+			} else {
+				sec.lines = append(sec.lines, line{value: l})
+			}
+			continue
+		}
 
-		if shouldSkip(line) {
+		if shouldSkip(l) {
 			continue
 		}
 
-		if isSection(line) {
-			name := sectionName(line)
+		if isSection(l) {
+			name := sectionName(l)
 			// we do not allow sections with empty names
 			if name == "" {
 				continue
 			}
-			_ = secs.AddSection(name)
-			sec = name
+			sec = secs.AppendSection(name)
 			continue
 		}
 
 		// no section has been parsed yet
 		// we will ignore the rest of the values
-		if sec == "" {
+		if sec == nil {
 			continue
 		}
 
 		// split key and value
-		key, value, err := keyValue(line)
+		key, value, err := keyValue(l)
 		if err != nil {
 			continue
 		}
 
-		csec := secs.sections[sec]
 		// This adds a new key and value to the section
-		// If it already exists it ignores it as this function would return an error
-		_ = csec.AddKeyValue(key, value)
+		// If the key already exists the value is added as well
+		sec.AppendKeyValue(key, value)
 	}
 	return secs
 }
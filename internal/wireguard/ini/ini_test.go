@@ -160,70 +160,57 @@ func TestKeyValue(t *testing.T) {
 	}
 }
 
-func TestOrderedKeysFind(t *testing.T) {
-	cases := []struct {
-		v  OrderedKeys
-		in string
-		w  int
-	}{
-		{
-			v:  []string{""},
-			in: "test",
-			w:  -1,
-		},
-		{
-			v:  []string{"bla"},
-			in: "bla",
-			w:  0,
-		},
-		{
-			v:  []string{"ha"},
-			in: "bla",
-			w:  -1,
-		},
-		{
-			v:  []string{"ha", "ga"},
-			in: "ga",
-			w:  1,
-		},
+func TestSectionKeyValues(t *testing.T) {
+	sec := &Section{name: "Peer"}
+	if err := sec.AddKeyValue("AllowedIPs", "10.0.0.0/8"); err != nil {
+		t.Fatalf("failed to add key: %v", err)
 	}
+	test.AssertError(t, sec.AddKeyValue("AllowedIPs", "fd00::/8"), "key: 'AllowedIPs' already exists")
+	sec.AppendKeyValue("AllowedIPs", "fd00::/8")
+	sec.AppendKeyValue("Endpoint", "a:1")
+	sec.AppendKeyValue("AllowedIPs", "192.168.0.0/16")
 
-	for _, c := range cases {
-		g := c.v.find(c.in)
-		if g != c.w {
-			t.Fatalf("got: %v, want: %v", g, c.w)
-		}
+	if got := sec.KeyValues("AllowedIPs"); !reflect.DeepEqual(got, []string{"10.0.0.0/8", "fd00::/8", "192.168.0.0/16"}) {
+		t.Fatalf("values not equal, got: %v", got)
+	}
+	if got, _ := sec.KeyValue("AllowedIPs"); got != "10.0.0.0/8" {
+		t.Fatalf("first value not equal, got: %v", got)
 	}
-}
 
-func TestOrderedKeysRemove(t *testing.T) {
-	cases := []struct {
-		v   OrderedKeys
-		rem string
-		out OrderedKeys
-	}{
-		{
-			v:   []string{"bla"},
-			rem: "test",
-			out: []string{"bla"},
-		},
-		{
-			v:   []string{"bla"},
-			rem: "bla",
-			out: []string{},
-		},
-		{
-			v:   []string{"ha", "ga"},
-			rem: "ga",
-			out: []string{"ha"},
-		},
+	// replacing keeps the position of the first value and removes the others
+	sec.AddOrReplaceKeyValue("AllowedIPs", "0.0.0.0/0")
+	want := []line{{key: "AllowedIPs", value: "0.0.0.0/0"}, {key: "Endpoint", value: "a:1"}}
+	if !reflect.DeepEqual(sec.lines, want) {
+		t.Fatalf("lines not equal after replace, got: %v, want: %v", sec.lines, want)
 	}
 
-	for _, c := range cases {
-		c.v.Remove(c.rem)
-		if !reflect.DeepEqual(c.v, c.out) {
-			t.Fatalf("got: %v, want: %v", c.v, c.out)
-		}
+	v, err := sec.RemoveKey("Endpoint")
+	if err != nil || v != "a:1" {
+		t.Fatalf("failed to remove key, got: %v, %v", v, err)
+	}
+	_, err = sec.RemoveKey("Endpoint")
+	test.AssertError(t, err, "no key to remove with name: 'Endpoint'")
+	if sec.KeyValues("Endpoint") != nil {
+		t.Fatalf("removed key still exists")
+	}
+}
+
+func TestSections(t *testing.T) {
+	var i INI
+	if err := i.AddSection("Interface"); err != nil {
+		t.Fatalf("failed to add section: %v", err)
+	}
+	test.AssertError(t, i.AddSection("Interface"), "section: 'Interface' already exists")
+	p1 := i.AppendSection("Peer")
+	p2 := i.AppendSection("Peer")
+	if got := i.Sections("Peer"); len(got) != 2 || got[0] != p1 || got[1] != p2 {
+		t.Fatalf("peer sections not equal, got: %v", got)
+	}
+	if got, _ := i.Section("Peer"); got != p1 {
+		t.Fatalf("first peer section not equal, got: %v", got)
+	}
+	if i.Sections("None") != nil {
+		t.Fatalf("got sections for a name that does not exist")
 	}
 }
 
@@ -244,15 +231,12 @@ func TestParse(t *testing.T) {
 bla=val
 `,
 			want: INI{
-				sections: map[string]*Section{
-					"section1": {
-						keyValues: map[string]string{
-							"bla": "val",
-						},
-						keys: []string{"bla"},
+				sections: []*Section{
+					{
+						name:  "section1",
+						lines: []line{{key: "bla", value: "val"}},
 					},
 				},
-				keys: []string{"section1"},
 			},
 		},
 
@@ -274,26 +258,30 @@ AllowedIPs = 0.0.0.0/0,::/0
 Endpoint = vpn.example.org:443
 `,
 			want: INI{
-				sections: map[string]*Section{
-					"Interface": {
-						keyValues: map[string]string{
-							"MTU":        "1392",
-							"PrivateKey": "wowsoprivate=",
-							"Address":    "10.142.221.3/24,fdb6:645e:c74e:a648::3/64",
-							"DNS":        "9.9.9.9,2620:fe::fe",
+				comments: []string{
+					"# Portal: https://vpn.tuxed.net/vpn-user-portal/",
+					"# Profile: Default (default)",
+					"# Expires= 2025-01-23T15:56:58+00:00",
+				},
+				sections: []*Section{
+					{
+						name: "Interface",
+						lines: []line{
+							{key: "MTU", value: "1392"},
+							{key: "PrivateKey", value: "wowsoprivate="},
+							{key: "Address", value: "10.142.221.3/24,fdb6:645e:c74e:a648::3/64"},
+							{key: "DNS", value: "9.9.9.9,2620:fe::fe"},
 						},
-						keys: []string{"MTU", "PrivateKey", "Address", "DNS"},
 					},
-					"Peer": {
-						keyValues: map[string]string{
-							"PublicKey":  "whydidimockthisitspublic=",
-							"AllowedIPs": "0.0.0.0/0,::/0",
-							"Endpoint":   "vpn.example.org:443",
+					{
+						name: "Peer",
+						lines: []line{
+							{key: "PublicKey", value: "whydidimockthisitspublic="},
+							{key: "AllowedIPs", value: "0.0.0.0/0,::/0"},
+							{key: "Endpoint", value: "vpn.example.org:443"},
 						},
-						keys: []string{"PublicKey", "AllowedIPs", "Endpoint"},
 					},
 				},
-				keys: []string{"Interface", "Peer"},
 			},
 		},
 		{
@@ -311,7 +299,52 @@ PublicKey = whydidimockthisitspublic=
 AllowedIPs = 0.0.0.0/0,::/0
 Endpoint = vpn.example.org:443
 `,
-			want: INI{},
+			want: INI{
+				comments: []string{
+					"# Portal: https://vpn.tuxed.net/vpn-user-portal/",
+					"# Profile: Default (default)",
+					"# Expires= 2025-01-23T15:56:58+00:00",
+				},
+			},
+		},
+		// multiple sections with the same name and repeated keys
+		{
+			in: `
+[Interface]
+Address = 10.0.0.2/24
+Address = fd00::2/64
+[Peer]
+PublicKey = a=
+# the first peer
+AllowedIPs = 10.0.0.0/8
+AllowedIPs = fd00::/8
+[Peer]
+PublicKey = b=
+`,
+			want: INI{
+				sections: []*Section{
+					{
+						name: "Interface",
+						lines: []line{
+							{key: "Address", value: "10.0.0.2/24"},
+							{key: "Address", value: "fd00::2/64"},
+						},
+					},
+					{
+						name: "Peer",
+						lines: []line{
+							{key: "PublicKey", value: "a="},
+							{value: "# the first peer"},
+							{key: "AllowedIPs", value: "10.0.0.0/8"},
+							{key: "AllowedIPs", value: "fd00::/8"},
+						},
+					},
+					{
+						name:  "Peer",
+						lines: []line{{key: "PublicKey", value: "b="}},
+					},
+				},
+			},
 		},
 	}
 
@@ -323,3 +356,25 @@ Endpoint = vpn.example.org:443
 		}
 	}
 }
+
+func TestRoundTrip(t *testing.T) {
+	in := `# Portal: https://vpn.example.org/vpn-user-portal/
+# Expires= 2025-01-23T15:56:58+00:00
+[Interface]
+PrivateKey = priv=
+Address = 10.0.0.2/24
+Address = fd00::2/64
+[Peer]
+# the first peer
+PublicKey = a=
+AllowedIPs = 10.0.0.0/8
+AllowedIPs = fd00::/8
+[Peer]
+PublicKey = b=
+Endpoint =
+`
+	p := Parse(in)
+	if got := p.String(); got != in {
+		t.Fatalf("round trip not equal, got: %s, want: %s", got, in)
+	}
+}
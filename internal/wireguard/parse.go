@@ -0,0 +1,119 @@
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eduvpn/eduvpn-common/internal/wireguard/ini"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+)
+
+// list gets all values for key `key` and splits the comma separated values into their trimmed, non-empty elements
+// A key can be repeated, e.g. multiple Address lines, the elements of all of them are returned in order
+func list(sec *ini.Section, key string) []string {
+	var l []string
+	for _, v := range sec.KeyValues(key) {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				l = append(l, e)
+			}
+		}
+	}
+	return l
+}
+
+// optionalInt parses the value for key `key` as an integer
+// It returns 0 if the key does not exist or is empty
+// PersistentKeepalive can also be "off", wg(8) accepts this to disable it which is the same as 0
+func optionalInt(sec *ini.Section, key string) (int, error) {
+	v, err := sec.KeyValue(key)
+	if err != nil || v == "" || (key == "PersistentKeepalive" && v == "off") {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for key: '%s' with error: %w", key, err)
+	}
+	return i, nil
+}
+
+// optionalString returns the value for key `key` or an empty string if it does not exist
+func optionalString(sec *ini.Section, key string) string {
+	v, _ := sec.KeyValue(key)
+	return v
+}
+
+func parseInterface(sec *ini.Section) (*srvtypes.WireGuardInterface, error) {
+	pk, err := sec.KeyValue("PrivateKey")
+	if err != nil {
+		return nil, err
+	}
+	mtu, err := optionalInt(sec, "MTU")
+	if err != nil {
+		return nil, err
+	}
+	lp, err := optionalInt(sec, "ListenPort")
+	if err != nil {
+		return nil, err
+	}
+	return &srvtypes.WireGuardInterface{
+		PrivateKey: pk,
+		Addresses:  list(sec, "Address"),
+		DNS:        list(sec, "DNS"),
+		MTU:        mtu,
+		ListenPort: lp,
+	}, nil
+}
+
+func parsePeer(sec *ini.Section) (*srvtypes.WireGuardPeer, error) {
+	pub, err := sec.KeyValue("PublicKey")
+	if err != nil {
+		return nil, err
+	}
+	ka, err := optionalInt(sec, "PersistentKeepalive")
+	if err != nil {
+		return nil, err
+	}
+	return &srvtypes.WireGuardPeer{
+		PublicKey:           pub,
+		PresharedKey:        optionalString(sec, "PresharedKey"),
+		AllowedIPs:          list(sec, "AllowedIPs"),
+		Endpoint:            optionalString(sec, "Endpoint"),
+		PersistentKeepalive: ka,
+	}, nil
+}
+
+// Parse parses the WireGuard config `cfg` into its typed representation
+// It returns an error if the interface section or all peer sections are missing or if a required key is missing
+func Parse(cfg string) (*srvtypes.WireGuardConfig, error) {
+	secs := ini.Parse(cfg)
+	if secs.Empty() {
+		return nil, errors.New("parsed ini is empty")
+	}
+	is, err := secs.Section("Interface")
+	if err != nil {
+		return nil, err
+	}
+	iface, err := parseInterface(is)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing WireGuard interface with error: %w", err)
+	}
+	pss := secs.Sections("Peer")
+	if len(pss) == 0 {
+		return nil, errors.New("section: 'Peer' does not exist")
+	}
+	peers := make([]srvtypes.WireGuardPeer, 0, len(pss))
+	for i, ps := range pss {
+		peer, err := parsePeer(ps)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing WireGuard peer: %d with error: %w", i+1, err)
+		}
+		peers = append(peers, *peer)
+	}
+	return &srvtypes.WireGuardConfig{
+		Interface: *iface,
+		Peers:     peers,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package wireguard
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eduvpn/eduvpn-common/internal/test"
+	srvtypes "github.com/eduvpn/eduvpn-common/types/server"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		config string
+		want   *srvtypes.WireGuardConfig
+		werr   string
+	}{
+		{
+			config: ``,
+			werr:   "parsed ini is empty",
+		},
+		{
+			config: `
+[Peer]
+PublicKey = pub
+`,
+			werr: "section: 'Interface' does not exist",
+		},
+		{
+			config: `
+[Interface]
+PrivateKey = priv
+`,
+			werr: "section: 'Peer' does not exist",
+		},
+		{
+			config: `
+[Interface]
+PrivateKey = priv
+MTU = large
+[Peer]
+PublicKey = pub
+`,
+			werr: "failed parsing WireGuard interface with error: invalid value for key: 'MTU' with error: strconv.Atoi: parsing \"large\": invalid syntax",
+		},
+		{
+			config: `
+[Interface]
+PrivateKey = priv
+[Peer]
+AllowedIPs = 0.0.0.0/0
+`,
+			werr: "failed parsing WireGuard peer: 1 with error: key: 'PublicKey' does not exist",
+		},
+		{
+			config: `
+[Interface]
+MTU = 1392
+PrivateKey = priv
+Address = 10.146.176.5/24, fdee:1ead:29e8:22a2::5/64
+DNS = 9.9.9.9,2620:fe::fe,example.org
+
+[Peer]
+PublicKey = pub
+PresharedKey = psk
+AllowedIPs = 0.0.0.0/0,::/0
+Endpoint = vpn.example.org:51820
+PersistentKeepalive = 25
+`,
+			want: &srvtypes.WireGuardConfig{
+				Interface: srvtypes.WireGuardInterface{
+					PrivateKey: "priv",
+					Addresses:  []string{"10.146.176.5/24", "fdee:1ead:29e8:22a2::5/64"},
+					DNS:        []string{"9.9.9.9", "2620:fe::fe", "example.org"},
+					MTU:        1392,
+				},
+				Peers: []srvtypes.WireGuardPeer{
+					{
+						PublicKey:           "pub",
+						PresharedKey:        "psk",
+						AllowedIPs:          []string{"0.0.0.0/0", "::/0"},
+						Endpoint:            "vpn.example.org:51820",
+						PersistentKeepalive: 25,
+					},
+				},
+			},
+		},
+		// the keepalive can be disabled with off
+		{
+			config: `
+[Interface]
+PrivateKey = priv
+
+[Peer]
+PublicKey = pub
+PersistentKeepalive = off
+`,
+			want: &srvtypes.WireGuardConfig{
+				Interface: srvtypes.WireGuardInterface{PrivateKey: "priv"},
+				Peers:     []srvtypes.WireGuardPeer{{PublicKey: "pub"}},
+			},
+		},
+		// multiple peers and repeated keys
+		{
+			config: `
+[Interface]
+PrivateKey = priv
+Address = 10.0.0.2/24
+Address = fd00::2/64, fd01::2/64
+
+[Peer]
+PublicKey = a
+AllowedIPs = 10.0.0.0/8
+AllowedIPs = fd00::/8
+
+[Peer]
+PublicKey = b
+AllowedIPs = 0.0.0.0/0
+`,
+			want: &srvtypes.WireGuardConfig{
+				Interface: srvtypes.WireGuardInterface{
+					PrivateKey: "priv",
+					Addresses:  []string{"10.0.0.2/24", "fd00::2/64", "fd01::2/64"},
+				},
+				Peers: []srvtypes.WireGuardPeer{
+					{PublicKey: "a", AllowedIPs: []string{"10.0.0.0/8", "fd00::/8"}},
+					{PublicKey: "b", AllowedIPs: []string{"0.0.0.0/0"}},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := Parse(c.config)
+		test.AssertError(t, err, c.werr)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("Got parsed config: %v, not equal to: %v", got, c.want)
+		}
+	}
+}
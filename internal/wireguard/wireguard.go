@@ -101,9 +101,20 @@ func configReplace(cfg string, key wgtypes.Key, proxy string) (string, string, e
 	is.AddOrReplaceKeyValue("PrivateKey", key.String())
 	peer := ""
 	if proxy != "" {
-		ps, err := secs.Section("Peer")
-		if err != nil {
-			return "", "", err
+		// the peer that is proxied is the one with the proxy endpoint
+		// as there is only one proxy, only one peer can have it
+		var ps *ini.Section
+		for _, s := range secs.Sections("Peer") {
+			if _, err := s.KeyValue("ProxyEndpoint"); err != nil {
+				continue
+			}
+			if ps != nil {
+				return "", "", errors.New("multiple peers with a proxy endpoint")
+			}
+			ps = s
+		}
+		if ps == nil {
+			return "", "", errors.New("no peer with a proxy endpoint")
 		}
 		peer, err = ps.RemoveKey("ProxyEndpoint")
 		if err != nil {
@@ -47,6 +47,7 @@ interface
 PrivateKey = %s
 [interface]
 [interface2]
+[Interface]
 `, k.String()),
 			wantep: "",
 			proxy:  "",
@@ -79,6 +80,63 @@ Endpoint = 127.0.0.1:1337
 			proxy:  "127.0.0.1:1337",
 			werr:   "",
 		},
+		{
+			config: `
+# Portal: https://vpn.example.org/vpn-user-portal/
+[Interface]
+PrivateKey =
+Address = 10.146.176.5/24
+Address = fdee:1ead:29e8:22a2::5/64
+
+[Peer]
+PublicKey = a=
+AllowedIPs = 10.0.0.0/8
+AllowedIPs = fd00::/8
+Endpoint = a.example.org:51820
+
+[Peer]
+PublicKey = b=
+AllowedIPs = 0.0.0.0/0,::/0
+ProxyEndpoint = https://vpn.example.org/example
+`,
+			want: fmt.Sprintf(`# Portal: https://vpn.example.org/vpn-user-portal/
+[Interface]
+PrivateKey = %s
+Address = 10.146.176.5/24
+Address = fdee:1ead:29e8:22a2::5/64
+[Peer]
+PublicKey = a=
+AllowedIPs = 10.0.0.0/8
+AllowedIPs = fd00::/8
+Endpoint = a.example.org:51820
+[Peer]
+PublicKey = b=
+AllowedIPs = 0.0.0.0/0,::/0
+Endpoint = 127.0.0.1:1337
+`, k.String()),
+			wantep: "https://vpn.example.org/example",
+			proxy:  "127.0.0.1:1337",
+		},
+		{
+			config: `
+[Interface]
+[Peer]
+ProxyEndpoint = https://a.example.org/
+[Peer]
+ProxyEndpoint = https://b.example.org/
+`,
+			proxy: "127.0.0.1:1337",
+			werr:  "multiple peers with a proxy endpoint",
+		},
+		{
+			config: `
+[Interface]
+[Peer]
+Endpoint = a.example.org:51820
+`,
+			proxy: "127.0.0.1:1337",
+			werr:  "no peer with a proxy endpoint",
+		},
 	}
 
 	for _, c := range cases {
@@ -17,6 +17,8 @@ type Organizations struct {
 	// Timestamp is a timestamp that is internally used by the Go library to keep track of when the organizations was last updated
 	// You can also use this for logging
 	Timestamp time.Time `json:"go_timestamp"`
+	// Validators are used internally by the Go library to only download the list again when it has changed
+	Validators
 }
 
 // Organization is the type that defines the upstream discovery format for a single organization
@@ -44,6 +46,17 @@ type Servers struct {
 	// Timestamp is a timestamp that is internally used by the Go library to keep track of when the organizations was last updated
 	// You can also use this for logging
 	Timestamp time.Time `json:"go_timestamp"`
+	// Validators are used internally by the Go library to only download the list again when it has changed
+	Validators
+}
+
+// Validators are the HTTP cache validators that the discovery server returned for a list
+// They are sent with conditional requests such that an unchanged list is not downloaded again
+type Validators struct {
+	// ETag is the value of the ETag header, omitted if empty
+	ETag string `json:"go_etag,omitempty"`
+	// LastModified is the value of the Last-Modified header, omitted if empty
+	LastModified string `json:"go_last_modified,omitempty"`
 }
 
 // Server is a signle discovery server
@@ -66,6 +79,42 @@ type Server struct {
 	SupportContact []string `json:"support_contact"`
 }
 
+// OrganizationResult is an organization that matched a search query
+type OrganizationResult struct {
+	// Organization is the matched organization
+	Organization
+	// Score is how well the organization matched, higher is better
+	Score int `json:"score"`
+}
+
+// ServerResult is a server that matched a search query
+type ServerResult struct {
+	// Server is the matched server
+	Server
+	// Score is how well the server matched, higher is better
+	Score int `json:"score"`
+}
+
+// SearchResults are the results of a discovery search, each list is sorted by score from high to low
+type SearchResults struct {
+	// Organizations is the list of matched organizations, omitted if empty
+	Organizations []OrganizationResult `json:"organizations,omitempty"`
+	// Servers is the list of matched institute access servers, omitted if empty
+	Servers []ServerResult `json:"servers,omitempty"`
+}
+
+// Config is the configuration of the discovery source
+type Config struct {
+	// URL is the base URL where the discovery files and signatures are fetched from
+	// If it is empty the default of "https://disco.eduvpn.org/v2/" is used
+	URL string `json:"url,omitempty"`
+	// Keys is the list of trusted minisign public keys, e.g. "RWRtBSX1alxyGX+Xn3LuZnWUT0w//B6EmTJvgaAxBMYzlQeI+jdrO6KF"
+	// If it is empty the keys of disco.eduvpn.org are used
+	Keys []string `json:"keys,omitempty"`
+	// ForcePrehash is whether or not the discovery files must be signed with a prehashed signature
+	ForcePrehash bool `json:"force_prehash,omitempty"`
+}
+
 // MapOrString is a custom type as the upstream discovery format is a map or a value.
 // This library always marshals the data as a map and then makes sure unmarshalling also gives a map
 type MapOrString map[string]string
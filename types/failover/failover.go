@@ -0,0 +1,26 @@
+// Package failover contains the public types that have to do with failover
+package failover
+
+// ProbeType defines an 'enumeration' of probes that check if the gateway can be reached
+type ProbeType int8
+
+const (
+	// ProbeICMP sends ICMP echo requests (pings) to the gateway, this is the default
+	ProbeICMP ProbeType = iota
+	// ProbeTCP connects to a TCP port on the gateway, a refused connection also counts as a reply
+	ProbeTCP
+	// ProbeUDP sends a datagram to a UDP port on the gateway, which must reply to it or send an ICMP port unreachable
+	ProbeUDP
+	// ProbeHTTPS sends a HTTPS HEAD request, any HTTP response, TLS alert or certificate that cannot be verified counts as a reply
+	ProbeHTTPS
+)
+
+// Probe is the configuration of the probe that failover uses
+type Probe struct {
+	// Type is the type of probe
+	Type ProbeType `json:"type"`
+	// Port is the port on the gateway for the TCP and UDP probes
+	Port int `json:"port,omitempty"`
+	// URL is the URL for the HTTPS probe, if it is empty the root of the gateway is used
+	URL string `json:"url,omitempty"`
+}
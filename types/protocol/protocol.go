@@ -26,3 +26,43 @@ func New(p string) Protocol {
 		return Unknown
 	}
 }
+
+// Preference defines an 'enumeration' of protocol preferences
+// The values for preferring a protocol are equal to the values of the protocol itself
+type Preference int8
+
+const (
+	// PreferenceAuto indicates that there is no preference, the server chooses the protocol
+	PreferenceAuto Preference = iota
+	// PreferenceOpenVPN indicates that OpenVPN is preferred if a profile supports both protocols
+	PreferenceOpenVPN
+	// PreferenceWireGuard indicates that WireGuard is preferred if a profile supports both protocols
+	PreferenceWireGuard
+	// PreferenceOnlyOpenVPN indicates that only OpenVPN should be used
+	PreferenceOnlyOpenVPN
+	// PreferenceOnlyWireGuard indicates that only WireGuard should be used
+	PreferenceOnlyWireGuard
+)
+
+// Valid returns whether or not the preference is known
+func (p Preference) Valid() bool {
+	return p >= PreferenceAuto && p <= PreferenceOnlyWireGuard
+}
+
+// Protocol returns the protocol that is preferred
+// It returns Unknown for PreferenceAuto
+func (p Preference) Protocol() Protocol {
+	switch p {
+	case PreferenceOpenVPN, PreferenceOnlyOpenVPN:
+		return OpenVPN
+	case PreferenceWireGuard, PreferenceOnlyWireGuard:
+		return WireGuard
+	default:
+		return Unknown
+	}
+}
+
+// Only returns whether or not only the preferred protocol should be used
+func (p Preference) Only() bool {
+	return p == PreferenceOnlyOpenVPN || p == PreferenceOnlyWireGuard
+}
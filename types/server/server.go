@@ -86,6 +86,27 @@ type Profile struct {
 	// E.g. {"en": "Default Profile"}
 	// If this is empty, the field is omitted from the JSON
 	DisplayName map[string]string `json:"display_name,omitempty"`
+	// DefaultGateway is whether or not the VPN should be configured as the default gateway for this profile
+	DefaultGateway bool `json:"default_gateway"`
+	// DNSSearchDomains are the DNS search domains of the profile
+	// If this is empty, the field is omitted from the JSON
+	DNSSearchDomains []string `json:"dns_search_domains,omitempty"`
+	// VPNProtoList are the VPN protocols that the profile supports, e.g. ["openvpn", "wireguard"]
+	// If this is empty, the field is omitted from the JSON
+	VPNProtoList []string `json:"vpn_proto_list,omitempty"`
+	// VPNProtoTransportList are the VPN protocols that the profile supports including their transport, e.g. ["openvpn+udp", "wireguard+udp"]
+	// This is empty for servers that do not give this list, then the field is omitted from the JSON
+	VPNProtoTransportList []string `json:"vpn_proto_transport_list,omitempty"`
+}
+
+// Capabilities are the capabilities that a client declares
+// Profiles that cannot be used with these capabilities are not shown and cannot be chosen
+type Capabilities struct {
+	// TCPOnly indicates that the client can only connect over TCP, e.g. because UDP is blocked
+	// Only profiles that support a protocol over TCP are kept and TCP is always preferred
+	TCPOnly bool `json:"tcp_only,omitempty"`
+	// DefaultGatewayOnly indicates that the client can only use profiles that are a default gateway
+	DefaultGatewayOnly bool `json:"default_gateway_only,omitempty"`
 }
 
 // Profiles is the map of profiles with the current defined
@@ -109,6 +130,20 @@ type Tokens struct {
 	Expires int64 `json:"expires_at"`
 }
 
+// DeviceAuthorization is the data that is given to the client when the OAuth device authorization grant is started
+// The client should show the user code and the verification URI to the user, see https://datatracker.ietf.org/doc/html/rfc8628#section-3.3
+type DeviceAuthorization struct {
+	// UserCode is the code that the user has to enter at the verification URI
+	UserCode string `json:"user_code"`
+	// VerificationURI is the URI the user has to visit, on any device, to authorize
+	VerificationURI string `json:"verification_uri"`
+	// VerificationURIComplete is the verification URI that already includes the user code, e.g. for a QR code
+	// Omitted if the server did not return it
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	// ExpiresAt is the Unix timestamp after which the user code is no longer valid
+	ExpiresAt int64 `json:"expires_at"`
+}
+
 // Server is the basic type for a server. This is the base for secure internet and institute access. Custom servers are equal to this type
 type Server struct {
 	// DisplayName is the map from language tags to display name. If this is empty, the field is omitted from the JSON
@@ -157,6 +192,33 @@ type List struct {
 	Custom []Server `json:"custom_servers,omitempty"`
 }
 
+// ExportVersion is the version of the exported server list document
+const ExportVersion = 1
+
+// Exported is a portable document of the configured servers, see ExportServers and ImportServers in exports/exports.go
+type Exported struct {
+	// Version is the version of the document, ExportVersion
+	Version int `json:"v"`
+	// Servers is the list of exported servers
+	Servers []ExportedServer `json:"servers"`
+}
+
+// ExportedServer is a single server in the exported document
+type ExportedServer struct {
+	// Type is the type of server
+	Type Type `json:"server_type"`
+	// Identifier is the Base URL for Institute Access and Custom Server. For Secure Internet this is the organization ID
+	Identifier string `json:"identifier"`
+	// ProfileID is the chosen profile, omitted if none has been chosen
+	ProfileID string `json:"profile_id,omitempty"`
+	// CountryCode is the chosen secure internet location, omitted for other server types
+	CountryCode string `json:"country_code,omitempty"`
+	// Current is true if this is the server that was last connected to
+	Current bool `json:"current,omitempty"`
+	// Tokens are the OAuth tokens for the server, only present if they were explicitly exported
+	Tokens *Tokens `json:"tokens,omitempty"`
+}
+
 // Proxy defines the structure with the arguments that should be passed to start proxyguard
 type Proxy struct {
 	// SourcePort is the source port for the client TCP connection
@@ -170,7 +232,8 @@ type Proxy struct {
 // Configuration is the configuration that you get back when you call the get config function
 type Configuration struct {
 	// VPNConfig is the VPN Configuration, a WireGuard or OpenVPN Configuration
-	// In case of OpenVPN, we append "script-security 0" to disable scripts from being run by default.
+	// In case of OpenVPN, directives that run scripts, load plugins or write files are removed
+	// and we append "script-security 0" to disable scripts from being run by default.
 	// A client may override this, e.g. for, very trusted, pre-provisioned VPNs
 	VPNConfig string `json:"config"`
 	// Protocol defines which protocol the configuration is for, OpenVPN or WireGuard
@@ -184,6 +247,88 @@ type Configuration struct {
 	// Proxy returns information for proxied VPN connections
 	// If this is non-nil a proxy must be started using StartProxyguard
 	Proxy *Proxy `json:"proxy,omitempty"`
+	// WireGuard is the parsed WireGuard configuration, it is the same configuration as VPNConfig
+	// This is only non-nil for WireGuard, omitted from the JSON otherwise
+	WireGuard *WireGuardConfig `json:"wireguard,omitempty"`
+	// OpenVPN is the structured view of the OpenVPN configuration, it is the same configuration as VPNConfig
+	// This is only non-nil for OpenVPN, omitted from the JSON otherwise
+	OpenVPN *OpenVPNConfig `json:"openvpn,omitempty"`
+	// Expires is the Unix timestamp when the VPN configuration expires, taken from the "Expires" header of the server
+	Expires int64 `json:"expires"`
+	// CertificateExpires is the Unix timestamp when the OpenVPN client certificate expires
+	// This is only non-zero for OpenVPN configurations with an inline certificate that can be parsed, omitted from the JSON otherwise
+	CertificateExpires int64 `json:"certificate_expires,omitempty"`
+	// ExpiryMismatch is true if Expires and CertificateExpires differ too much
+	// This indicates clock skew or a misconfigured server
+	ExpiryMismatch bool `json:"expiry_mismatch,omitempty"`
+}
+
+// OpenVPNRemote is a remote of an OpenVPN configuration
+type OpenVPNRemote struct {
+	// Host is the hostname or IP of the remote
+	Host string `json:"host"`
+	// Port is the port of the remote
+	Port int `json:"port"`
+	// Protocol is the protocol of the remote, e.g. "udp" or "tcp-client"
+	Protocol string `json:"protocol"`
+}
+
+// OpenVPNRoute is a route of an OpenVPN configuration
+type OpenVPNRoute struct {
+	// Network is the network of the route, for IPv6 this includes the prefix length
+	Network string `json:"network"`
+	// Netmask is the netmask of an IPv4 route, omitted if empty
+	Netmask string `json:"netmask,omitempty"`
+	// Gateway is the gateway of the route, omitted if empty
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// OpenVPNConfig is a structured view of an OpenVPN configuration
+type OpenVPNConfig struct {
+	// Remotes are the remotes in order
+	Remotes []OpenVPNRemote `json:"remotes,omitempty"`
+	// Protocols are the distinct protocols of the remotes in order
+	Protocols []string `json:"protocols,omitempty"`
+	// Ciphers are the data channel ciphers
+	Ciphers []string `json:"ciphers,omitempty"`
+	// Routes are the IPv4 and IPv6 routes
+	Routes []OpenVPNRoute `json:"routes,omitempty"`
+}
+
+// WireGuardInterface is the interface section of a WireGuard configuration
+type WireGuardInterface struct {
+	// PrivateKey is the base64 encoded private key
+	PrivateKey string `json:"private_key"`
+	// Addresses are the IP addresses with prefix length of the interface, e.g. "10.0.0.2/24"
+	Addresses []string `json:"addresses,omitempty"`
+	// DNS are the DNS servers and search domains, omitted if empty
+	DNS []string `json:"dns,omitempty"`
+	// MTU is the MTU of the interface, omitted if not set
+	MTU int `json:"mtu,omitempty"`
+	// ListenPort is the port to listen on, omitted if not set
+	ListenPort int `json:"listen_port,omitempty"`
+}
+
+// WireGuardPeer is a peer section of a WireGuard configuration
+type WireGuardPeer struct {
+	// PublicKey is the base64 encoded public key of the peer
+	PublicKey string `json:"public_key"`
+	// PresharedKey is the base64 encoded preshared key, omitted if empty
+	PresharedKey string `json:"preshared_key,omitempty"`
+	// AllowedIPs are the IP ranges that are routed to the peer, e.g. "0.0.0.0/0"
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+	// Endpoint is the host:port of the peer, when proxied this is the local proxy listener
+	Endpoint string `json:"endpoint,omitempty"`
+	// PersistentKeepalive is the keepalive interval in seconds, omitted if not set
+	PersistentKeepalive int `json:"persistent_keepalive,omitempty"`
+}
+
+// WireGuardConfig is a parsed WireGuard configuration
+type WireGuardConfig struct {
+	// Interface is the interface section
+	Interface WireGuardInterface `json:"interface"`
+	// Peers are the peer sections
+	Peers []WireGuardPeer `json:"peers"`
 }
 
 // Current is the struct that defines the current server
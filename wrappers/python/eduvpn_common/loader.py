@@ -1,12 +1,14 @@
 import pathlib
 import platform
 from collections import defaultdict
-from ctypes import CDLL, c_char_p, c_int, c_void_p, cdll
+from ctypes import CDLL, c_char_p, c_int, c_longlong, c_void_p, cdll
 
 from eduvpn_common import __version__
 from eduvpn_common.types import (
     BoolError,
     DataError,
+    ExpiryCB,
+    LivenessCB,
     ReadRxBytes,
     TokenGetter,
     TokenSetter,
@@ -66,9 +68,12 @@ def initialize_functions(lib: CDLL) -> None:
     # See https://stackoverflow.com/questions/13445568/python-ctypes-how-to-free-memory-getting-invalid-pointer-error
     lib.Deregister.argtypes, lib.Deregister.restype = [], None
     lib.ExpiryTimes.argtypes, lib.ExpiryTimes.restype = [], DataError
+    lib.SetExpiryCallback.argtypes, lib.SetExpiryCallback.restype = [ExpiryCB], c_void_p
+    lib.SetConfigRenewal.argtypes, lib.SetConfigRenewal.restype = [c_int], c_void_p
     lib.FreeString.argtypes, lib.FreeString.restype = [c_void_p], None
     lib.DiscoOrganizations.argtypes, lib.DiscoOrganizations.restype = [c_int], DataError
     lib.DiscoServers.argtypes, lib.DiscoServers.restype = [c_int], DataError
+    lib.DiscoSearch.argtypes, lib.DiscoSearch.restype = [c_char_p, c_int], DataError
     lib.GetConfig.argtypes, lib.GetConfig.restype = [
         c_int,
         c_int,
@@ -113,6 +118,44 @@ def initialize_functions(lib: CDLL) -> None:
     lib.SetSupportWireguard.argtypes, lib.SetSupportWireguard.restype = [
         c_int,
     ], c_void_p
+    lib.ExportServers.argtypes, lib.ExportServers.restype = [c_int], DataError
+    lib.ImportServers.argtypes, lib.ImportServers.restype = [
+        c_int,
+        c_char_p,
+        c_int,
+    ], c_void_p
+    lib.StateRecovered.argtypes, lib.StateRecovered.restype = [], c_void_p
+    lib.SetAuthFlow.argtypes, lib.SetAuthFlow.restype = [c_int], c_void_p
+    lib.StateGraph.argtypes, lib.StateGraph.restype = [c_int], DataError
+    lib.SetTransitionHistory.argtypes, lib.SetTransitionHistory.restype = [
+        c_int
+    ], c_void_p
+    lib.TransitionHistory.argtypes, lib.TransitionHistory.restype = [], DataError
+    lib.SetLogLevel.argtypes, lib.SetLogLevel.restype = [c_char_p, c_int], c_void_p
+    lib.Diagnostics.argtypes, lib.Diagnostics.restype = [c_char_p], c_void_p
+    lib.SetLogFormat.argtypes, lib.SetLogFormat.restype = [c_int], c_void_p
+    lib.SetLogRotation.argtypes, lib.SetLogRotation.restype = [
+        c_longlong,
+        c_int,
+    ], c_void_p
+    lib.SetCapabilities.argtypes, lib.SetCapabilities.restype = [
+        c_char_p
+    ], c_void_p
+    lib.SetProtocolPreference.argtypes, lib.SetProtocolPreference.restype = [
+        c_int
+    ], c_void_p
+    lib.SetServerProtocolPreference.argtypes, lib.SetServerProtocolPreference.restype = [
+        c_int,
+        c_char_p,
+        c_int,
+    ], c_void_p
+    lib.SetDiscoveryConfig.argtypes, lib.SetDiscoveryConfig.restype = [
+        c_char_p
+    ], c_void_p
+    lib.SetTokenFileStore.argtypes, lib.SetTokenFileStore.restype = [
+        c_char_p,
+        c_char_p,
+    ], c_void_p
     lib.SetState.argtypes, lib.SetState.restype = [
         c_int,
     ], c_void_p
@@ -125,6 +168,21 @@ def initialize_functions(lib: CDLL) -> None:
         c_int,
         ReadRxBytes,
     ], BoolError
+    lib.StartFailoverWithProbe.argtypes, lib.StartFailoverWithProbe.restype = [
+        c_int,
+        c_char_p,
+        c_int,
+        c_char_p,
+        ReadRxBytes,
+    ], BoolError
+    lib.StartLivenessMonitor.argtypes, lib.StartLivenessMonitor.restype = [
+        c_int,
+        c_char_p,
+        c_int,
+        c_char_p,
+        ReadRxBytes,
+        LivenessCB,
+    ], c_void_p
     lib.StartProxyguard.argtypes, lib.StartProxyguard.restype = [
         c_int,
         c_char_p,
@@ -5,6 +5,8 @@ from typing import Any, Callable, Iterator, Optional
 
 from eduvpn_common.loader import initialize_functions, load_lib
 from eduvpn_common.types import (
+    ExpiryCB,
+    LivenessCB,
     ReadRxBytes,
     TokenGetter,
     TokenSetter,
@@ -82,6 +84,7 @@ class EduVPN(object):
         self.jar = Jar(lambda x: self.go_function(self.lib.CookieCancel, x))
         self.token_setter = None
         self.token_getter = None
+        self.expiry_handler = None
         self.event_handler = EventHandler()
 
         # Load the library
@@ -168,6 +171,32 @@ class EduVPN(object):
             forwardError(expiry_err)
         return expiry
 
+    def set_expiry_handler(self, handler: Optional[Callable]) -> None:
+        """Set the handler that is called with the expiry events of the VPN
+
+        :param handler: Optional[Callable]: The function that is called with the event JSON, None to disable
+
+        :raises WrappedError: An error by the Go library
+        """
+        self.expiry_handler = handler
+        cb = expiry_callback
+        if handler is None:
+            cb = ExpiryCB()
+        expiry_err = self.go_function(self.lib.SetExpiryCallback, cb)
+        if expiry_err:
+            forwardError(expiry_err)
+
+    def set_config_renewal(self, seconds: int) -> None:
+        """Renew the configuration without user interaction before the VPN expires, the new configuration is passed to the expiry handler
+
+        :param seconds: int: The number of seconds before expiry to renew the configuration, 0 to disable
+
+        :raises WrappedError: An error by the Go library
+        """
+        renewal_err = self.go_function(self.lib.SetConfigRenewal, seconds)
+        if renewal_err:
+            forwardError(renewal_err)
+
     def get_current_server(self) -> str:
         server, server_err = self.go_function(self.lib.CurrentServer)
         if server_err:
@@ -184,12 +213,61 @@ class EduVPN(object):
         # TODO: Log error
         return servers
 
+    def search_disco(self, query: str, _type: int = 0) -> str:
+        """Search the discovery organizations and servers
+
+        :param query: str: The search query
+        :param _type: int: Filter by server type, 0 for no filtering
+
+        :raises WrappedError: An error by the Go library
+        """
+        results, results_err = self.go_function(self.lib.DiscoSearch, query, _type)
+        if results_err:
+            forwardError(results_err)
+        return results
+
+    def set_discovery_config(self, config: str = "") -> None:
+        """Set the discovery source, e.g. a private mirror signed with another minisign key
+
+        :param config: str: The JSON configuration with "url", "keys" and "force_prehash", empty for the defaults
+
+        :raises WrappedError: An error by the Go library
+        """
+        config_err = self.go_function(self.lib.SetDiscoveryConfig, config)
+        if config_err:
+            forwardError(config_err)
+
     def get_servers(self) -> str:
         servers, servers_err = self.go_function(self.lib.ServerList)
         if servers_err:
             forwardError(servers_err)
         return servers
 
+    def export_servers(self, with_tokens: bool = False) -> str:
+        """Export the added servers as a JSON document
+
+        :param with_tokens: bool: Whether the OAuth tokens should be exported too
+
+        :raises WrappedError: An error by the Go library
+        """
+        exported, exported_err = self.go_function(self.lib.ExportServers, with_tokens)
+        if exported_err:
+            forwardError(exported_err)
+        return exported
+
+    def import_servers(self, data: str, replace: bool = False) -> None:
+        """Import servers from a JSON document that was created with export_servers
+
+        :param data: str: The JSON document
+        :param replace: bool: Whether the current servers should be removed first instead of merged
+
+        :raises WrappedError: An error by the Go library
+        """
+        import_err = self.go_cookie_function(self.lib.ImportServers, data, replace)
+
+        if import_err:
+            forwardError(import_err)
+
     def remove_server(self, _type: ServerType, _id: str) -> None:
         """Remove a server
 
@@ -304,6 +382,19 @@ class EduVPN(object):
         if handler_err:
             forwardError(handler_err)
 
+    def set_token_file_store(self, passphrase: str = "", key_file: str = "") -> None:
+        """Save the OAuth tokens encrypted in a file in the config directory
+
+        :param passphrase: str: The passphrase to derive the encryption key from
+        :param key_file: str: The path to a key file to derive the encryption key from
+
+        :raises WrappedError: An error by the Go library
+        """
+        store_err = self.go_function(self.lib.SetTokenFileStore, passphrase, key_file)
+
+        if store_err:
+            forwardError(store_err)
+
     def cookie_reply(self, cookie: int, data: str) -> None:
         """Reply with the given cookie and data"""
         cookie_err = self.go_function(self.lib.CookieReply, cookie, data)
@@ -332,19 +423,209 @@ class EduVPN(object):
         if support_err:
             forwardError(support_err)
 
+    def state_recovered(self) -> None:
+        """Check if the state file could not be loaded normally when registering
+
+        :raises WrappedError: An error by the Go library if the state file was corrupt or written by a newer version
+        """
+        recovered_err = self.go_function(self.lib.StateRecovered)
+
+        if recovered_err:
+            forwardError(recovered_err)
+
+    def set_auth_flow(self, flow: int) -> None:
+        """Set the OAuth flow that is used for new authorizations
+
+        :param flow: int: 0 for the browser flow, 1 for the device authorization grant for headless clients
+
+        :raises WrappedError: An error by the Go library
+        """
+        flow_err = self.go_function(self.lib.SetAuthFlow, flow)
+
+        if flow_err:
+            forwardError(flow_err)
+
+    def set_transition_history(self, size: int) -> None:
+        """Set the maximum number of state transitions that are recorded
+
+        :param size: int: The maximum number of transitions, 0 disables recording
+
+        :raises WrappedError: An error by the Go library
+        """
+        history_err = self.go_function(self.lib.SetTransitionHistory, size)
+
+        if history_err:
+            forwardError(history_err)
+
+    def write_diagnostics(self, path: str) -> None:
+        """Write a zip archive with redacted diagnostics that can be attached to a bug report
+
+        :param path: str: The path of the zip archive, an existing file is overwritten
+
+        :raises WrappedError: An error by the Go library
+        """
+        diagnostics_err = self.go_function(self.lib.Diagnostics, path)
+
+        if diagnostics_err:
+            forwardError(diagnostics_err)
+
+    def set_log_level(self, level: int, component: str = "") -> None:
+        """Set the log level of a component at runtime
+
+        :param level: int: 1=debug, 2=info, 3=warning, 4=error, 5=fatal, 0 to use the default level for the component
+        :param component: str: The component, e.g. discovery, empty to set the default level
+
+        :raises WrappedError: An error by the Go library
+        """
+        level_err = self.go_function(self.lib.SetLogLevel, component, level)
+
+        if level_err:
+            forwardError(level_err)
+
+    def set_log_format(self, log_format: int) -> None:
+        """Set the format of the log
+
+        :param log_format: int: 0 for text and 1 for JSON lines
+
+        :raises WrappedError: An error by the Go library
+        """
+        format_err = self.go_function(self.lib.SetLogFormat, log_format)
+
+        if format_err:
+            forwardError(format_err)
+
+    def set_log_rotation(self, max_size: int, max_files: int) -> None:
+        """Set when the log file is rotated
+
+        :param max_size: int: The size in bytes after which the log file is rotated, 0 disables rotation
+        :param max_files: int: The number of rotated log files that are kept
+
+        :raises WrappedError: An error by the Go library
+        """
+        rotation_err = self.go_function(self.lib.SetLogRotation, max_size, max_files)
+
+        if rotation_err:
+            forwardError(rotation_err)
+
+    def get_transition_history(self) -> str:
+        """Get the recorded state transitions as JSON, the oldest first
+
+        :raises WrappedError: An error by the Go library
+
+        :return: The transitions as JSON
+        :rtype: str
+        """
+        history, history_err = self.go_function(self.lib.TransitionHistory)
+
+        if history_err:
+            forwardError(history_err)
+        return history
+
+    def get_state_graph(self, graph_format: int = 0) -> str:
+        """Get a graph of the state machine with the current state and the transition history highlighted
+
+        :param graph_format: int: 0 for Mermaid, 1 for Graphviz DOT
+
+        :raises WrappedError: An error by the Go library
+
+        :return: The graph
+        :rtype: str
+        """
+        graph, graph_err = self.go_function(self.lib.StateGraph, graph_format)
+
+        if graph_err:
+            forwardError(graph_err)
+        return graph
+
+    def set_capabilities(self, capabilities: str = "") -> None:
+        """Set the capabilities of the client, profiles that cannot be used with them are filtered
+
+        :param capabilities: str: The JSON capabilities with "tcp_only" and "default_gateway_only", empty for none
+
+        :raises WrappedError: An error by the Go library
+        """
+        caps_err = self.go_function(self.lib.SetCapabilities, capabilities)
+
+        if caps_err:
+            forwardError(caps_err)
+
+    def set_protocol_preference(self, pref: int) -> None:
+        """Set the client wide VPN protocol preference
+
+        :param pref: int: 0 for auto, 1 to prefer OpenVPN, 2 to prefer WireGuard, 3 for only OpenVPN, 4 for only WireGuard
+
+        :raises WrappedError: An error by the Go library
+        """
+        pref_err = self.go_function(self.lib.SetProtocolPreference, pref)
+
+        if pref_err:
+            forwardError(pref_err)
+
+    def set_server_protocol_preference(
+        self, _type: ServerType, _id: str, pref: int
+    ) -> None:
+        """Set the VPN protocol preference for a server, this is saved in the state file
+
+        :param _type: ServerType: The type of server e.g. SERVER.INSTITUTE_ACCESS
+        :param _id: str: The identifier of the server, e.g. "https://vpn.example.com/"
+        :param pref: int: The preference, see set_protocol_preference. 0 (auto) uses the client wide preference
+
+        :raises WrappedError: An error by the Go library
+        """
+        pref_err = self.go_function(
+            self.lib.SetServerProtocolPreference, int(_type), _id, pref
+        )
+
+        if pref_err:
+            forwardError(pref_err)
+
     def start_failover(
-        self, gateway: str, wg_mtu: int, readrxbytes: ReadRxBytes
+        self,
+        gateway: str,
+        wg_mtu: int,
+        readrxbytes: ReadRxBytes,
+        probe: str = "",
     ) -> bool:
         dropped, dropped_err = self.go_cookie_function(
-            self.lib.StartFailover,
+            self.lib.StartFailoverWithProbe,
             gateway,
             wg_mtu,
+            probe,
             readrxbytes,
         )
         if dropped_err:
             forwardError(dropped_err)
         return dropped
 
+    def start_liveness_monitor(
+        self,
+        gateway: str,
+        wg_mtu: int,
+        readrxbytes: ReadRxBytes,
+        on_event: LivenessCB,
+        probe: str = "",
+    ) -> None:
+        """Monitor whether or not the VPN can reach the gateway until the cookie is cancelled, this blocks
+
+        :param gateway: str: The gateway IP of the VPN
+        :param wg_mtu: int: The MTU of the VPN
+        :param readrxbytes: ReadRxBytes: The function that reads the rx bytes of the VPN interface
+        :param on_event: LivenessCB: The function that is called with the health: 0=healthy, 1=degraded, 2=dropped
+        :param probe: str: The probe JSON, empty for ICMP pings
+
+        :raises WrappedError: An error by the Go library
+        """
+        monitor_err = self.go_cookie_function(
+            self.lib.StartLivenessMonitor,
+            gateway,
+            wg_mtu,
+            probe,
+            readrxbytes,
+            on_event,
+        )
+        if monitor_err:
+            forwardError(monitor_err)
+
     def start_proxyguard(self, listen: str, source_port: int, peer: str):
         proxy_err = self.go_cookie_function(
             self.lib.StartProxyguard,
@@ -388,6 +669,16 @@ def token_getter(server_id: ctypes.c_char_p, server_type: ctypes.c_int, buf: cty
     outbuf.contents.value = got.encode("utf-8")
 
 
+@ExpiryCB
+def expiry_callback(event: ctypes.c_char_p):
+    global global_object
+    if global_object is None:
+        return
+    if global_object.expiry_handler is None:
+        return
+    global_object.expiry_handler(event.decode("utf-8"))
+
+
 @VPNStateChange
 def state_callback(old_state: int, new_state: int, data: str) -> int:
     """The internal callback that is passed to the Go library
@@ -26,3 +26,4 @@ class State(StateEnum):
     CONNECTED = 9
     DISCONNECTING = 10
     DISCONNECTED = 11
+    OAUTH_DEVICE_STARTED = 12
@@ -35,6 +35,8 @@ class BoolError(Structure):
 # The type for a Go state change callback
 VPNStateChange = CFUNCTYPE(c_int, c_int, c_int, c_char_p)
 ReadRxBytes = CFUNCTYPE(c_ulonglong)
+LivenessCB = CFUNCTYPE(None, c_int)
+ExpiryCB = CFUNCTYPE(None, c_char_p)
 TokenGetter = CFUNCTYPE(c_void_p, c_char_p, c_int, POINTER(c_char), c_size_t)
 TokenSetter = CFUNCTYPE(c_void_p, c_char_p, c_int, c_char_p)
 